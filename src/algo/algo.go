@@ -98,6 +98,67 @@ func FuzzyMatch(caseSensitive bool, forward bool, runes []rune, pattern []rune)
 	return -1, -1
 }
 
+// FuzzyMatchShortest performs fuzzy-match like FuzzyMatch, but instead of
+// returning the first match found, it tries every possible starting position
+// to find the shortest one. It is considerably slower than FuzzyMatch so it
+// is only used to refine the ranks of a small number of items.
+func FuzzyMatchShortest(caseSensitive bool, forward bool, runes []rune, pattern []rune) (int, int) {
+	if len(pattern) == 0 {
+		return 0, 0
+	}
+
+	lenRunes := len(runes)
+	lenPattern := len(pattern)
+	charAt := func(index int) rune {
+		char := runeAt(runes, index, lenRunes, forward)
+		if !caseSensitive {
+			if char >= 'A' && char <= 'Z' {
+				char += 32
+			} else if char > unicode.MaxASCII {
+				char = unicode.To(unicode.LowerCase, char)
+			}
+		}
+		return char
+	}
+
+	sidx := -1
+	eidx := -1
+	first := runeAt(pattern, 0, lenPattern, forward)
+	for start := 0; start < lenRunes; start++ {
+		if charAt(start) != first {
+			continue
+		}
+		pidx := 1
+		end := start + 1
+		for ; pidx < lenPattern && end < lenRunes; end++ {
+			if eidx >= 0 && end-start >= eidx-sidx {
+				break
+			}
+			if charAt(end) == runeAt(pattern, pidx, lenPattern, forward) {
+				pidx++
+			}
+		}
+		if pidx < lenPattern {
+			if end == lenRunes {
+				// No match from this position or any of the later ones
+				break
+			}
+			continue
+		}
+		if eidx < 0 || end-start < eidx-sidx {
+			sidx, eidx = start, end
+		}
+	}
+
+	if sidx < 0 {
+		return -1, -1
+	}
+	if forward {
+		return sidx, eidx
+	}
+	return lenRunes - eidx, lenRunes - sidx
+}
+
 // ExactMatchNaive is a basic string searching algorithm that handles case
 // sensitivity. Although naive, it still performs better than the combination
 // of strings.ToLower + strings.Index for typical fzf use cases where input
@@ -30,6 +30,15 @@ func TestFuzzyMatchBackward(t *testing.T) {
 	assertMatch(t, FuzzyMatch, false, false, "foobar fb", "fb", 7, 9)
 }
 
+func TestFuzzyMatchShortest(t *testing.T) {
+	assertMatch(t, FuzzyMatch, false, true, "a_b__ab", "ab", 0, 3)
+	assertMatch(t, FuzzyMatchShortest, false, true, "a_b__ab", "ab", 5, 7)
+	assertMatch(t, FuzzyMatchShortest, false, false, "ab__a_b", "ab", 0, 2)
+	assertMatch(t, FuzzyMatchShortest, false, true, "fooBarbaz", "oBZ", 2, 9)
+	assertMatch(t, FuzzyMatchShortest, true, true, "fooBarbaz", "oBZ", -1, -1)
+	assertMatch(t, FuzzyMatchShortest, false, true, "foobar fb", "fb", 7, 9)
+}
+
 func TestExactMatchNaive(t *testing.T) {
 	for _, dir := range []bool{true, false} {
 		assertMatch(t, ExactMatchNaive, false, dir, "fooBarbaz", "oBA", 2, 5)
@@ -0,0 +1,92 @@
+package fzf
+
+import (
+	"strings"
+	"unicode"
+
+	C "github.com/junegunn/fzf/src/curses"
+	"github.com/junegunn/fzf/src/util"
+)
+
+// sliceItem returns the copy of the item with the part of the text from begin
+// to end. The offsets of the matches and the ANSI colors are shifted and
+// clipped to the part.
+func sliceItem(item *Item, begin int, end int) *Item {
+	move := func(offset int32) int32 {
+		return util.Constrain32(offset-int32(begin), 0, int32(end-begin))
+	}
+	offsets := make([]Offset, len(item.offsets))
+	for idx, offset := range item.offsets {
+		offsets[idx] = Offset{move(offset[0]), move(offset[1]), offset[2]}
+	}
+	colors := make([]ansiOffset, len(item.colors))
+	for idx, ansi := range item.colors {
+		colors[idx] = ansiOffset{[2]int32{move(ansi.offset[0]), move(ansi.offset[1])}, ansi.color}
+	}
+	return &Item{text: item.text[begin:end], offsets: offsets, colors: colors, rank: item.rank}
+}
+
+// delimiterLength returns the number of the runes of the delimiter at the end
+// of the field, which is not displayed between the item and its annotation
+func (t *Terminal) delimiterLength(field []rune) int {
+	if t.delimiter.str != nil {
+		if strings.HasSuffix(string(field), *t.delimiter.str) {
+			return len([]rune(*t.delimiter.str))
+		}
+		return 0
+	}
+	if t.delimiter.regex != nil {
+		str := string(field)
+		if loc := t.delimiter.regex.FindStringIndex(str); loc != nil {
+			return len([]rune(str[loc[0]:]))
+		}
+		return 0
+	}
+	// AWK-style fields end with the whitespaces
+	length := 0
+	for idx := len(field) - 1; idx >= 0 && unicode.IsSpace(field[idx]); idx-- {
+		length++
+	}
+	return length
+}
+
+// splitAnnotation splits the item into the part displayed on the left and the
+// last field displayed on the right as the annotation with --annotation. The
+// annotation is nil if the item has only one field.
+func (t *Terminal) splitAnnotation(item *Item) (*Item, *Item) {
+	if !t.annotate {
+		return item, nil
+	}
+	tokens := Tokenize(item.text, t.delimiter)
+	if len(tokens) < 2 {
+		return item, nil
+	}
+	last := tokens[len(tokens)-1]
+	prev := tokens[len(tokens)-2]
+	end := prev.prefixLength + len(prev.text) - t.delimiterLength(prev.text)
+	return sliceItem(item, 0, end), sliceItem(item, last.prefixLength, len(item.text))
+}
+
+// printAnnotation prints the annotation on the row of the list aligned to the
+// right end of the screen
+func (t *Terminal) printAnnotation(annotation *Item, row int, current bool) {
+	col1, col2 := C.ColAnnotation, C.ColMatch
+	if current {
+		col1, col2 = C.ColCurrentAnnotation, C.ColCurrentMatch
+	}
+	offsets := annotation.colorOffsets(col2, current, current)
+	text := t.annotationText(annotation)
+	t.move(t.listLine(row), t.itemIndent()+t.maxItemWidth()-displayWidth(text), false)
+	t.printColored(text, offsets, col1, current)
+}
+
+// annotationText returns the text of the annotation to display, which is
+// trimmed to a half of the width for the item
+func (t *Terminal) annotationText(annotation *Item) []rune {
+	width := t.maxItemWidth() / 2
+	text, _ := trimRight(annotation.text, width)
+	if len(text) > 0 && displayWidth(text) > width {
+		text = text[:len(text)-1]
+	}
+	return text
+}
@@ -0,0 +1,31 @@
+package fzf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAnnotation(t *testing.T) {
+	check := func(delimiter string, text string, offsets []Offset, expected []string, expectedOffsets [][]Offset) {
+		term := &Terminal{annotate: true}
+		if len(delimiter) > 0 {
+			term.delimiter = delimiterRegexp(delimiter)
+		}
+		left, annotation := term.splitAnnotation(&Item{text: []rune(text), offsets: offsets})
+		list := []string{string(left.text)}
+		listOffsets := [][]Offset{left.offsets}
+		if annotation != nil {
+			list = append(list, string(annotation.text))
+			listOffsets = append(listOffsets, annotation.offsets)
+		}
+		if !reflect.DeepEqual(list, expected) || !reflect.DeepEqual(listOffsets, expectedOffsets) {
+			t.Errorf("%q: %q %v (expected: %q %v)", text, list, listOffsets, expected, expectedOffsets)
+		}
+	}
+	check("", "foo", nil, []string{"foo"}, [][]Offset{nil})
+	check("", "foo bar  12K", []Offset{{4, 7, 3}},
+		[]string{"foo bar", "12K"}, [][]Offset{{{4, 7, 3}}, {{0, 0, 3}}})
+	check(":", "foo:bar:3M", []Offset{{0, 3, 3}, {8, 9, 1}},
+		[]string{"foo:bar", "3M"}, [][]Offset{{{0, 3, 3}, {7, 7, 1}}, {{0, 0, 3}, {0, 1, 1}}})
+	check("[0-9]+", "a1b22c", nil, []string{"a1b", "c"}, [][]Offset{{}, {}})
+}
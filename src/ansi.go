@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"strings"
 	"unicode/utf8"
+
+	"github.com/junegunn/fzf/src/util"
 )
 
 type ansiOffset struct {
@@ -33,7 +35,11 @@ func (s *ansiState) equals(t *ansiState) bool {
 var ansiRegex *regexp.Regexp
 
 func init() {
-	ansiRegex = regexp.MustCompile("\x1b\\[[0-9;]*[mK]")
+	// Besides SGR sequences, we strip the other CSI sequences, character set
+	// designations, and OSC sequences such as hyperlinks so that they don't
+	// end up in the text to match
+	ansiRegex = regexp.MustCompile(
+		"\x1b\\[[0-9;?]*[a-zA-Z]|\x1b[()][0-9A-B]|\x1b\\][^\x07\x1b]*(\x07|\x1b\\\\)")
 }
 
 func extractColor(str string, state *ansiState) (string, []ansiOffset, *ansiState) {
@@ -88,62 +94,127 @@ func interpretCode(ansiCode string, prevState *ansiState) *ansiState {
 	} else {
 		state = &ansiState{prevState.fg, prevState.bg, prevState.bold}
 	}
-	if ansiCode[len(ansiCode)-1] == 'K' {
+	if ansiCode[len(ansiCode)-1] != 'm' {
 		return state
 	}
 
-	ptr := &state.fg
-	state256 := 0
-
 	init := func() {
 		state.fg = -1
 		state.bg = -1
 		state.bold = false
-		state256 = 0
 	}
 
 	ansiCode = ansiCode[2 : len(ansiCode)-1]
 	if len(ansiCode) == 0 {
 		init()
 	}
-	for _, code := range strings.Split(ansiCode, ";") {
-		if num, err := strconv.Atoi(code); err == nil {
-			switch state256 {
-			case 0:
-				switch num {
-				case 38:
-					ptr = &state.fg
-					state256++
-				case 48:
-					ptr = &state.bg
-					state256++
-				case 39:
-					state.fg = -1
-				case 49:
-					state.bg = -1
-				case 1:
-					state.bold = true
-				case 0:
-					init()
-				default:
-					if num >= 30 && num <= 37 {
-						state.fg = num - 30
-					} else if num >= 40 && num <= 47 {
-						state.bg = num - 40
-					}
-				}
-			case 1:
-				switch num {
-				case 5:
-					state256++
-				default:
-					state256 = 0
-				}
-			case 2:
-				*ptr = num
-				state256 = 0
+	codes := strings.Split(ansiCode, ";")
+	for idx := 0; idx < len(codes); idx++ {
+		num, err := strconv.Atoi(codes[idx])
+		if err != nil {
+			continue
+		}
+		switch num {
+		case 38, 48:
+			ptr := &state.fg
+			if num == 48 {
+				ptr = &state.bg
+			}
+			color, consumed := extendedColor(codes[idx+1:])
+			if color >= 0 {
+				*ptr = color
+			}
+			idx += consumed
+		case 39:
+			state.fg = -1
+		case 49:
+			state.bg = -1
+		case 1:
+			state.bold = true
+		case 22:
+			state.bold = false
+		case 0:
+			init()
+		default:
+			if num >= 30 && num <= 37 {
+				state.fg = num - 30
+			} else if num >= 40 && num <= 47 {
+				state.bg = num - 40
+			} else if num >= 90 && num <= 97 {
+				state.fg = num - 90 + 8
+			} else if num >= 100 && num <= 107 {
+				state.bg = num - 100 + 8
 			}
 		}
 	}
 	return state
 }
+
+// extendedColor interprets the arguments of 38 and 48 codes; either 5;N for
+// 256 colors or 2;R;G;B for 24-bit colors, which are approximated to the
+// closest ones in the 256-color palette. Returns the color, or -1 if invalid,
+// and the number of the arguments consumed.
+func extendedColor(args []string) (int, int) {
+	if len(args) == 0 {
+		return -1, 0
+	}
+	nums := []int{}
+	for _, arg := range args {
+		num, err := strconv.Atoi(arg)
+		if err != nil {
+			num = -1
+		}
+		nums = append(nums, num)
+	}
+	switch nums[0] {
+	case 5:
+		if len(nums) < 2 || nums[1] < 0 || nums[1] > 255 {
+			return -1, util.Min(2, len(nums))
+		}
+		return nums[1], 2
+	case 2:
+		if len(nums) < 4 {
+			return -1, len(nums)
+		}
+		for _, c := range nums[1:4] {
+			if c < 0 || c > 255 {
+				return -1, 4
+			}
+		}
+		return rgbTo256(nums[1], nums[2], nums[3]), 4
+	}
+	return -1, 1
+}
+
+// rgbTo256 returns the closest color in the 6x6x6 color cube or in the
+// grayscale ramp of the 256-color palette
+func rgbTo256(r int, g int, b int) int {
+	cube := func(c int) int {
+		if c < 48 {
+			return 0
+		} else if c < 115 {
+			return 1
+		}
+		return (c - 35) / 40
+	}
+	level := func(i int) int {
+		if i == 0 {
+			return 0
+		}
+		return 55 + i*40
+	}
+	distance := func(r2 int, g2 int, b2 int) int {
+		return (r-r2)*(r-r2) + (g-g2)*(g-g2) + (b-b2)*(b-b2)
+	}
+
+	cr, cg, cb := cube(r), cube(g), cube(b)
+	cubeColor := 16 + 36*cr + 6*cg + cb
+
+	gray := util.Constrain(((r+g+b)/3-3)/10, 0, 23)
+	grayLevel := 8 + gray*10
+
+	if distance(grayLevel, grayLevel, grayLevel) < distance(level(cr), level(cg), level(cb)) {
+		return 232 + gray
+	}
+	return cubeColor
+}
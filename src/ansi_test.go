@@ -150,3 +150,35 @@ func TestExtractColor(t *testing.T) {
 		assert(offsets[1], 6, 11, 200, 100, false)
 	})
 }
+
+func TestExtractColorExtended(t *testing.T) {
+	check := func(src string, expected string, fg int, bg int, bold bool) {
+		output, offsets, _ := extractColor(src, nil)
+		if output != expected {
+			t.Errorf("Invalid output: %q", output)
+		}
+		if len(offsets) != 1 || offsets[0].color.fg != fg ||
+			offsets[0].color.bg != bg || offsets[0].color.bold != bold {
+			t.Errorf("Invalid offsets for %q: %v", src, offsets)
+		}
+	}
+	// Bright colors
+	check("\x1b[1;91;104mfoo", "foo", 9, 12, true)
+	// Normal intensity
+	check("\x1b[1;32;22mfoo", "foo", 2, -1, false)
+	// 24-bit colors are approximated, and the codes that follow them are
+	// not misinterpreted
+	check("\x1b[38;2;255;0;0;48;2;128;128;128;1mfoo", "foo", 196, 244, true)
+	// Other escape sequences are removed
+	check("\x1b(B\x1b[31mfoo\x1b[K\x1b]8;;http://x\x07\x1b[?25h", "foo", 1, -1, false)
+}
+
+func TestRgbTo256(t *testing.T) {
+	for _, test := range [][4]int{
+		{0, 0, 0, 16}, {255, 255, 255, 231}, {255, 0, 0, 196},
+		{95, 135, 175, 67}, {128, 128, 128, 244}, {8, 8, 8, 232}} {
+		if color := rgbTo256(test[0], test[1], test[2]); color != test[3] {
+			t.Errorf("%v: %d", test, color)
+		}
+	}
+}
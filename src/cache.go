@@ -5,20 +5,25 @@ import "sync"
 // queryCache associates strings to lists of items
 type queryCache map[string][]*Item
 
-// ChunkCache associates Chunk and query string to lists of items
+// chunkSummary is the set of the characters found in the items of a chunk
+type chunkSummary [indexCharSetSize]byte
+
+// ChunkCache associates Chunk and query string to lists of items. It also
+// keeps the summaries of the chunks to skip the ones that cannot match.
 type ChunkCache struct {
-	mutex sync.Mutex
-	cache map[*Chunk]*queryCache
+	mutex     sync.Mutex
+	cache     map[*Chunk]*queryCache
+	summaries map[*Chunk]*chunkSummary
 }
 
 // NewChunkCache returns a new ChunkCache
 func NewChunkCache() ChunkCache {
-	return ChunkCache{sync.Mutex{}, make(map[*Chunk]*queryCache)}
+	return ChunkCache{sync.Mutex{}, make(map[*Chunk]*queryCache), make(map[*Chunk]*chunkSummary)}
 }
 
 // Add adds the list to the cache
 func (cc *ChunkCache) Add(chunk *Chunk, key string, list []*Item) {
-	if len(key) == 0 || !chunk.IsFull() || len(list) > queryCacheMax {
+	if len(key) == 0 || !chunk.IsFull() || len(list) > chunkSize/queryCacheRatio {
 		return
 	}
 
@@ -33,6 +38,38 @@ func (cc *ChunkCache) Add(chunk *Chunk, key string, list []*Item) {
 	(*qc)[key] = list
 }
 
+// Evict removes the lists for the chunk that is no longer in use
+func (cc *ChunkCache) Evict(chunk *Chunk) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	delete(cc.cache, chunk)
+	delete(cc.summaries, chunk)
+}
+
+// MayMatch returns false if none of the items in the chunk can match the
+// pattern as some of the characters in the pattern are absent from the
+// chunk. The summary of the chunk is built on the first call once it's full.
+func (cc *ChunkCache) MayMatch(chunk *Chunk, pattern *Pattern) bool {
+	if !chunk.IsFull() {
+		return true
+	}
+
+	cc.mutex.Lock()
+	summary, found := cc.summaries[chunk]
+	cc.mutex.Unlock()
+	if !found {
+		summary = &chunkSummary{}
+		buildCharSet(chunk, summary[:])
+		cc.mutex.Lock()
+		cc.summaries[chunk] = summary
+		cc.mutex.Unlock()
+	}
+	return patternMayMatch(pattern, func(text []rune, _ bool) bool {
+		return containsChars(summary[:], text)
+	})
+}
+
 // Find is called to lookup ChunkCache
 func (cc *ChunkCache) Find(chunk *Chunk, key string) ([]*Item, bool) {
 	if len(key) == 0 || !chunk.IsFull() {
@@ -38,3 +38,40 @@ func TestChunkCache(t *testing.T) {
 		}
 	}
 }
+
+func TestChunkCacheMayMatch(t *testing.T) {
+	defer clearPatternCache()
+	cache := NewChunkCache()
+	full := make(Chunk, chunkSize)
+	for idx := range full {
+		full[idx] = &Item{text: []rune("Foo Bar")}
+	}
+	partial := Chunk{&Item{text: []rune("baz")}}
+	build := func(extended bool, query string) *Pattern {
+		clearPatternCache()
+		return BuildPattern(true, extended, CaseSmart, true, []Range{}, Delimiter{}, []rune(query))
+	}
+
+	for _, query := range []string{"fb", "BAR", "oo r"} {
+		if !cache.MayMatch(&full, build(false, query)) {
+			t.Errorf("%s should be possible", query)
+		}
+	}
+	for _, query := range []string{"fz", "x"} {
+		if cache.MayMatch(&full, build(false, query)) {
+			t.Errorf("%s should be impossible", query)
+		}
+	}
+	if !cache.MayMatch(&full, build(true, "fb | xyz !baz")) || cache.MayMatch(&full, build(true, "fb xyz")) {
+		t.Error("Unexpected result for extended patterns")
+	}
+
+	// Not summarized until the chunk is full
+	if !cache.MayMatch(&partial, build(false, "x")) || len(cache.summaries) != 1 {
+		t.Error("Partial chunk should not be skipped")
+	}
+	cache.Evict(&full)
+	if len(cache.summaries) != 0 {
+		t.Error("Summary should be evicted")
+	}
+}
@@ -1,20 +1,116 @@
 package fzf
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/junegunn/fzf/src/util"
+)
 
 // Chunk is a list of Item pointers whose size has the upper limit of chunkSize
 type Chunk []*Item // >>> []Item
 
+// Capacity of each chunk set by --chunk-size. Never changes once fzf is
+// started.
+var chunkSize = defaultChunkSize
+
 // ItemBuilder is a closure type that builds Item object from a pointer to a
 // string and an integer
 type ItemBuilder func([]byte, int) *Item
 
+// PayloadSplitter splits a line into the label to build the item from and the
+// payload to attach to it. The payload is nil if the line has none.
+type PayloadSplitter func([]byte) ([]byte, []byte)
+
+// InputTransformer transforms a line before the item is built from it
+type InputTransformer func([]byte) []byte
+
+// uniqueItemBuilder returns an ItemBuilder that discards the lines that have
+// already been added to the list
+func uniqueItemBuilder(trans ItemBuilder) ItemBuilder {
+	seen := make(map[string]struct{})
+	return func(data []byte, index int) *Item {
+		key := string(data)
+		if _, found := seen[key]; found {
+			return nil
+		}
+		item := trans(data, index)
+		if item != nil {
+			seen[key] = struct{}{}
+		}
+		return item
+	}
+}
+
+// payloadItemBuilder returns an ItemBuilder that builds the items only from
+// the labels of the lines and attaches the rest to them as payloads, which
+// are neither displayed nor matched, but printed on selection
+func payloadItemBuilder(trans ItemBuilder, split PayloadSplitter) ItemBuilder {
+	return func(data []byte, index int) *Item {
+		label, payload := split(data)
+		item := trans(label, index)
+		if item != nil && payload != nil {
+			str := string(payload)
+			item.payload = &str
+		}
+		return item
+	}
+}
+
+// transformItemBuilder returns an ItemBuilder that builds the items from the
+// transformed lines, keeping the original lines to print on selection
+func transformItemBuilder(trans ItemBuilder, transform InputTransformer) ItemBuilder {
+	return func(data []byte, index int) *Item {
+		item := trans(transform(data), index)
+		if item != nil {
+			runes := util.BytesToRunes(data)
+			item.origText = &runes
+		}
+		return item
+	}
+}
+
+// boostItemBuilder returns an ItemBuilder that marks the items that were
+// accepted in the previous sessions so that they are ranked higher
+func boostItemBuilder(trans ItemBuilder, accepted map[string]bool, stripAnsi bool) ItemBuilder {
+	return func(data []byte, index int) *Item {
+		item := trans(data, index)
+		if item != nil {
+			item.boosted = accepted[item.AsString(stripAnsi)]
+		}
+		return item
+	}
+}
+
+// internItemBuilder returns an ItemBuilder that makes the items built from
+// identical lines share the same underlying data to save memory
+func internItemBuilder(trans ItemBuilder) ItemBuilder {
+	table := make(map[string]*Item)
+	return func(data []byte, index int) *Item {
+		key := string(data)
+		if prev, found := table[key]; found {
+			return &Item{
+				text:     prev.text,
+				origText: prev.origText,
+				colors:   prev.colors,
+				rank:     buildEmptyRank(int32(index)),
+				payload:  prev.payload}
+		}
+		item := trans(data, index)
+		if item != nil {
+			table[key] = item
+		}
+		return item
+	}
+}
+
 // ChunkList is a list of Chunks
 type ChunkList struct {
-	chunks []*Chunk
-	count  int
-	mutex  sync.Mutex
-	trans  ItemBuilder
+	chunks  []*Chunk
+	count   int
+	evicted int
+	tail    int
+	mutex   sync.Mutex
+	trans   ItemBuilder
 }
 
 // NewChunkList returns a new ChunkList
@@ -44,6 +140,18 @@ func (cl *ChunkList) lastChunk() *Chunk {
 	return cl.chunks[len(cl.chunks)-1]
 }
 
+// itemsEnd returns the number of the items pushed to the list up to the last
+// one in the chunks. Unlike CountItems, it keeps growing when the oldest
+// chunks are discarded to keep the last N items.
+func itemsEnd(cs []*Chunk) int {
+	for idx := len(cs) - 1; idx >= 0; idx-- {
+		if chunk := *cs[idx]; len(chunk) > 0 {
+			return int(chunk[len(chunk)-1].Index()) + 1
+		}
+	}
+	return 0
+}
+
 // CountItems returns the total number of Items
 func CountItems(cs []*Chunk) int {
 	if len(cs) == 0 {
@@ -64,11 +172,37 @@ func (cl *ChunkList) Push(data []byte) bool {
 
 	if cl.lastChunk().push(cl.trans, data, cl.count) {
 		cl.count++
+		cl.evict()
 		return true
 	}
 	return false
 }
 
+// evict discards the oldest chunks as long as the rest of the list holds at
+// least the last N items. The discarded chunks are not recycled as they can
+// still be referenced by the snapshots taken before.
+func (cl *ChunkList) evict() {
+	if cl.tail <= 0 {
+		return
+	}
+	for len(cl.chunks) > 1 && cl.count-cl.evicted-len(*cl.chunks[0]) >= cl.tail {
+		_cache.Evict(cl.chunks[0])
+		cl.evicted += len(*cl.chunks[0])
+		cl.chunks[0] = nil
+		cl.chunks = cl.chunks[1:]
+	}
+}
+
+// evictCache removes the cached results and the summaries of the chunks in
+// the list when the list is discarded
+func (cl *ChunkList) evictCache() {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	for _, chunk := range cl.chunks {
+		_cache.Evict(chunk)
+	}
+}
+
 // Snapshot returns immutable snapshot of the ChunkList
 func (cl *ChunkList) Snapshot() ([]*Chunk, int) {
 	cl.mutex.Lock()
@@ -77,11 +211,12 @@ func (cl *ChunkList) Snapshot() ([]*Chunk, int) {
 	ret := make([]*Chunk, len(cl.chunks))
 	copy(ret, cl.chunks)
 
-	// Duplicate the last chunk
-	if cnt := len(ret); cnt > 0 {
+	// Duplicate the last chunk unless it is full, as it is still growing. The
+	// full one is kept so that the cache for it can be evicted with the list.
+	if cnt := len(ret); cnt > 0 && !ret[cnt-1].IsFull() {
 		ret[cnt-1] = ret[cnt-1].dupe()
 	}
-	return ret, cl.count
+	return ret, cl.count - cl.evicted
 }
 
 func (c *Chunk) dupe() *Chunk {
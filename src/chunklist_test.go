@@ -3,6 +3,7 @@ package fzf
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestChunkList(t *testing.T) {
@@ -78,3 +79,188 @@ func TestChunkList(t *testing.T) {
 		t.Error("Unexpected number of items:", lastChunkCount)
 	}
 }
+
+func TestChunkListUnique(t *testing.T) {
+	cl := NewChunkList(uniqueItemBuilder(func(s []byte, i int) *Item {
+		if string(s) == "header" {
+			return nil
+		}
+		return &Item{text: []rune(string(s)), rank: buildEmptyRank(int32(i))}
+	}))
+	for _, str := range []string{"header", "foo", "bar", "foo", "header", "baz", "bar"} {
+		cl.Push([]byte(str))
+	}
+
+	snapshot, count := cl.Snapshot()
+	if count != 3 {
+		t.Error("Expected 3 items, got", count)
+	}
+	chunk := snapshot[0]
+	if string((*chunk)[0].text) != "foo" || string((*chunk)[1].text) != "bar" ||
+		string((*chunk)[2].text) != "baz" || (*chunk)[2].Index() != 2 {
+		t.Error("Invalid data")
+	}
+}
+
+func TestChunkListBoost(t *testing.T) {
+	sortCriteria = []criterion{byMatchLen, byLength}
+	accepted := map[string]bool{"foobar": true}
+	cl := NewChunkList(boostItemBuilder(func(s []byte, i int) *Item {
+		return &Item{text: []rune(string(s)), rank: buildEmptyRank(int32(i))}
+	}, accepted, false))
+	for _, str := range []string{"foo", "foobar"} {
+		cl.Push([]byte(str))
+	}
+
+	snapshot, _ := cl.Snapshot()
+	items := []*Item{(*snapshot[0])[0], (*snapshot[0])[1]}
+	if items[0].boosted || !items[1].boosted {
+		t.Error("Only the accepted item should be boosted")
+	}
+
+	// The accepted item wins over the shorter one with the same match
+	pattern := BuildPattern(true, false, CaseSmart, true, []Range{}, Delimiter{}, []rune("foo"))
+	defer clearPatternCache()
+	items = pattern.Match(snapshot[0])
+	sortItems(items, false)
+	if string(items[0].text) != "foobar" || items[0].Rank(true)[0] != 2 {
+		t.Error("The accepted item should be ranked higher", items[0].Rank(true))
+	}
+}
+
+func TestChunkListTail(t *testing.T) {
+	cl := NewChunkList(func(s []byte, i int) *Item {
+		return &Item{text: []rune(string(s)), rank: buildEmptyRank(int32(i))}
+	})
+	cl.tail = chunkSize + 1
+	for i := 0; i < chunkSize*2; i++ {
+		cl.Push([]byte(fmt.Sprintf("item %d", i)))
+	}
+	before, count := cl.Snapshot()
+	if len(before) != 2 || count != chunkSize*2 || itemsEnd(before) != chunkSize*2 {
+		t.Error("Should not discard any chunk yet", len(before), count)
+	}
+	_cache.Add(before[0], "foo", []*Item{})
+
+	// The first chunk is discarded once the others hold the last N items
+	for i := 0; i < chunkSize+1; i++ {
+		cl.Push([]byte(fmt.Sprintf("item %d", chunkSize*2+i)))
+	}
+	snapshot, count := cl.Snapshot()
+	if len(snapshot) != 2 || count != chunkSize+1 || CountItems(snapshot) != count {
+		t.Error("Expected 2 chunks with the last N items", len(snapshot), count)
+	}
+	if first := (*snapshot[0])[0]; first.Index() != int32(chunkSize*2) ||
+		string(first.text) != fmt.Sprintf("item %d", chunkSize*2) {
+		t.Error("Unexpected first item", first.Index())
+	}
+	if itemsEnd(snapshot) != chunkSize*3+1 {
+		t.Error("Unexpected end", itemsEnd(snapshot))
+	}
+	if _, found := _cache.Find(before[0], "foo"); found {
+		t.Error("Cache for the discarded chunk should be evicted")
+	}
+
+	// The snapshots taken before are intact
+	if len(*before[0]) != chunkSize || string((*before[0])[0].text) != "item 0" {
+		t.Error("The previous snapshot should not be modified")
+	}
+}
+
+func TestChunkListPayload(t *testing.T) {
+	cl := NewChunkList(payloadItemBuilder(func(s []byte, i int) *Item {
+		return &Item{text: []rune(string(s)), rank: buildEmptyRank(int32(i))}
+	}, payloadSplitter("::")))
+	for _, str := range []string{"Alice::42", "Bob", "Carol::7::8"} {
+		cl.Push([]byte(str))
+	}
+
+	snapshot, _ := cl.Snapshot()
+	chunk := *snapshot[0]
+	for idx, expected := range [][2]string{{"Alice", "42"}, {"Bob", "Bob"}, {"Carol", "7::8"}} {
+		if string(chunk[idx].text) != expected[0] || chunk[idx].AsString(false) != expected[1] {
+			t.Errorf("Expected %v, got %s / %s", expected, string(chunk[idx].text), chunk[idx].AsString(false))
+		}
+	}
+	if chunk[1].payload != nil {
+		t.Error("Should not have payload")
+	}
+}
+
+func TestChunkListTransform(t *testing.T) {
+	for _, transform := range []InputTransformer{
+		func(s []byte) []byte { return s[6:] },
+		commandTransformer("sed -u 's/^[0-9:]* //'", '\n')} {
+		cl := NewChunkList(transformItemBuilder(func(s []byte, i int) *Item {
+			return &Item{text: []rune(string(s)), rank: buildEmptyRank(int32(i))}
+		}, transform))
+		for _, str := range []string{"12:00 foo", "12:01 bar"} {
+			cl.Push([]byte(str))
+		}
+
+		snapshot, _ := cl.Snapshot()
+		chunk := *snapshot[0]
+		for idx, expected := range [][2]string{{"foo", "12:00 foo"}, {"bar", "12:01 bar"}} {
+			if string(chunk[idx].text) != expected[0] || chunk[idx].AsString(false) != expected[1] {
+				t.Errorf("Expected %v, got %s / %s", expected, string(chunk[idx].text), chunk[idx].AsString(false))
+			}
+		}
+	}
+
+	// The lines are left intact when the command fails
+	transform := commandTransformer("exit 1", '\n')
+	for i := 0; i < 2; i++ {
+		if str := string(transform([]byte("foo"))); str != "foo" {
+			t.Errorf("Expected foo, got %s", str)
+		}
+	}
+
+	// The command dropping a line is given up on after the timeout
+	transformTimeout = 100 * time.Millisecond
+	defer func() { transformTimeout = time.Second }()
+	transform = commandTransformer("grep --line-buffered foo", '\n')
+	for _, str := range []string{"foo", "bar", "foo"} {
+		if result := string(transform([]byte(str))); result != str {
+			t.Errorf("Expected %s, got %s", str, result)
+		}
+	}
+}
+
+func TestChunkListEvictCache(t *testing.T) {
+	cl := NewChunkList(func(s []byte, i int) *Item {
+		return &Item{text: []rune(string(s)), rank: buildEmptyRank(int32(i))}
+	})
+	for i := 0; i < chunkSize; i++ {
+		cl.Push([]byte(fmt.Sprintf("item %d", i)))
+	}
+	// The full chunk is not duplicated so that its cache can be evicted
+	snapshot, _ := cl.Snapshot()
+	if snapshot[0] != cl.chunks[0] {
+		t.Error("The full chunk should not be duplicated")
+	}
+	_cache.Add(snapshot[0], "foo", []*Item{})
+	_cache.MayMatch(snapshot[0], BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, []rune("foo")))
+	cl.evictCache()
+	if _, found := _cache.Find(snapshot[0], "foo"); found {
+		t.Error("Cache for the discarded list should be evicted")
+	}
+	if _, found := _cache.summaries[snapshot[0]]; found {
+		t.Error("Summary for the discarded list should be evicted")
+	}
+}
+
+func TestChunkListIntern(t *testing.T) {
+	cl := NewChunkList(internItemBuilder(func(s []byte, i int) *Item {
+		return &Item{text: []rune(string(s)), rank: buildEmptyRank(int32(i))}
+	}))
+	for _, str := range []string{"foo", "bar", "foo"} {
+		cl.Push([]byte(str))
+	}
+
+	snapshot, count := cl.Snapshot()
+	chunk := *snapshot[0]
+	if count != 3 || string(chunk[2].text) != "foo" || chunk[2].Index() != 2 ||
+		&chunk[0].text[0] != &chunk[2].text[0] || &chunk[0].text[0] == &chunk[1].text[0] {
+		t.Error("Invalid data")
+	}
+}
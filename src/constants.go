@@ -15,27 +15,69 @@ const (
 	coordinatorDelayStep time.Duration = 10 * time.Millisecond
 
 	// Reader
-	defaultCommand = `find . -path '*/\.*' -prune -o -type f -print -o -type l -print 2> /dev/null | sed s/^..//`
+	walkerConcurrency = 8 // Directories to read at the same time
+	followInterval    = 100 * time.Millisecond
+	fileMmapMin       = 1024 * 1024 // Size of the file to read by mmap
+
+	// The items read within the interval are searched together
+	readerBatchInterval = 5 * time.Millisecond
 
 	// Terminal
 	initialDelay    = 20 * time.Millisecond
 	initialDelayTac = 100 * time.Millisecond
 	spinnerDuration = 200 * time.Millisecond
 
+	// Time to wait for more resize signals before the relayout, as a burst of
+	// them is sent while the terminal window is being resized
+	resizeDebounce = 50 * time.Millisecond
+
+	// Percentage of the space for the list and the preview window to move
+	// the border by with grow-preview and shrink-preview
+	previewResizeStep = 5
+
+	// Maximum size of the output of the preview command to display
+	previewBufferMax = 1024 * 1024
+
+	// Maximum size of the text to copy to the clipboard. Terminal emulators
+	// ignore escape sequences that are too long.
+	clipboardMax = 64 * 1024
+
 	// Matcher
-	progressMinDuration = 200 * time.Millisecond
+	numPartitionsMultiplier = 8
+	maxPartitions           = 32
+	progressMinDuration     = 200 * time.Millisecond
+	cancelCheckInterval     = 10 * time.Millisecond
+	matchTimeSlice          = 10 * time.Millisecond
 
-	// Capacity of each chunk
-	chunkSize int = 100
+	// Number of top-ranked items to re-rank with the slower algorithm
+	rescoreMax = 1000
+
+	// Partial results of the ongoing search
+	partialResultsInterval = 100 * time.Millisecond
+	partialResultsMax      = 100000
+
+	// Default capacity of each chunk
+	defaultChunkSize int = 100
 
 	// Do not cache results of low selectivity queries
-	queryCacheMax int = chunkSize / 5
+	// (more than 1/queryCacheRatio of the items in the chunk)
+	queryCacheRatio int = 5
 
 	// Not to cache mergers with large lists
 	mergerCacheMax int = 100000
 
 	// History
 	defaultHistoryMax int = 1000
+
+	// Number of entries in the kill ring for yank-pop
+	killRingMax int = 16
+
+	// Rank boost for the items accepted in the previous sessions
+	acceptedBoost int32 = 1
+
+	// Persistent result cache
+	resultCacheMax      int = 20
+	resultCacheItemsMax int = 10000
 )
 
 // fzf events
@@ -44,8 +86,12 @@ const (
 	EvtReadFin
 	EvtSearchNew
 	EvtSearchProgress
+	EvtSearchPartial
 	EvtSearchFin
 	EvtHeader
+	EvtQueryChange
+	EvtReload
+	EvtThrottle
 	EvtClose
 )
 
@@ -27,8 +27,10 @@ package fzf
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/junegunn/fzf/src/util"
@@ -43,8 +45,12 @@ Reader   -> EvtReadFin
 Reader   -> EvtReadNew        -> Matcher  (restart)
 Terminal -> EvtSearchNew:bool -> Matcher  (restart)
 Matcher  -> EvtSearchProgress -> Terminal (update info)
+Matcher  -> EvtSearchPartial  -> Terminal (update list with partial result)
 Matcher  -> EvtSearchFin      -> Terminal (update list)
 Matcher  -> EvtHeader         -> Terminal (update header)
+Terminal -> EvtQueryChange    -> EventBus subscribers
+Terminal -> EvtReload         -> Reader   (restart with a new list)
+Terminal -> EvtThrottle:int   -> Matcher  (limit the number of processors)
 */
 
 // Run starts fzf
@@ -53,15 +59,33 @@ func Run(opts *Options) {
 
 	sort := opts.Sort > 0
 	sortCriteria = opts.Criteria
+	tiebreaker = opts.Comparator
+	if opts.ChunkSize > 0 {
+		chunkSize = opts.ChunkSize
+	}
 
 	if opts.Version {
 		fmt.Println(version)
 		os.Exit(exitOk)
 	}
 
+	// Start the finder in a tmux popup, which runs fzf again without --tmux
+	if opts.Tmux != nil && opts.Filter == nil && len(os.Getenv("TMUX")) > 0 {
+		os.Exit(runTmux(os.Args[1:], opts.Tmux))
+	}
+
 	// Event channel
 	eventBox := util.NewEventBox()
 
+	// Typed subscriptions to the events for the code outside of the event
+	// loop, including the programs using fzf as a library. The subscriptions
+	// are made before the reader starts so that no event is missed.
+	bus := NewEventBus(eventBox)
+	readerDone := bus.ReaderDone()
+	if opts.Subscribe != nil {
+		opts.Subscribe(bus)
+	}
+
 	// ANSI code processor
 	ansiProcessor := func(data []byte) ([]rune, []ansiOffset) {
 		return util.BytesToRunes(data), nil
@@ -91,10 +115,10 @@ func Run(opts *Options) {
 	}
 
 	// Chunk list
-	var chunkList *ChunkList
+	var itemBuilder ItemBuilder
 	header := make([]string, 0, opts.HeaderLines)
 	if len(opts.WithNth) == 0 {
-		chunkList = NewChunkList(func(data []byte, index int) *Item {
+		itemBuilder = func(data []byte, index int) *Item {
 			if len(header) < opts.HeaderLines {
 				header = append(header, string(data))
 				eventBox.Set(EvtHeader, header)
@@ -105,9 +129,9 @@ func Run(opts *Options) {
 				text:   runes,
 				colors: colors,
 				rank:   buildEmptyRank(int32(index))}
-		})
+		}
 	} else {
-		chunkList = NewChunkList(func(data []byte, index int) *Item {
+		itemBuilder = func(data []byte, index int) *Item {
 			runes := util.BytesToRunes(data)
 			tokens := Tokenize(runes, opts.Delimiter)
 			trans := Transform(tokens, opts.WithNth)
@@ -126,16 +150,70 @@ func Run(opts *Options) {
 			item.text = trimmed
 			item.colors = colors
 			return &item
-		})
+		}
+	}
+	newChunkList := func() *ChunkList {
+		builder := itemBuilder
+		if opts.Transform != nil {
+			builder = transformItemBuilder(builder, opts.Transform)
+		}
+		if opts.Payload != nil {
+			builder = payloadItemBuilder(builder, opts.Payload)
+		}
+		if opts.Unique {
+			builder = uniqueItemBuilder(builder)
+		} else if opts.Intern {
+			builder = internItemBuilder(builder)
+		}
+		if opts.BoostAccepted != nil {
+			builder = boostItemBuilder(builder, opts.BoostAccepted.entries(), opts.Ansi)
+		}
+		list := NewChunkList(builder)
+		list.tail = opts.Tail
+		return list
 	}
+	chunkList := newChunkList()
 
 	// Reader
+	revision := 0
+	// The readers of the current list, including the ones appending to it
+	var readers []*Reader
+	startReader := func(chunkList *ChunkList, command string, env []string, appended bool) {
+		reader := &Reader{
+			pusher: func(data []byte) bool {
+				return chunkList.Push(data)
+			},
+			eventBox: eventBox,
+			delimNil: opts.ReadZero,
+			revision: revision,
+			sources:  opts.Sources,
+			walker:   opts.Walker,
+			command:  command,
+			follow:   opts.Follow,
+			files:    opts.Files,
+			inflate:  opts.Decompress,
+			appended: appended,
+			env:      env}
+		readers = append(readers, reader)
+		go reader.ReadSource()
+	}
+	// readError returns the error that stopped any of the readers
+	readError := func() error {
+		for _, reader := range readers {
+			if err := reader.failure(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// The command of --command starts with the initial query
+	query := opts.Query
+	if opts.Filter != nil {
+		query = *opts.Filter
+	}
 	streamingFilter := opts.Filter != nil && !sort && !opts.Tac && !opts.Sync
 	if !streamingFilter {
-		reader := Reader{func(data []byte) bool {
-			return chunkList.Push(data)
-		}, eventBox, opts.ReadZero}
-		go reader.ReadSource()
+		startReader(chunkList, opts.Command, commandEnviron(query, 0, 0, 0, 0), false)
 	}
 
 	// Matcher
@@ -154,51 +232,113 @@ func Run(opts *Options) {
 			opts.Fuzzy, opts.Extended, opts.Case, forward,
 			opts.Nth, opts.Delimiter, runes)
 	}
-	matcher := NewMatcher(patternBuilder, sort, opts.Tac, eventBox)
+	if opts.Tail > 0 {
+		// The stored results refer to the items by their positions in the
+		// list, which shift as the oldest items are discarded
+		opts.ResultCache = nil
+	}
+	if opts.ResultCache != nil {
+		// The stored results are only valid for the same search options
+		opts.ResultCache.signature = fmt.Sprintf("%v %v %v %v %q %v %v %v",
+			opts.Fuzzy, opts.Extended, opts.Case, opts.Nth, opts.Delimiter.String(),
+			opts.Criteria, opts.Tac, opts.MaxMatches)
+		if opts.BoostAccepted != nil {
+			// The order changes as more items are accepted
+			opts.ResultCache.signature += fmt.Sprintf(" %d", len(opts.BoostAccepted.lines))
+		}
+	}
+	matcher := NewMatcher(patternBuilder, sort, opts.Tac, opts.MaxMatches,
+		opts.Index, opts.ResultCache, eventBox)
+	matcher.SetThrottle(opts.Throttle)
+
+	// Write the performance metrics of the matcher before exiting
+	exit := func(code int) {
+		if opts.ResultCache != nil {
+			opts.ResultCache.flush()
+		}
+		if len(opts.StatsFile) > 0 {
+			ioutil.WriteFile(opts.StatsFile, []byte(matcher.Stats().String()+"\n"), 0600)
+		}
+		os.Exit(code)
+	}
+
+	printLine := linePrinter(opts.PrintZero)
 
 	// Filtering mode
 	if opts.Filter != nil {
 		if opts.PrintQuery {
-			fmt.Println(*opts.Filter)
+			printLine(*opts.Filter)
 		}
 
 		pattern := patternBuilder([]rune(*opts.Filter))
 
-		found := false
+		found := 0
 		if streamingFilter {
-			reader := Reader{
-				func(runes []byte) bool {
+			// The walker and the sources push the lines concurrently
+			var mutex sync.Mutex
+			var reader *Reader
+			reader = &Reader{
+				pusher: func(runes []byte) bool {
+					mutex.Lock()
+					defer mutex.Unlock()
+					if opts.MaxMatches > 0 && found >= opts.MaxMatches {
+						return false
+					}
 					item := chunkList.trans(runes, 0)
 					if item != nil && pattern.MatchItem(item) {
-						fmt.Println(string(item.text))
-						found = true
+						printLine(item.AsString(opts.Ansi))
+						found++
+						if found == opts.MaxMatches {
+							// No need to read the rest of the input
+							reader.terminate()
+						}
 					}
 					return false
-				}, eventBox, opts.ReadZero}
+				},
+				eventBox: eventBox,
+				delimNil: opts.ReadZero,
+				revision: revision,
+				sources:  opts.Sources,
+				walker:   opts.Walker,
+				command:  opts.Command,
+				follow:   opts.Follow,
+				files:    opts.Files,
+				inflate:  opts.Decompress,
+				env:      commandEnviron(query, 0, 0, 0, 0)}
 			reader.ReadSource()
+			if err := reader.failure(); err != nil {
+				errorExit(err.Error())
+			}
 		} else {
 			eventBox.Unwatch(EvtReadNew)
-			eventBox.WaitFor(EvtReadFin)
+			<-readerDone
+			if err := readError(); err != nil {
+				errorExit(err.Error())
+			}
 
 			snapshot, _ := chunkList.Snapshot()
 			merger, _ := matcher.scan(MatchRequest{
 				chunks:  snapshot,
-				pattern: pattern})
-			for i := 0; i < merger.Length(); i++ {
-				fmt.Println(merger.Get(i).AsString(opts.Ansi))
-				found = true
+				pattern: pattern,
+				final:   true})
+			found = merger.Length()
+			for i := 0; i < found; i++ {
+				printLine(merger.Get(i).AsString(opts.Ansi))
 			}
 		}
-		if found {
-			os.Exit(exitOk)
+		if found > 0 {
+			exit(exitOk)
 		}
-		os.Exit(exitNoMatch)
+		exit(exitNoMatch)
 	}
 
 	// Synchronous search
 	if opts.Sync {
 		eventBox.Unwatch(EvtReadNew)
-		eventBox.WaitFor(EvtReadFin)
+		<-readerDone
+		if err := readError(); err != nil {
+			errorExit(err.Error())
+		}
 	}
 
 	// Go interactive
@@ -206,6 +346,12 @@ func Run(opts *Options) {
 
 	// Terminal I/O
 	terminal := NewTerminal(opts, eventBox)
+	terminal.exit = exit
+	terminal.newPattern = func(runes []rune) *Pattern {
+		// Built without the cache shared with the matcher goroutine
+		return buildPattern(opts.Fuzzy, opts.Extended, opts.Case, forward,
+			nil, opts.Delimiter, patternString(opts.Extended, runes))
+	}
 	deferred := opts.Select1 || opts.Exit0
 	go terminal.Loop()
 	if !deferred {
@@ -214,21 +360,99 @@ func Run(opts *Options) {
 
 	// Event coordination
 	reading := true
+	reloaded := false
+	// The list being read by reload-sync, which replaces the current one when
+	// the command is complete
+	var pending *ChunkList
 	ticks := 0
 	eventBox.Watch(EvtReadNew)
+	eventBox.Unwatch(EvtQueryChange)
 	for {
 		delay := true
 		ticks++
+		waitStart := time.Now()
 		eventBox.Wait(func(events *util.Events) {
 			defer events.Clear()
 			for evt, value := range *events {
 				switch evt {
 
 				case EvtReadNew, EvtReadFin:
-					reading = reading && evt == EvtReadNew
+					// Ignore the completion of the reader for the previous list
+					fin := evt == EvtReadFin && value.(int) == revision
+					if pending != nil {
+						if !fin {
+							break
+						}
+						chunkList.evictCache()
+						chunkList = pending
+						pending = nil
+						terminal.DetachSelection()
+					}
+					reading = reading && !fin
+					if fin {
+						if err := readError(); err != nil {
+							terminal.Fail(err)
+						}
+					}
 					snapshot, count := chunkList.Snapshot()
 					terminal.UpdateCount(count, !reading)
-					matcher.Reset(snapshot, terminal.Input(), false, !reading, sort)
+					matcher.Reset(snapshot, terminal.Input(), false, !reading, sort, revision)
+					if fin && reloaded {
+						reloaded = false
+						terminal.ReattachSelection(snapshot)
+					}
+
+				case EvtReload:
+					request := value.(reloadRequest)
+					// Without a command, items can only be read again from
+					// the command of --command, the files, or the default
+					// command
+					if len(request.command) == 0 {
+						request.command = opts.Command
+					}
+					if len(request.command) == 0 && len(opts.Follow) == 0 &&
+						len(opts.Files) == 0 && !util.IsTty() {
+						break
+					}
+					if request.append {
+						// The output of the command is appended to the list
+						// without the end of it being reported
+						startReader(chunkList, request.command, request.env, true)
+						break
+					}
+					for _, reader := range readers {
+						reader.terminate()
+					}
+					readers = nil
+					if pending != nil {
+						pending.evictCache()
+					}
+					// Replace the list instead of clearing it as the terminal
+					// may still be displaying the items in the old one
+					revision++
+					reading = true
+					reloaded = true
+					if request.sync {
+						pending = newChunkList()
+						startReader(pending, request.command, request.env, false)
+						_, count := chunkList.Snapshot()
+						terminal.UpdateCount(count, false)
+						break
+					}
+					pending = nil
+					chunkList.evictCache()
+					chunkList = newChunkList()
+					terminal.DetachSelection()
+					startReader(chunkList, request.command, request.env, false)
+					snapshot, count := chunkList.Snapshot()
+					terminal.UpdateCount(count, false)
+					matcher.Reset(snapshot, terminal.Input(), true, false, sort, revision)
+
+				case EvtThrottle:
+					switch val := value.(type) {
+					case int:
+						matcher.SetThrottle(val)
+					}
 
 				case EvtSearchNew:
 					switch val := value.(type) {
@@ -236,15 +460,21 @@ func Run(opts *Options) {
 						sort = val
 					}
 					snapshot, _ := chunkList.Snapshot()
-					matcher.Reset(snapshot, terminal.Input(), true, !reading, sort)
+					matcher.Reset(snapshot, terminal.Input(), true, !reading, sort, revision)
 					delay = false
 
 				case EvtSearchProgress:
 					switch val := value.(type) {
-					case float32:
+					case SearchStatus:
 						terminal.UpdateProgress(val)
 					}
 
+				case EvtSearchPartial:
+					// Ignore the partial result if the search is already complete
+					if _, fin := (*events)[EvtSearchFin]; !fin && !deferred {
+						terminal.UpdatePartialList(value.(*Merger))
+					}
+
 				case EvtHeader:
 					terminal.UpdateHeader(value.([]string))
 
@@ -259,18 +489,18 @@ func Run(opts *Options) {
 							} else if val.final {
 								if opts.Exit0 && count == 0 || opts.Select1 && count == 1 {
 									if opts.PrintQuery {
-										fmt.Println(opts.Query)
+										printLine(opts.Query)
 									}
 									if len(opts.Expect) > 0 {
-										fmt.Println()
+										printLine("")
 									}
 									for i := 0; i < count; i++ {
-										fmt.Println(val.Get(i).AsString(opts.Ansi))
+										printLine(val.Get(i).AsString(opts.Ansi))
 									}
 									if count > 0 {
-										os.Exit(exitOk)
+										exit(exitOk)
 									}
-									os.Exit(exitNoMatch)
+									exit(exitNoMatch)
 								}
 								deferred = false
 								terminal.startChan <- true
@@ -281,6 +511,11 @@ func Run(opts *Options) {
 				}
 			}
 		})
+		if time.Since(waitStart) > coordinatorDelayStep {
+			// The items read after a pause in the input are searched without
+			// delay, which only grows while the items keep arriving
+			ticks = 0
+		}
 		if delay && reading {
 			dur := util.DurWithin(
 				time.Duration(ticks)*coordinatorDelayStep,
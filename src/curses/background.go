@@ -0,0 +1,70 @@
+package curses
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"syscall"
+)
+
+var (
+	bgColorRegex = regexp.MustCompile(
+		`\x1b\]11;rgb:([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})(\x07|\x1b\\)?`)
+	deviceAttrRegex = regexp.MustCompile(`\x1b\[\?[0-9;]*c`)
+)
+
+// IsLightBackground queries the background color of the terminal with OSC 11
+// escape sequence, and tells if it is light. ok is false if the terminal
+// doesn't report the color. The query is followed by the request for the
+// device attributes, to which every terminal responds, so that we don't have
+// to wait for the timeout when OSC 11 is not supported.
+func IsLightBackground() (light bool, ok bool) {
+	tty, err := os.OpenFile("/dev/tty", syscall.O_RDWR, 0)
+	if err != nil {
+		return false, false
+	}
+	defer tty.Close()
+	state := sttyFor(tty, "-g")
+	if len(state) == 0 {
+		return false, false
+	}
+	defer sttyFor(tty, state)
+	// Read times out after 0.2 seconds
+	sttyFor(tty, "raw", "-echo", "min", "0", "time", "2")
+
+	tty.WriteString("\x1b]11;?\x07\x1b[c")
+	// Fd puts the file in blocking mode so that the timeout works
+	fd := int(tty.Fd())
+	response := []byte{}
+	buf := make([]byte, 64)
+	for len(response) < 1024 && !deviceAttrRegex.Match(response) {
+		n, err := syscall.Read(fd, buf)
+		if n <= 0 || err != nil {
+			break
+		}
+		response = append(response, buf[:n]...)
+	}
+	light, ok = parseBackground(response)
+
+	// The keys typed before the responses are read later
+	response = bgColorRegex.ReplaceAll(response, nil)
+	_buf = append(_buf, deviceAttrRegex.ReplaceAll(response, nil)...)
+	return light, ok
+}
+
+// parseBackground parses the response to OSC 11 query and tells if the color
+// is light by its luma
+func parseBackground(response []byte) (light bool, ok bool) {
+	match := bgColorRegex.FindSubmatch(response)
+	if match == nil {
+		return false, false
+	}
+	luma := 0.0
+	for idx, weight := range []float64{0.299, 0.587, 0.114} {
+		hex := string(match[idx+1])
+		num, _ := strconv.ParseUint(hex, 16, 16)
+		max := uint64(1)<<(4*uint(len(hex))) - 1
+		luma += weight * float64(num) / float64(max)
+	}
+	return luma > 0.5, true
+}
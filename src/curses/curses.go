@@ -3,6 +3,7 @@ package curses
 /*
 #include <ncurses.h>
 #include <locale.h>
+#include <poll.h>
 #cgo !static LDFLAGS: -lncurses
 #cgo static LDFLAGS: -l:libncursesw.a -l:libtinfo.a -l:libgpm.a -ldl
 #cgo android static LDFLAGS: -l:libncurses.a -fPIE -march=armv7-a -mfpu=neon -mhard-float -Wl,--no-warn-mismatch
@@ -11,16 +12,28 @@ SCREEN *c_newterm () {
 	return newterm(NULL, stderr, stdin);
 }
 
+void c_redrawln (int y, int n) {
+	wredrawln(stdscr, y, n);
+}
+
+int c_poll_input (int fd, int timeout) {
+	struct pollfd pfd = { fd, POLLIN, 0 };
+	return poll(&pfd, 1, timeout) > 0;
+}
+
 */
 import "C"
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"strings"
 	"syscall"
 	"time"
 	"unicode/utf8"
+	"unsafe"
 )
 
 // Types of user action
@@ -58,6 +71,20 @@ const (
 	Invalid
 	Mouse
 	DoubleClick
+	Click
+	ClickHeader
+	DoubleClickHeader
+	ClickBorder
+	DoubleClickBorder
+	Paste
+
+	// Events that are not from the keyboard
+	Change
+	Focus
+	Load
+	Resize
+	One
+	Zero
 
 	BTab
 	BSpace
@@ -104,6 +131,12 @@ const (
 	ColCursor
 	ColSelected
 	ColHeader
+	ColBorder
+	ColNth
+	ColDim
+	ColCurrentDim
+	ColAnnotation
+	ColCurrentAnnotation
 	ColUser
 )
 
@@ -125,6 +158,10 @@ type ColorTheme struct {
 	Cursor       int16
 	Selected     int16
 	Header       int16
+	Border       int16
+	Nth          int16
+	Dim          int16
+	Annotation   int16
 }
 
 type Event struct {
@@ -150,6 +187,9 @@ var (
 	_prevDownTime time.Time
 	_clickY       []int
 	_screen       *C.SCREEN
+	_graphics     []string
+	_kitty        bool
+	_pasted       string
 	Default16     *ColorTheme
 	Dark256       *ColorTheme
 	Light256      *ColorTheme
@@ -176,7 +216,11 @@ func init() {
 		Info:         C.COLOR_WHITE,
 		Cursor:       C.COLOR_RED,
 		Selected:     C.COLOR_MAGENTA,
-		Header:       C.COLOR_CYAN}
+		Header:       C.COLOR_CYAN,
+		Border:       C.COLOR_WHITE,
+		Nth:          15,
+		Dim:          C.COLOR_WHITE,
+		Annotation:   C.COLOR_CYAN}
 	Dark256 = &ColorTheme{
 		UseDefault:   true,
 		Fg:           15,
@@ -190,7 +234,11 @@ func init() {
 		Info:         144,
 		Cursor:       161,
 		Selected:     168,
-		Header:       109}
+		Header:       109,
+		Border:       59,
+		Nth:          252,
+		Dim:          243,
+		Annotation:   180}
 	Light256 = &ColorTheme{
 		UseDefault:   true,
 		Fg:           15,
@@ -204,7 +252,11 @@ func init() {
 		Info:         101,
 		Cursor:       161,
 		Selected:     168,
-		Header:       31}
+		Header:       31,
+		Border:       145,
+		Nth:          235,
+		Dim:          248,
+		Annotation:   95}
 }
 
 func attrColored(pair int, bold bool) C.int {
@@ -229,6 +281,17 @@ func attrMono(pair int, bold bool) C.int {
 		attr = C.A_UNDERLINE
 	case ColCurrentMatch:
 		attr = C.A_UNDERLINE | C.A_REVERSE
+	case ColDim:
+		attr = C.A_DIM
+	case ColCurrentDim:
+		attr = C.A_DIM
+		if bold {
+			attr = attr | C.A_REVERSE
+		}
+	case ColCurrentAnnotation:
+		if bold {
+			attr = C.A_REVERSE
+		}
 	}
 	if bold {
 		attr = attr | C.A_BOLD
@@ -236,11 +299,22 @@ func attrMono(pair int, bold bool) C.int {
 	return attr
 }
 
+// attrPlain returns no attributes so that the text is printed as it is
+func attrPlain(pair int, bold bool) C.int {
+	return 0
+}
+
 func MaxX() int {
+	if _light != nil {
+		return _light.width
+	}
 	return int(C.COLS)
 }
 
 func MaxY() int {
+	if _light != nil {
+		return _light.lines
+	}
 	return int(C.LINES)
 }
 
@@ -254,16 +328,10 @@ func getch(nonblock bool) int {
 	return int(b[0])
 }
 
-func Init(theme *ColorTheme, black bool, mouse bool) {
-	{
-		in, err := os.OpenFile("/dev/tty", syscall.O_RDONLY, 0)
-		if err != nil {
-			panic("Failed to open /dev/tty")
-		}
-		_in = in
-		// Break STDIN
-		// syscall.Dup2(int(in.Fd()), int(os.Stdin.Fd()))
-	}
+func Init(theme *ColorTheme, black bool, plain bool, mouse bool) {
+	_in = openTty()
+	// Break STDIN
+	// syscall.Dup2(int(_in.Fd()), int(os.Stdin.Fd()))
 
 	C.setlocale(C.LC_ALL, C.CString(""))
 	_screen = C.c_newterm()
@@ -272,13 +340,16 @@ func Init(theme *ColorTheme, black bool, mouse bool) {
 		os.Exit(2)
 	}
 	C.set_term(_screen)
+	os.Stderr.WriteString(bracketedPasteOn)
 	if mouse {
 		C.mousemask(C.ALL_MOUSE_EVENTS, nil)
 	}
 	C.noecho()
 	C.raw() // stty dsusp undef
 
-	if theme != nil {
+	if plain {
+		_color = attrPlain
+	} else if theme != nil {
 		C.start_color()
 		initPairs(theme, black)
 		_color = attrColored
@@ -287,15 +358,16 @@ func Init(theme *ColorTheme, black bool, mouse bool) {
 	}
 }
 
-func initPairs(theme *ColorTheme, black bool) {
-	fg := C.short(theme.Fg)
-	bg := C.short(theme.Bg)
+// themeColors sets the default colors of the theme and returns the
+// foreground and background colors of each pair
+func themeColors(theme *ColorTheme, black bool) map[int][2]int16 {
+	fg := theme.Fg
+	bg := theme.Bg
 	if black {
 		bg = C.COLOR_BLACK
 	} else if theme.UseDefault {
 		fg = -1
 		bg = -1
-		C.use_default_colors()
 	}
 	if theme.UseDefault {
 		FG = -1
@@ -303,24 +375,53 @@ func initPairs(theme *ColorTheme, black bool) {
 	} else {
 		FG = int(fg)
 		BG = int(bg)
-		C.assume_default_colors(C.int(theme.Fg), C.int(bg))
 	}
 
 	CurrentFG = int(theme.Current)
 	DarkBG = int(theme.DarkBg)
-	darkBG := C.short(DarkBG)
-	C.init_pair(ColPrompt, C.short(theme.Prompt), bg)
-	C.init_pair(ColMatch, C.short(theme.Match), bg)
-	C.init_pair(ColCurrent, C.short(theme.Current), darkBG)
-	C.init_pair(ColCurrentMatch, C.short(theme.CurrentMatch), darkBG)
-	C.init_pair(ColSpinner, C.short(theme.Spinner), bg)
-	C.init_pair(ColInfo, C.short(theme.Info), bg)
-	C.init_pair(ColCursor, C.short(theme.Cursor), darkBG)
-	C.init_pair(ColSelected, C.short(theme.Selected), darkBG)
-	C.init_pair(ColHeader, C.short(theme.Header), bg)
+	darkBG := theme.DarkBg
+	return map[int][2]int16{
+		ColNormal:       {fg, bg},
+		ColPrompt:       {theme.Prompt, bg},
+		ColMatch:        {theme.Match, bg},
+		ColCurrent:      {theme.Current, darkBG},
+		ColCurrentMatch: {theme.CurrentMatch, darkBG},
+		ColSpinner:      {theme.Spinner, bg},
+		ColInfo:         {theme.Info, bg},
+		ColCursor:       {theme.Cursor, darkBG},
+		ColSelected:     {theme.Selected, darkBG},
+		ColHeader:       {theme.Header, bg},
+		ColBorder:       {theme.Border, bg},
+		ColNth:          {theme.Nth, bg},
+		ColDim:          {theme.Dim, bg},
+		ColCurrentDim:   {theme.Dim, darkBG},
+
+		// The last field of the item displayed with --annotation
+		ColAnnotation:        {theme.Annotation, bg},
+		ColCurrentAnnotation: {theme.Annotation, darkBG}}
+}
+
+func initPairs(theme *ColorTheme, black bool) {
+	pairs := themeColors(theme, black)
+	if !black && theme.UseDefault {
+		C.use_default_colors()
+	}
+	if !theme.UseDefault {
+		C.assume_default_colors(C.int(theme.Fg), C.int(pairs[ColNormal][1]))
+	}
+	for pair, colors := range pairs {
+		if pair > ColNormal {
+			C.init_pair(C.short(pair), C.short(colors[0]), C.short(colors[1]))
+		}
+	}
 }
 
 func Close() {
+	if _light != nil {
+		_light.close()
+		return
+	}
+	os.Stderr.WriteString(deleteKitty() + bracketedPasteOff)
 	C.endwin()
 	C.delscreen(_screen)
 }
@@ -328,16 +429,76 @@ func Close() {
 func GetBytes() []byte {
 	c := getch(false)
 	_buf = append(_buf, byte(c))
+	readPending()
+	return _buf
+}
+
+// WaitForInput blocks until there is a key to read without reading it
+func WaitForInput() {
+	for len(_buf) == 0 && C.c_poll_input(C.int(_in.Fd()), -1) == 0 {
+	}
+}
+
+// HasInput tells if GetChar can return a key without waiting for the input
+func HasInput() bool {
+	return len(_buf) > 0 || C.c_poll_input(C.int(_in.Fd()), 0) != 0
+}
 
+// readPending appends the bytes available on the terminal to the buffer
+// without blocking
+func readPending() {
 	for {
-		c = getch(true)
+		c := getch(true)
 		if c == -1 {
 			break
 		}
 		_buf = append(_buf, byte(c))
 	}
+}
 
-	return _buf
+// waitForRune waits a short while for the rest of the multi-byte character at
+// the beginning of the buffer when it is split across the reads, e.g. by an
+// input method writing the bytes separately
+func waitForRune() {
+	for tries := 0; !utf8.FullRune(_buf) && tries < 10; tries++ {
+		time.Sleep(10 * time.Millisecond)
+		readPending()
+	}
+}
+
+// The escape sequences enclosing the text pasted in bracketed paste mode
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// The escape sequences to turn bracketed paste mode on and off
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+)
+
+// pasteSequence reads the text pasted in bracketed paste mode, which can be
+// split across the reads, up to the end of the sequence
+func pasteSequence(sz *int) Event {
+	for !bytes.Contains(_buf, []byte(pasteEnd)) {
+		c := getch(false)
+		if c < 0 {
+			*sz = len(_buf)
+			return Event{Invalid, 0, nil}
+		}
+		_buf = append(_buf, byte(c))
+		readPending()
+	}
+	end := bytes.Index(_buf, []byte(pasteEnd))
+	_pasted = string(_buf[len(pasteStart):end])
+	*sz = end + len(pasteEnd)
+	return Event{Paste, 0, nil}
+}
+
+// PastedText returns the text of the last Paste event
+func PastedText() string {
+	return _pasted
 }
 
 // 27 (91 79) 77 type x y
@@ -373,7 +534,9 @@ func mouseSequence(sz *int) Event {
 		97, 101, 105, 113: // scroll-down / shift / cmd / ctrl
 		mod := _buf[3] >= 100
 		s := 1 - int(_buf[3]%2)*2
-		return Event{Mouse, 0, &MouseEvent{0, 0, s, false, false, mod}}
+		x := int(_buf[4] - 33)
+		y := int(_buf[5] - 33)
+		return Event{Mouse, 0, &MouseEvent{y, x, s, false, false, mod}}
 	}
 	return Event{Invalid, 0, nil}
 }
@@ -496,6 +659,9 @@ func GetChar() Event {
 	case 127:
 		return Event{BSpace, 0, nil}
 	case ESC:
+		if bytes.HasPrefix(_buf, []byte(pasteStart)) {
+			return pasteSequence(&sz)
+		}
 		return escSequence(&sz)
 	}
 
@@ -503,33 +669,56 @@ func GetChar() Event {
 	if _buf[0] <= CtrlZ {
 		return Event{int(_buf[0]), 0, nil}
 	}
+	waitForRune()
 	r, rsz := utf8.DecodeRune(_buf)
 	if r == utf8.RuneError {
-		return Event{ESC, 0, nil}
+		// The invalid byte is discarded instead of being taken as ESC, which
+		// would abort fzf
+		return Event{Invalid, 0, nil}
 	}
 	sz = rsz
 	return Event{Rune, r, nil}
 }
 
 func Move(y int, x int) {
+	if _light != nil {
+		_light.move(y, x)
+		return
+	}
 	C.move(C.int(y), C.int(x))
 }
 
 func MoveAndClear(y int, x int) {
 	Move(y, x)
+	if _light != nil {
+		_light.csi("K")
+		return
+	}
 	C.clrtoeol()
 }
 
-func Print(text string) {
-	C.addstr(C.CString(strings.Map(func(r rune) rune {
+func printable(text string) string {
+	return strings.Map(func(r rune) rune {
 		if r < 32 {
 			return -1
 		}
 		return r
-	}, text)))
+	}, text)
+}
+
+func Print(text string) {
+	if _light != nil {
+		_light.buf.WriteString(printable(text))
+		return
+	}
+	C.addstr(C.CString(printable(text)))
 }
 
 func CPrint(pair int, bold bool, text string) {
+	if _light != nil {
+		_light.print(pair, bold, printable(text))
+		return
+	}
 	attr := _color(pair, bold)
 	C.attron(attr)
 	Print(text)
@@ -537,15 +726,120 @@ func CPrint(pair int, bold bool, text string) {
 }
 
 func Clear() {
+	if _light != nil {
+		_light.clear()
+		return
+	}
 	C.clear()
 }
 
 func Endwin() {
+	if _light != nil {
+		_light.buf.WriteString(deleteKitty())
+		_light.pause()
+		return
+	}
+	os.Stderr.WriteString(deleteKitty() + bracketedPasteOff)
 	C.endwin()
 }
 
+// Bell rings the bell of the terminal
+func Bell() {
+	if _light != nil {
+		_light.buf.WriteString("\a")
+		return
+	}
+	C.beep()
+}
+
 func Refresh() {
+	if _light != nil {
+		if _light.paused {
+			_light.resume()
+		}
+		_light.flush()
+		return
+	}
+	resumed := bool(C.isendwin())
 	C.refresh()
+	if resumed {
+		os.Stderr.WriteString(bracketedPasteOn)
+	}
+	if len(_graphics) > 0 {
+		os.Stderr.WriteString(strings.Join(_graphics, ""))
+		_graphics = nil
+	}
+}
+
+// SetClipboard copies the text to the system clipboard with OSC 52 escape
+// sequence, which is handled by the terminal emulator and therefore also works
+// over SSH. The sequence is written directly as it doesn't change the screen.
+func SetClipboard(text string) {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x07"
+	if _light != nil {
+		_light.out.WriteString(seq)
+		return
+	}
+	os.Stderr.WriteString(seq)
+}
+
+// Incremental tells if only the changed part of the screen is written to the
+// terminal on refresh. The light renderer writes the lines as they are
+// printed, which also erases the images on them.
+func Incremental() bool {
+	return _light == nil
+}
+
+// DrawGraphics draws the image of the escape sequence of a terminal graphics
+// protocol at the position. ncurses doesn't know about the image, so the
+// sequence is written directly to the terminal after the screen is refreshed.
+// The cursor is saved and restored around it as the image moves the cursor.
+func DrawGraphics(y int, x int, seq string) {
+	_kitty = _kitty || strings.HasPrefix(seq, "\x1b_G")
+	if _light != nil {
+		prev := _light.y
+		_light.buf.WriteString("\x1b7")
+		_light.move(y, x)
+		_light.buf.WriteString(seq + "\x1b8")
+		_light.y = prev
+		return
+	}
+	_graphics = append(_graphics, fmt.Sprintf("\x1b7\x1b[%d;%dH%s\x1b8", y+1, x+1, seq))
+}
+
+// ClearGraphics removes the images drawn on the lines. Images of kitty
+// graphics protocol are deleted, and the lines are redrawn on the next refresh
+// so that the text overwrites the other images. The light renderer redraws
+// the lines anyway.
+func ClearGraphics(y int, height int) {
+	if _light != nil {
+		_light.buf.WriteString(deleteKitty())
+		return
+	}
+	_graphics = append(_graphics, deleteKitty())
+	C.c_redrawln(C.int(y), C.int(height))
+}
+
+// deleteKitty returns the sequence to delete the images of kitty graphics
+// protocol if there are any on the screen
+func deleteKitty() string {
+	if !_kitty {
+		return ""
+	}
+	_kitty = false
+	return "\x1b_Ga=d\x1b\\"
+}
+
+// CellHeight returns the height of a character cell in pixels, or 0 if the
+// terminal doesn't report the size of the screen in pixels
+func CellHeight() int {
+	var size struct{ rows, cols, width, height uint16 }
+	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, _in.Fd(),
+		syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size)))
+	if err != 0 || size.rows == 0 {
+		return 0
+	}
+	return int(size.height / size.rows)
 }
 
 func PairFor(fg int, bg int) int {
@@ -555,7 +849,11 @@ func PairFor(fg int, bg int) int {
 	}
 
 	id := len(_colorMap) + ColUser
-	C.init_pair(C.short(id), C.short(fg), C.short(bg))
+	if _light != nil {
+		_light.pairs[id] = [2]int{fg, bg}
+	} else {
+		C.init_pair(C.short(id), C.short(fg), C.short(bg))
+	}
 	_colorMap[key] = id
 	return id
 }
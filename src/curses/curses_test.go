@@ -12,3 +12,31 @@ func TestPairFor(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestColorCode(t *testing.T) {
+	check := func(color int, base int, expected string) {
+		if code := colorCode(color, base); code != expected {
+			t.Errorf("%d, %d: %s != %s", color, base, code, expected)
+		}
+	}
+	check(-1, 30, "39")
+	check(1, 30, "31")
+	check(9, 30, "91")
+	check(236, 40, "48;5;236")
+}
+
+func TestParseBackground(t *testing.T) {
+	check := func(response string, light bool, ok bool) {
+		if l, o := parseBackground([]byte(response)); l != light || o != ok {
+			t.Errorf("%q: %v %v", response, l, o)
+		}
+	}
+	check("\x1b]11;rgb:ffff/ffff/ffff\x07\x1b[?62;22c", true, true)
+	check("\x1b]11;rgb:0000/0000/0000\x1b\\\x1b[?1;2c", false, true)
+	check("\x1b]11;rgb:fd/f6/e3\x07", true, true)
+	check("\x1b]11;rgb:2/2/3\x07", false, true)
+	check("\x1b]11;rgb:2828/2c2c/3434\x07", false, true)
+	check("1\x1b]11;rgb:ffff/ffff/ffff\x07\x1b[?1;2c", true, true)
+	check("\x1b[?1;2c", false, false)
+	check("", false, false)
+}
@@ -0,0 +1,228 @@
+package curses
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lightRenderer draws on the lines below the cursor using ANSI escape
+// sequences instead of switching to the alternate screen with ncurses, so the
+// previous output of the terminal stays on the screen
+type lightRenderer struct {
+	height func(int) int
+	erase  bool
+	out    *os.File
+	buf    bytes.Buffer
+	pairs  map[int][2]int
+	mono   bool
+	plain  bool
+	state  string
+	paused bool
+	width  int
+	lines  int
+	y      int
+}
+
+var _light *lightRenderer
+
+// InitLight starts the light renderer. height takes the number of the lines
+// of the terminal and returns the number of the lines to use. The lines are
+// left on the screen on exit unless erase is set. No escape sequences for the
+// colors and the attributes are written if plain is set.
+func InitLight(theme *ColorTheme, black bool, plain bool, height func(int) int, erase bool) {
+	_in = openTty()
+	_light = &lightRenderer{
+		height: height,
+		erase:  erase,
+		out:    os.Stderr,
+		pairs:  make(map[int][2]int),
+		mono:   theme == nil,
+		plain:  plain}
+	if theme != nil {
+		for pair, colors := range themeColors(theme, black) {
+			_light.pairs[pair] = [2]int{int(colors[0]), int(colors[1])}
+		}
+	}
+	_light.resume()
+}
+
+func stty(args ...string) string {
+	return sttyFor(_in, args...)
+}
+
+// sttyFor runs stty for the terminal and returns its output
+func sttyFor(tty *os.File, args ...string) string {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, _ := cmd.Output()
+	return strings.TrimSpace(string(out))
+}
+
+func (r *lightRenderer) updateSize() {
+	rows, cols := 24, 80
+	size := strings.Fields(stty("size"))
+	if len(size) == 2 {
+		if num, err := strconv.Atoi(size[0]); err == nil && num > 0 {
+			rows = num
+		}
+		if num, err := strconv.Atoi(size[1]); err == nil && num > 0 {
+			cols = num
+		}
+	}
+	r.width = cols
+	r.lines = r.height(rows)
+	if r.lines > rows {
+		r.lines = rows
+	}
+	if r.lines < 1 {
+		r.lines = 1
+	}
+}
+
+// resume takes the lines below the cursor, scrolling up the screen if there
+// is not enough space
+func (r *lightRenderer) resume() {
+	r.state = stty("-g")
+	stty("raw", "-echo")
+	r.updateSize()
+	r.paused = false
+	r.buf.WriteString(bracketedPasteOn + "\r" + strings.Repeat("\n", r.lines-1))
+	if r.lines > 1 {
+		r.csi(fmt.Sprintf("%dA", r.lines-1))
+	}
+	r.y = 0
+	r.flush()
+}
+
+// pause clears the lines and restores the terminal settings. The cursor is
+// left on the first line.
+func (r *lightRenderer) pause() {
+	if r.paused {
+		return
+	}
+	r.clear()
+	r.csi("m")
+	r.buf.WriteString(bracketedPasteOff)
+	r.flush()
+	if len(r.state) > 0 {
+		stty(r.state)
+	}
+	r.paused = true
+}
+
+// close restores the terminal settings. Unless erase is set, the lines are
+// left as they are, and the cursor is moved to the line below them.
+func (r *lightRenderer) close() {
+	if r.erase || r.paused {
+		r.buf.WriteString(deleteKitty())
+		r.pause()
+		return
+	}
+	r.move(r.lines-1, 0)
+	r.csi("m")
+	r.buf.WriteString(bracketedPasteOff + "\n")
+	r.flush()
+	if len(r.state) > 0 {
+		stty(r.state)
+	}
+	r.paused = true
+}
+
+func (r *lightRenderer) csi(code string) {
+	r.buf.WriteString("\x1b[" + code)
+}
+
+func (r *lightRenderer) flush() {
+	if r.buf.Len() > 0 {
+		r.out.Write(r.buf.Bytes())
+		r.buf.Reset()
+	}
+}
+
+func (r *lightRenderer) move(y int, x int) {
+	if y < r.y {
+		r.csi(fmt.Sprintf("%dA", r.y-y))
+	} else if y > r.y {
+		r.csi(fmt.Sprintf("%dB", y-r.y))
+	}
+	r.y = y
+	r.buf.WriteString("\r")
+	if x > 0 {
+		r.csi(fmt.Sprintf("%dC", x))
+	}
+}
+
+func (r *lightRenderer) clear() {
+	r.move(0, 0)
+	r.csi("J")
+}
+
+func (r *lightRenderer) print(pair int, bold bool, text string) {
+	if r.plain {
+		r.buf.WriteString(text)
+		return
+	}
+	r.csi(r.attr(pair, bold) + "m")
+	r.buf.WriteString(text)
+	r.csi("m")
+}
+
+func (r *lightRenderer) attr(pair int, bold bool) string {
+	codes := []string{}
+	if r.mono {
+		switch pair {
+		case ColCurrent:
+			if bold {
+				codes = append(codes, "7")
+			}
+		case ColMatch:
+			codes = append(codes, "4")
+		case ColCurrentMatch:
+			codes = append(codes, "4", "7")
+		case ColDim:
+			codes = append(codes, "2")
+		case ColCurrentDim:
+			codes = append(codes, "2")
+			if bold {
+				codes = append(codes, "7")
+			}
+		case ColCurrentAnnotation:
+			if bold {
+				codes = append(codes, "7")
+			}
+		}
+	} else if colors, found := r.pairs[pair]; found && pair > ColNormal {
+		codes = append(codes, colorCode(colors[0], 30), colorCode(colors[1], 40))
+	}
+	if bold {
+		codes = append(codes, "1")
+	}
+	return strings.Join(codes, ";")
+}
+
+// colorCode returns the SGR parameter for the color. base is 30 for the
+// foreground and 40 for the background.
+func colorCode(color int, base int) string {
+	switch {
+	case color < 0:
+		return strconv.Itoa(base + 9)
+	case color < 8:
+		return strconv.Itoa(base + color)
+	case color < 16:
+		return strconv.Itoa(base + 60 + color - 8)
+	}
+	return fmt.Sprintf("%d;5;%d", base+8, color)
+}
+
+func openTty() *os.File {
+	in, err := os.OpenFile("/dev/tty", syscall.O_RDONLY, 0)
+	if err != nil {
+		panic("Failed to open /dev/tty")
+	}
+	return in
+}
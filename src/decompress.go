@@ -0,0 +1,55 @@
+package fzf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os/exec"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// commandReader reads the output of the command, and waits for the command
+// on Close
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r commandReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// isCompressed tells if the data starts with the magic number of gzip or zstd
+func isCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic) || bytes.HasPrefix(data, zstdMagic)
+}
+
+// decompressReader returns the reader of the decompressed data if the input
+// starts with the magic number of gzip or zstd, or nil if it does not. There
+// is no zstd decoder in the standard library, so zstd data is decompressed by
+// the zstd command.
+func decompressReader(in *bufio.Reader) (io.ReadCloser, error) {
+	magic, _ := in.Peek(len(zstdMagic))
+	if bytes.HasPrefix(magic, gzipMagic) {
+		return gzip.NewReader(in)
+	}
+	if bytes.HasPrefix(magic, zstdMagic) {
+		cmd := exec.Command("zstd", "-dcq")
+		cmd.Stdin = in
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		return commandReader{out, cmd}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,87 @@
+package fzf
+
+import "github.com/junegunn/fzf/src/util"
+
+// EventBus provides typed subscriptions to the events of fzf so that
+// additional subsystems can be notified of them without taking part in the
+// event loop of the core. Like EventBox, each subscription only holds the
+// latest value of the event. Subscriptions last for the lifetime of the
+// process.
+type EventBus struct {
+	eventBox *util.EventBox
+}
+
+// NewEventBus returns an EventBus for the events on the EventBox
+func NewEventBus(eventBox *util.EventBox) EventBus {
+	return EventBus{eventBox}
+}
+
+// ReaderDone returns a channel that is notified when the input is fully read
+func (bus EventBus) ReaderDone() <-chan struct{} {
+	values := bus.eventBox.Subscribe(EvtReadFin)
+	ch := make(chan struct{}, 1)
+	go func() {
+		for range values {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch
+}
+
+// MatchProgress returns a channel that receives the progress of the search
+func (bus EventBus) MatchProgress() <-chan SearchStatus {
+	values := bus.eventBox.Subscribe(EvtSearchProgress)
+	ch := make(chan SearchStatus, 1)
+	go func() {
+		for value := range values {
+			if status, ok := value.(SearchStatus); ok {
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- status
+			}
+		}
+	}()
+	return ch
+}
+
+// MatchDone returns a channel that receives the result of each search
+func (bus EventBus) MatchDone() <-chan *Merger {
+	values := bus.eventBox.Subscribe(EvtSearchFin)
+	ch := make(chan *Merger, 1)
+	go func() {
+		for value := range values {
+			if merger, ok := value.(*Merger); ok {
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- merger
+			}
+		}
+	}()
+	return ch
+}
+
+// QueryChanged returns a channel that receives the query string whenever it
+// is changed by the user
+func (bus EventBus) QueryChanged() <-chan string {
+	values := bus.eventBox.Subscribe(EvtQueryChange)
+	ch := make(chan string, 1)
+	go func() {
+		for value := range values {
+			if query, ok := value.(string); ok {
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- query
+			}
+		}
+	}()
+	return ch
+}
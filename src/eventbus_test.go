@@ -0,0 +1,50 @@
+package fzf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/junegunn/fzf/src/util"
+)
+
+func TestEventBus(t *testing.T) {
+	eventBox := util.NewEventBox()
+	bus := NewEventBus(eventBox)
+	readerDone := bus.ReaderDone()
+	progress := bus.MatchProgress()
+	matchDone := bus.MatchDone()
+	queryChanged := bus.QueryChanged()
+
+	eventBox.Set(EvtReadFin, nil)
+	<-readerDone
+
+	eventBox.Set(EvtSearchProgress, SearchStatus{Total: 10, Matched: 5, Progress: 0.5})
+	if status := <-progress; status.Total != 10 || status.Matched != 5 {
+		t.Errorf("%v", status)
+	}
+
+	eventBox.Set(EvtSearchFin, EmptyMerger)
+	if merger := <-matchDone; merger != EmptyMerger {
+		t.Errorf("%v", merger)
+	}
+
+	eventBox.Set(EvtQueryChange, "foo")
+	if query := <-queryChanged; query != "foo" {
+		t.Errorf("%v", query)
+	}
+}
+
+func TestEventBusReader(t *testing.T) {
+	eventBox := util.NewEventBox()
+	readerDone := NewEventBus(eventBox).ReaderDone()
+	reader := Reader{
+		pusher:   func(s []byte) bool { return true },
+		eventBox: eventBox,
+		command:  "echo foo"}
+	go reader.ReadSource()
+	select {
+	case <-readerDone:
+	case <-time.After(5 * time.Second):
+		t.Error("ReaderDone should be notified")
+	}
+}
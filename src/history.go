@@ -7,13 +7,17 @@ import (
 	"strings"
 )
 
-// History struct represents input history
+// History struct represents input history. The lines are appended to the
+// file, which is only rewritten to drop the oldest lines once it has grown to
+// twice the maximum size.
 type History struct {
 	path     string
 	lines    []string
 	modified map[int]string
 	maxSize  int
 	cursor   int
+	written  int
+	rewrite  bool
 }
 
 // NewHistory returns the pointer to a new History struct
@@ -40,15 +44,22 @@ func NewHistory(path string, maxSize int) (*History, error) {
 	}
 	// Split lines and limit the maximum number of lines
 	lines := strings.Split(strings.Trim(string(data), "\n"), "\n")
+	written := strings.Count(string(data), "\n")
 	if len(lines[len(lines)-1]) > 0 {
 		lines = append(lines, "")
 	}
+	if len(lines) > maxSize+1 {
+		lines = lines[len(lines)-maxSize-1:]
+	}
 	return &History{
 		path:     path,
 		maxSize:  maxSize,
 		lines:    lines,
 		modified: make(map[int]string),
-		cursor:   len(lines) - 1}, nil
+		cursor:   len(lines) - 1,
+		written:  written,
+		// The line appended to the file should not be joined to the last one
+		rewrite: len(data) > 0 && data[len(data)-1] != '\n'}, nil
 }
 
 func (h *History) append(line string) error {
@@ -56,13 +67,40 @@ func (h *History) append(line string) error {
 	if len(line) == 0 {
 		return nil
 	}
+	// Nor the same line as the last one
+	if len(h.lines) > 1 && h.lines[len(h.lines)-2] == line {
+		return nil
+	}
 
 	lines := append(h.lines[:len(h.lines)-1], line)
 	if len(lines) > h.maxSize {
 		lines = lines[len(lines)-h.maxSize : len(lines)]
 	}
 	h.lines = append(lines, "")
-	return ioutil.WriteFile(h.path, []byte(strings.Join(h.lines, "\n")), 0600)
+	h.written++
+	if h.rewrite || h.written > 2*h.maxSize {
+		h.rewrite = false
+		h.written = len(h.lines) - 1
+		return ioutil.WriteFile(h.path, []byte(strings.Join(h.lines, "\n")), 0600)
+	}
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(line + "\n")
+	return err
+}
+
+// entries returns the set of the lines in the history
+func (h *History) entries() map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range h.lines {
+		if len(line) > 0 {
+			set[line] = true
+		}
+	}
+	return set
 }
 
 func (h *History) override(str string) {
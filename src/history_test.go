@@ -1,7 +1,11 @@
 package fzf
 
 import (
+	"io/ioutil"
+	"os"
 	"os/user"
+	"path/filepath"
+	"strconv"
 	"testing"
 )
 
@@ -23,6 +27,8 @@ func TestHistory(t *testing.T) {
 		h, _ := NewHistory("/tmp/fzf-history", maxHistory)
 		for i := 0; i < maxHistory+10; i++ {
 			h.append("foobar")
+			h.append("foobar")
+			h.append("foobar" + strconv.Itoa(i))
 		}
 	}
 	{ // Read lines
@@ -30,9 +36,11 @@ func TestHistory(t *testing.T) {
 		if len(h.lines) != maxHistory+1 {
 			t.Errorf("Expected: %d, actual: %d\n", maxHistory+1, len(h.lines))
 		}
-		for i := 0; i < maxHistory; i++ {
-			if h.lines[i] != "foobar" {
-				t.Error("Expected: foobar, actual: " + h.lines[i])
+		// Consecutive identical lines are not appended
+		for i := 0; i < maxHistory; i += 2 {
+			exp := "foobar" + strconv.Itoa(maxHistory/2+10+i/2)
+			if h.lines[i] != "foobar" || h.lines[i+1] != exp {
+				t.Errorf("Expected: foobar %s, actual: %s %s", exp, h.lines[i], h.lines[i+1])
 			}
 		}
 	}
@@ -41,6 +49,7 @@ func TestHistory(t *testing.T) {
 		h.append("barfoo")
 		h.append("")
 		h.append("foobarbaz")
+		h.append("foobarbaz")
 	}
 	{ // Read lines again
 		h, _ := NewHistory("/tmp/fzf-history", maxHistory)
@@ -52,8 +61,40 @@ func TestHistory(t *testing.T) {
 				t.Errorf("Expected: %s, actual: %s\n", exp, h.lines[idx])
 			}
 		}
-		compare(maxHistory-3, "foobar")
+		compare(maxHistory-3, "foobar"+strconv.Itoa(maxHistory+9))
 		compare(maxHistory-2, "barfoo")
 		compare(maxHistory-1, "foobarbaz")
 	}
 }
+
+func TestHistoryAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fzf-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+	check := func(expected string) {
+		if data, _ := ioutil.ReadFile(path); string(data) != expected {
+			t.Errorf("Expected: %q, actual: %q", expected, string(data))
+		}
+	}
+
+	// The lines are appended to the file until it grows to twice the size
+	h, _ := NewHistory(path, 3)
+	for _, line := range []string{"a", "b", "c", "d", "e", "f"} {
+		h.append(line)
+	}
+	check("a\nb\nc\nd\ne\nf\n")
+	h.append("g")
+	check("e\nf\ng\n")
+	if h, _ := NewHistory(path, 2); len(h.lines) != 3 || h.lines[0] != "f" {
+		t.Errorf("Expected the last 2 lines: %q", h.lines)
+	}
+
+	// The last line without a newline is not joined to the appended one
+	ioutil.WriteFile(path, []byte("x"), 0600)
+	h, _ = NewHistory(path, 3)
+	h.append("y")
+	check("x\ny\n")
+}
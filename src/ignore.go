@@ -0,0 +1,194 @@
+package fzf
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The files listing the patterns of the paths for the walker to skip. The
+// patterns in the latter take precedence.
+var ignoreFiles = []string{".gitignore", ".ignore"}
+
+// ignoreRule is a pattern in a .gitignore or .ignore file
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreSet is the rules read from the ignore files in a directory, which
+// apply to the paths under it. base is the path of the directory relative to
+// the root of the walker with a trailing slash. For a directory above the
+// root, base is empty and above is the path of the root relative to it.
+type ignoreSet struct {
+	base  string
+	above string
+	rules []ignoreRule
+}
+
+// parseIgnoreRule parses a line of an ignore file. ok is false for the blank
+// lines and the comments.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " ")
+	}
+	if len(line) == 0 || line[0] == '#' {
+		return rule, false
+	}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// A pattern with a slash other than the trailing one is relative to the
+	// directory of the ignore file, otherwise it matches the name at any level
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimLeft(line, "/")
+	if len(line) == 0 {
+		return rule, false
+	}
+	rule.segments = strings.Split(line, "/")
+	for i, segment := range rule.segments {
+		rule.segments[i] = globPattern(segment)
+	}
+	return rule, true
+}
+
+// globPattern converts the negated bracket expressions of the ignore files,
+// [!...], to the ones of path.Match, [^...]
+func globPattern(segment string) string {
+	runes := []rune(segment)
+	inClass := false
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\':
+			i++
+		case !inClass && runes[i] == '[':
+			inClass = true
+			if i+1 < len(runes) && runes[i+1] == '!' {
+				runes[i+1] = '^'
+				i++
+			}
+		case inClass && runes[i] == ']':
+			inClass = false
+		}
+	}
+	return string(runes)
+}
+
+// readIgnoreFiles reads the ignore files in the directory. It returns nil if
+// there are none.
+func readIgnoreFiles(dir string, base string) *ignoreSet {
+	var set *ignoreSet
+	for _, name := range ignoreFiles {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if set == nil {
+			set = &ignoreSet{base: base}
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+				set.rules = append(set.rules, rule)
+			}
+		}
+		file.Close()
+	}
+	return set
+}
+
+// ancestorIgnores returns the rule sets of the ignore files in the directories
+// above the root up to the top of the git repository containing it, from the
+// outermost one. There are none if the root is not in a git repository.
+func ancestorIgnores(root string) []*ignoreSet {
+	dir, err := filepath.Abs(root)
+	if err != nil {
+		return nil
+	}
+	sets := []*ignoreSet{}
+	above := ""
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return sets
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		above = filepath.Base(dir) + "/" + above
+		dir = parent
+		if set := readIgnoreFiles(dir, ""); set != nil {
+			set.above = above
+			sets = append([]*ignoreSet{set}, sets...)
+		}
+	}
+}
+
+// matchSegments tells if the segments of the path match the ones of the
+// pattern, where ** matches any number of segments
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		// A trailing ** matches everything inside, but not the directory itself
+		if len(pattern) == 1 {
+			return len(segments) > 0
+		}
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func (rule ignoreRule) match(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if rule.anchored {
+		return matchSegments(rule.segments, strings.Split(rel, "/"))
+	}
+	return matchSegments(rule.segments, []string{path.Base(rel)})
+}
+
+// isIgnored tells if the path relative to the root of the walker is ignored
+// by the sets of the rules from the outermost directory to the innermost one.
+// The last matching rule decides, and a negated rule includes the path again.
+func isIgnored(sets []*ignoreSet, rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	ignored := false
+	for _, set := range sets {
+		path := set.above + rel
+		if !strings.HasPrefix(path, set.base) {
+			continue
+		}
+		for _, rule := range set.rules {
+			if rule.match(path[len(set.base):], isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,240 @@
+package fzf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"unicode"
+)
+
+/*
+ * Index file layout (little-endian)
+ *
+ *   magic (8 bytes) | chunk size (8) | number of items (8) | fingerprint (8)
+ *   entry for chunk 0 | entry for chunk 1 | ...
+ *
+ * Each entry consists of the set of the (lowercased) ASCII characters found
+ * in the items of the chunk and a bloom filter of their trigrams. Non-ASCII
+ * characters are represented by a single bit.
+ */
+const (
+	indexMagic       = "FZFIDX01"
+	indexHeaderSize  = 32
+	indexCharSetSize = 16
+	indexBloomSize   = 128
+	indexEntrySize   = indexCharSetSize + indexBloomSize
+)
+
+// ChunkIndex is a memory-mapped on-disk index of a static list of items that
+// is consulted to skip the chunks that cannot contain any match
+type ChunkIndex struct {
+	count       int
+	fingerprint uint64
+	data        []byte
+	entries     []byte
+}
+
+func indexRune(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 32
+	} else if r > unicode.MaxASCII {
+		return unicode.ToLower(r)
+	}
+	return r
+}
+
+func charBit(r rune) uint {
+	if r > unicode.MaxASCII {
+		return 0
+	}
+	return uint(r)
+}
+
+func trigramBit(a rune, b rune, c rune) uint {
+	h := (uint32(a)*31+uint32(b))*31 + uint32(c)
+	return uint((h*2654435761)>>22) % (indexBloomSize * 8)
+}
+
+func hasBit(bits []byte, bit uint) bool {
+	return bits[bit/8]&(1<<(bit%8)) != 0
+}
+
+func setBit(bits []byte, bit uint) {
+	bits[bit/8] |= 1 << (bit % 8)
+}
+
+func buildIndexEntry(chunk *Chunk, entry []byte) {
+	charSet := entry[:indexCharSetSize]
+	bloom := entry[indexCharSetSize:]
+	for _, item := range *chunk {
+		var prev1, prev2 rune
+		for idx, r := range item.text {
+			r = indexRune(r)
+			setBit(charSet, charBit(r))
+			if idx >= 2 {
+				setBit(bloom, trigramBit(prev2, prev1, r))
+			}
+			prev2, prev1 = prev1, r
+		}
+	}
+}
+
+// chunksFingerprint returns the FNV-1a hash of the items in the chunks to
+// identify the input
+func chunksFingerprint(chunks []*Chunk) uint64 {
+	hash := uint64(14695981039346656037)
+	for _, chunk := range chunks {
+		for _, item := range *chunk {
+			for _, r := range item.text {
+				hash ^= uint64(r)
+				hash *= 1099511628211
+			}
+			hash ^= uint64('\n')
+			hash *= 1099511628211
+		}
+	}
+	return hash
+}
+
+func indexHeader(count int, fingerprint uint64) []byte {
+	header := make([]byte, indexHeaderSize)
+	copy(header, indexMagic)
+	binary.LittleEndian.PutUint64(header[8:], uint64(chunkSize))
+	binary.LittleEndian.PutUint64(header[16:], uint64(count))
+	binary.LittleEndian.PutUint64(header[24:], fingerprint)
+	return header
+}
+
+func mmapIndex(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < indexHeaderSize {
+		return nil, errors.New("invalid index file: " + path)
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// OpenChunkIndex returns the index for the given chunks stored in the file.
+// The file is (re)built when it does not exist or when it was built for a
+// different list of items.
+func OpenChunkIndex(path string, chunks []*Chunk) (*ChunkIndex, error) {
+	count := CountItems(chunks)
+	fingerprint := chunksFingerprint(chunks)
+	header := indexHeader(count, fingerprint)
+	size := indexHeaderSize + len(chunks)*indexEntrySize
+
+	data, err := mmapIndex(path)
+	if err == nil && (len(data) != size || !bytes.Equal(data[:indexHeaderSize], header)) {
+		syscall.Munmap(data)
+		err = errors.New("outdated index file: " + path)
+	}
+	if err != nil {
+		buf := make([]byte, size)
+		copy(buf, header)
+		for idx, chunk := range chunks {
+			offset := indexHeaderSize + idx*indexEntrySize
+			buildIndexEntry(chunk, buf[offset:offset+indexEntrySize])
+		}
+
+		// Write to a temporary file first not to leave a broken index behind
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return nil, err
+		}
+		if data, err = mmapIndex(path); err != nil {
+			return nil, err
+		}
+	}
+	return &ChunkIndex{count: count, fingerprint: fingerprint, data: data, entries: data[indexHeaderSize:]}, nil
+}
+
+// Close unmaps the index file. The index must not be used afterwards.
+func (ci *ChunkIndex) Close() error {
+	data := ci.data
+	ci.data, ci.entries = nil, nil
+	if data == nil {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
+
+func buildCharSet(chunk *Chunk, charSet []byte) {
+	for _, item := range *chunk {
+		for _, r := range item.text {
+			setBit(charSet, charBit(indexRune(r)))
+		}
+	}
+}
+
+func containsChars(charSet []byte, text []rune) bool {
+	for _, r := range text {
+		if !hasBit(charSet, charBit(indexRune(r))) {
+			return false
+		}
+	}
+	return true
+}
+
+func mayContain(entry []byte, text []rune, contiguous bool) bool {
+	if !containsChars(entry[:indexCharSetSize], text) {
+		return false
+	}
+	bloom := entry[indexCharSetSize:]
+	if contiguous {
+		for idx := 2; idx < len(text); idx++ {
+			if !hasBit(bloom, trigramBit(indexRune(text[idx-2]), indexRune(text[idx-1]), indexRune(text[idx]))) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// patternMayMatch returns false if the pattern cannot match any text for
+// which contains returns false for the required terms. contains is given the
+// text of each term and whether it should appear contiguously.
+func patternMayMatch(pattern *Pattern, contains func([]rune, bool) bool) bool {
+	if !pattern.extended {
+		return contains(pattern.text, !pattern.fuzzy)
+	}
+	for _, termSet := range pattern.termSets {
+		possible := false
+		for _, term := range termSet {
+			// Inverse terms can be satisfied by any chunk
+			if term.inv || contains(term.text, term.typ != termFuzzy) {
+				possible = true
+				break
+			}
+		}
+		if !possible {
+			return false
+		}
+	}
+	return true
+}
+
+// MayMatch returns false if none of the items in the chunk at the given
+// position can match the pattern
+func (ci *ChunkIndex) MayMatch(chunkIdx int, pattern *Pattern) bool {
+	if (chunkIdx+1)*indexEntrySize > len(ci.entries) {
+		return true
+	}
+	entry := ci.entries[chunkIdx*indexEntrySize : (chunkIdx+1)*indexEntrySize]
+	return patternMayMatch(pattern, func(text []rune, contiguous bool) bool {
+		return mayContain(entry, text, contiguous)
+	})
+}
@@ -0,0 +1,127 @@
+package fzf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func buildIndexedChunks(lines ...string) []*Chunk {
+	cl := NewChunkList(func(data []byte, index int) *Item {
+		return &Item{text: []rune(string(data)), rank: buildEmptyRank(int32(index))}
+	})
+	for _, line := range lines {
+		cl.Push([]byte(line))
+	}
+	snapshot, _ := cl.Snapshot()
+	return snapshot
+}
+
+func TestChunkIndex(t *testing.T) {
+	defer clearPatternCache()
+	dir, err := ioutil.TempDir("", "fzf-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index")
+
+	lines := []string{}
+	for i := 0; i < chunkSize; i++ {
+		lines = append(lines, fmt.Sprintf("foo/bar/%d", i))
+	}
+	lines = append(lines, "Hello World", "안녕하세요")
+	chunks := buildIndexedChunks(lines...)
+
+	index, err := OpenChunkIndex(path, chunks)
+	if err != nil || index.count != chunkSize+2 {
+		t.Fatal("Failed to build index", err)
+	}
+
+	test := func(query string, first bool, second bool) {
+		clearPatternCache()
+		pattern := BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, []rune(query))
+		if index.MayMatch(0, pattern) != first || index.MayMatch(1, pattern) != second {
+			t.Errorf("%s: expected %v, %v", query, first, second)
+		}
+	}
+	test("fbr", true, false)
+	test("hwd", false, true)
+	test("HWD", false, true)
+	test("'bar/", true, false)
+	test("'rab", false, false)
+	test("'rld", false, true)
+	test("fbr | hwd", true, true)
+	test("fbr hwd", false, false)
+	test("!fbr", true, true)
+	test("안녕", false, true)
+
+	// Out of range
+	clearPatternCache()
+	if !index.MayMatch(2, BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, []rune("xyz"))) {
+		t.Error("Chunks not in the index may match")
+	}
+
+	// Reuse the index file for the same input
+	info, _ := os.Stat(path)
+	os.Chtimes(path, info.ModTime(), info.ModTime().Add(-3600e9))
+	info, _ = os.Stat(path)
+	if _, err := OpenChunkIndex(path, chunks); err != nil {
+		t.Error(err)
+	}
+	if newInfo, _ := os.Stat(path); !newInfo.ModTime().Equal(info.ModTime()) {
+		t.Error("Index should not be rebuilt")
+	}
+
+	// Rebuild the index for a different input
+	index.Close()
+	if index.entries != nil {
+		t.Error("Index should be unmapped")
+	}
+	index, err = OpenChunkIndex(path, buildIndexedChunks("xyz"))
+	clearPatternCache()
+	if err != nil || index.count != 1 ||
+		!index.MayMatch(0, BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, []rune("xyz"))) {
+		t.Error("Index should be rebuilt", err)
+	}
+
+	index.Close()
+	if _, err := OpenChunkIndex(filepath.Join(dir, "missing", "index"), chunks); err == nil {
+		t.Error("Error expected")
+	}
+}
+
+func TestMatcherChunkIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fzf-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index")
+
+	m := NewMatcher(func(runes []rune) *Pattern {
+		return BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, runes)
+	}, true, false, 0, path, nil, nil)
+	defer m.closeIndex()
+	chunks := buildIndexedChunks("foo", "bar")
+	if m.chunkIndex(MatchRequest{chunks: chunks, final: false}) != nil {
+		t.Error("Index should not be built while reading")
+	}
+	index := m.chunkIndex(MatchRequest{chunks: chunks, final: true})
+	if index == nil || m.chunkIndex(MatchRequest{chunks: chunks, final: true}) != index {
+		t.Fatal("Index should be built once")
+	}
+
+	// The index is not rebuilt for the items appended to the list
+	info, _ := os.Stat(path)
+	os.Chtimes(path, info.ModTime(), info.ModTime().Add(-3600e9))
+	info, _ = os.Stat(path)
+	if m.chunkIndex(MatchRequest{chunks: buildIndexedChunks("foo", "bar", "baz"), final: true}) != nil {
+		t.Error("Index should not be used for the grown list")
+	}
+	if newInfo, _ := os.Stat(path); !newInfo.ModTime().Equal(info.ModTime()) {
+		t.Error("Index should not be rebuilt")
+	}
+}
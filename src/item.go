@@ -23,11 +23,22 @@ type Item struct {
 	offsets     []Offset
 	colors      []ansiOffset
 	rank        [5]int32
+	boosted     bool
+	payload     *string
 }
 
 // Sort criteria to use. Never changes once fzf is started.
 var sortCriteria []criterion
 
+// Comparator decides the order of two items with the same rank. It should
+// return a negative number if a should come before b, a positive number if b
+// should come before a, and zero to fall back to the order in the input.
+type Comparator func(a *Item, b *Item) int
+
+// Comparator supplied by the program using fzf as a library. Never changes
+// once fzf is started.
+var tiebreaker Comparator
+
 func isRankValid(rank [5]int32) bool {
 	// Exclude ordinal index
 	for _, r := range rank[:4] {
@@ -42,6 +53,7 @@ func buildEmptyRank(index int32) [5]int32 {
 	return [5]int32{0, 0, 0, 0, index}
 }
 
+// Index returns the position of the item in the input
 func (item *Item) Index() int32 {
 	return item.rank[4]
 }
@@ -82,6 +94,9 @@ func (item *Item) Rank(cache bool) [5]int32 {
 		switch criterion {
 		case byMatchLen:
 			val = int32(matchlen)
+			if item.boosted && val > acceptedBoost && matchlen < math.MaxInt32 {
+				val -= acceptedBoost
+			}
 		case byLength:
 			// It is guaranteed that .transformed in not null in normal execution
 			if item.transformed != nil {
@@ -116,13 +131,17 @@ func (item *Item) Rank(cache bool) [5]int32 {
 	return rank
 }
 
-// AsString returns the original string
+// AsString returns the original string, or the payload attached to the item
 func (item *Item) AsString(stripAnsi bool) string {
 	return *item.StringPtr(stripAnsi)
 }
 
-// StringPtr returns the pointer to the original string
+// StringPtr returns the pointer to the original string, or to the payload
+// attached to the item
 func (item *Item) StringPtr(stripAnsi bool) *string {
+	if item.payload != nil {
+		return item.payload
+	}
 	if item.origText != nil {
 		if stripAnsi {
 			trimmed, _, _ := extractColor(string(*item.origText), nil)
@@ -250,10 +269,7 @@ func (a ByRelevance) Swap(i, j int) {
 }
 
 func (a ByRelevance) Less(i, j int) bool {
-	irank := a[i].Rank(true)
-	jrank := a[j].Rank(true)
-
-	return compareRanks(irank, jrank, false)
+	return compareItems(a[i], a[j], false)
 }
 
 // ByRelevanceTac is for sorting Items
@@ -268,10 +284,26 @@ func (a ByRelevanceTac) Swap(i, j int) {
 }
 
 func (a ByRelevanceTac) Less(i, j int) bool {
-	irank := a[i].Rank(true)
-	jrank := a[j].Rank(true)
+	return compareItems(a[i], a[j], true)
+}
 
-	return compareRanks(irank, jrank, true)
+// compareItems compares the ranks of the items, and consults the custom
+// comparator only when they are tied before looking at the indexes
+func compareItems(i *Item, j *Item, tac bool) bool {
+	irank := i.Rank(true)
+	jrank := j.Rank(true)
+	if tiebreaker != nil && sameScore(irank, jrank) {
+		if result := tiebreaker(i, j); result != 0 {
+			return result < 0
+		}
+	}
+	return compareRanks(irank, jrank, tac)
+}
+
+func sameScore(irank [5]int32, jrank [5]int32) bool {
+	// Exclude ordinal index
+	irank[4], jrank[4] = 0, 0
+	return irank == jrank
 }
 
 func compareRanks(irank [5]int32, jrank [5]int32, tac bool) bool {
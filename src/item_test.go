@@ -106,3 +106,21 @@ func TestColorOffset(t *testing.T) {
 	assert(4, 25, 35, 99, false)
 	assert(5, 35, 40, curses.ColUser+2, true)
 }
+
+func TestItemRankCriteria(t *testing.T) {
+	// FIXME global
+	defer func() { sortCriteria = []criterion{byMatchLen, byLength} }()
+	sortCriteria = []criterion{byMatchLen, byEnd, byLength}
+
+	item := Item{text: []rune("foobar baz"), offsets: []Offset{Offset{3, 6, 10}}, rank: buildEmptyRank(7)}
+	rank := item.Rank(false)
+	if rank[0] != 3 || rank[1] != 5 || rank[2] != 10 || rank[3] != 0 || rank[4] != 7 {
+		t.Error(rank)
+	}
+
+	sortCriteria = []criterion{byMatchLen, byBegin}
+	rank = item.Rank(false)
+	if rank[0] != 3 || rank[1] != 3 || rank[2] != 0 || rank[4] != 7 {
+		t.Error(rank)
+	}
+}
@@ -0,0 +1,58 @@
+package fzf
+
+// KillRing keeps the text deleted from the query by the kill commands so that
+// it can be yanked back, like the kill ring of readline
+type KillRing struct {
+	entries [][]rune
+	maxSize int
+	cursor  int
+}
+
+// NewKillRing returns the pointer to a new KillRing struct
+func NewKillRing(maxSize int) *KillRing {
+	return &KillRing{maxSize: maxSize}
+}
+
+// kill saves the text as a new entry. If merge is set, the text is added to
+// the last entry instead, in front of it if it is deleted backward, so that
+// consecutive kills can be yanked back at once.
+func (r *KillRing) kill(text []rune, merge bool, backward bool) {
+	if len(text) == 0 {
+		return
+	}
+	text = copySlice(text)
+	if merge && len(r.entries) > 0 {
+		last := r.entries[len(r.entries)-1]
+		if backward {
+			text = append(text, last...)
+		} else {
+			text = append(copySlice(last), text...)
+		}
+		r.entries[len(r.entries)-1] = text
+	} else {
+		r.entries = append(r.entries, text)
+		if len(r.entries) > r.maxSize {
+			r.entries = r.entries[len(r.entries)-r.maxSize:]
+		}
+	}
+	r.cursor = len(r.entries) - 1
+}
+
+// yank returns the entry most recently killed
+func (r *KillRing) yank() []rune {
+	if len(r.entries) == 0 {
+		return []rune{}
+	}
+	r.cursor = len(r.entries) - 1
+	return r.entries[r.cursor]
+}
+
+// rotate returns the entry before the one yanked last, wrapping around to the
+// most recent one
+func (r *KillRing) rotate() []rune {
+	if len(r.entries) == 0 {
+		return []rune{}
+	}
+	r.cursor = (r.cursor + len(r.entries) - 1) % len(r.entries)
+	return r.entries[r.cursor]
+}
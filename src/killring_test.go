@@ -0,0 +1,32 @@
+package fzf
+
+import (
+	"testing"
+)
+
+func TestKillRing(t *testing.T) {
+	ring := NewKillRing(3)
+	if yanked := string(ring.yank()); yanked != "" {
+		t.Errorf("%q", yanked)
+	}
+	ring.kill([]rune("foo"), false, false)
+	ring.kill([]rune("bar"), false, false)
+	ring.kill([]rune("baz"), true, false)
+	ring.kill([]rune("qux "), true, true)
+	if yanked := string(ring.yank()); yanked != "qux barbaz" {
+		t.Errorf("%q", yanked)
+	}
+	for _, expected := range []string{"foo", "qux barbaz", "foo"} {
+		if rotated := string(ring.rotate()); rotated != expected {
+			t.Errorf("%q (expected: %q)", rotated, expected)
+		}
+	}
+
+	// The oldest entries are discarded
+	for _, text := range []string{"1", "2", "3"} {
+		ring.kill([]rune(text), false, false)
+	}
+	if len(ring.entries) != 3 || string(ring.yank()) != "3" || string(ring.rotate()) != "2" {
+		t.Errorf("%q", ring.entries)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/junegunn/fzf/src/util"
@@ -12,10 +13,73 @@ import (
 
 // MatchRequest represents a search request
 type MatchRequest struct {
-	chunks  []*Chunk
-	pattern *Pattern
-	final   bool
-	sort    bool
+	chunks   []*Chunk
+	pattern  *Pattern
+	final    bool
+	sort     bool
+	revision int
+}
+
+// SearchStatus describes the progress of the ongoing search
+type SearchStatus struct {
+	Total    int
+	Matched  int
+	Progress float32
+}
+
+// MatcherStats is the collection of the performance metrics of the matcher
+type MatcherStats struct {
+	Queries      int
+	Cancelled    int
+	CacheHits    int
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+	Scans        int
+	ScannedItems int
+	ScanTime     time.Duration
+	WorkerTime   time.Duration
+	WorkerSlots  time.Duration
+}
+
+// AverageLatency returns the average time taken to complete a query
+func (s MatcherStats) AverageLatency() time.Duration {
+	if s.Queries == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Queries)
+}
+
+// Throughput returns the number of items scanned per second
+func (s MatcherStats) Throughput() float64 {
+	if s.ScanTime == 0 {
+		return 0
+	}
+	return float64(s.ScannedItems) / s.ScanTime.Seconds()
+}
+
+// CacheHitRate returns the ratio of the queries answered from the caches
+func (s MatcherStats) CacheHitRate() float64 {
+	if s.Queries == 0 {
+		return 0
+	}
+	return float64(s.CacheHits) / float64(s.Queries)
+}
+
+// Utilization returns the ratio of the time the worker goroutines spent on
+// matching to the time they could have spent during the scans
+func (s MatcherStats) Utilization() float64 {
+	if s.WorkerSlots == 0 {
+		return 0
+	}
+	return float64(s.WorkerTime) / float64(s.WorkerSlots)
+}
+
+func (s MatcherStats) String() string {
+	return fmt.Sprintf(
+		"queries: %d (cancelled: %d), latency: %v (avg) / %v (max), "+
+			"throughput: %.0f items/sec, cache hit rate: %.2f, utilization: %.2f",
+		s.Queries, s.Cancelled, s.AverageLatency(), s.MaxLatency,
+		s.Throughput(), s.CacheHitRate(), s.Utilization())
 }
 
 // Matcher is responsible for performing search
@@ -23,10 +87,22 @@ type Matcher struct {
 	patternBuilder func([]rune) *Pattern
 	sort           bool
 	tac            bool
+	maxMatches     int
+	indexPath      string
+	index          *ChunkIndex
+	indexed        bool
+	resultCache    *ResultCache
+	fingerprint    uint64
+	fingerprinted  int
+	stats          MatcherStats
+	statsMutex     sync.Mutex
 	eventBox       *util.EventBox
 	reqBox         *util.EventBox
 	partitions     int
+	throttle       int32
 	mergerCache    map[string]*Merger
+	secondary      *Pattern
+	secondaryMutex sync.Mutex
 }
 
 const (
@@ -36,20 +112,33 @@ const (
 
 // NewMatcher returns a new Matcher
 func NewMatcher(patternBuilder func([]rune) *Pattern,
-	sort bool, tac bool, eventBox *util.EventBox) *Matcher {
+	sort bool, tac bool, maxMatches int, indexPath string, resultCache *ResultCache,
+	eventBox *util.EventBox) *Matcher {
 	return &Matcher{
 		patternBuilder: patternBuilder,
 		sort:           sort,
 		tac:            tac,
+		maxMatches:     maxMatches,
+		indexPath:      indexPath,
+		index:          nil,
+		indexed:        false,
+		resultCache:    resultCache,
+		fingerprint:    0,
+		fingerprinted:  -1,
+		stats:          MatcherStats{},
+		statsMutex:     sync.Mutex{},
 		eventBox:       eventBox,
 		reqBox:         util.NewEventBox(),
-		partitions:     runtime.NumCPU(),
-		mergerCache:    make(map[string]*Merger)}
+		partitions:     util.Min(numPartitionsMultiplier*runtime.GOMAXPROCS(0), maxPartitions),
+		mergerCache:    make(map[string]*Merger),
+		secondary:      patternBuilder([]rune{}),
+		secondaryMutex: sync.Mutex{}}
 }
 
 // Loop puts Matcher in action
 func (m *Matcher) Loop() {
 	prevCount := 0
+	prevRevision := 0
 
 	for {
 		var request MatchRequest
@@ -66,6 +155,19 @@ func (m *Matcher) Loop() {
 			events.Clear()
 		})
 
+		startedAt := time.Now()
+
+		// The list of items has been replaced, so the results and the indexes
+		// for the previous list are no longer valid
+		if request.revision != prevRevision {
+			prevRevision = request.revision
+			prevCount = -1
+			m.closeIndex()
+			m.indexed = false
+			m.fingerprinted = -1
+			clearChunkCache()
+		}
+
 		if request.sort != m.sort {
 			m.sort = request.sort
 			m.mergerCache = make(map[string]*Merger)
@@ -76,7 +178,7 @@ func (m *Matcher) Loop() {
 		patternString := request.pattern.AsString()
 		var merger *Merger
 		cancelled := false
-		count := CountItems(request.chunks)
+		count := itemsEnd(request.chunks)
 
 		foundCache := false
 		if count == prevCount {
@@ -92,32 +194,215 @@ func (m *Matcher) Loop() {
 		}
 
 		if !foundCache {
-			merger, cancelled = m.scan(request)
+			if stored := m.findResult(request); stored != nil {
+				foundCache = true
+				merger = stored
+			} else {
+				merger, cancelled = m.scan(request)
+			}
 		}
 
+		m.updateStats(func(stats *MatcherStats) {
+			if cancelled {
+				stats.Cancelled++
+				return
+			}
+			latency := time.Since(startedAt)
+			stats.Queries++
+			stats.TotalLatency += latency
+			if latency > stats.MaxLatency {
+				stats.MaxLatency = latency
+			}
+			if foundCache {
+				stats.CacheHits++
+			}
+		})
+
 		if !cancelled {
 			if merger.cacheable() {
 				m.mergerCache[patternString] = merger
 			}
 			merger.final = request.final
+
+			// Show the result first and refine the order of the top items
+			// afterwards so that the list is displayed without delay
+			var top, result []*Item
+			if !foundCache {
+				if m.sort && request.pattern.IsRescorable() {
+					top = merger.Top(rescoreMax)
+				}
+				result = m.resultToStore(request, merger)
+			}
 			m.eventBox.Set(EvtSearchFin, merger)
+			if refined := m.rescore(request.pattern, merger, top); refined != nil {
+				if refined.cacheable() {
+					m.mergerCache[patternString] = refined
+				}
+				m.eventBox.Set(EvtSearchFin, refined)
+				if result != nil {
+					copy(result, refined.top)
+				}
+			}
+			m.storeResult(request, result)
+		}
+	}
+}
+
+func (m *Matcher) updateStats(update func(*MatcherStats)) {
+	m.statsMutex.Lock()
+	update(&m.stats)
+	m.statsMutex.Unlock()
+}
+
+// SetThrottle limits the number of worker goroutines matching the items at
+// the same time. Zero means no limit. The limit applies from the next scan.
+func (m *Matcher) SetThrottle(throttle int) {
+	atomic.StoreInt32(&m.throttle, int32(throttle))
+}
+
+// Stats returns the snapshot of the performance metrics of the matcher
+func (m *Matcher) Stats() MatcherStats {
+	m.statsMutex.Lock()
+	defer m.statsMutex.Unlock()
+	return m.stats
+}
+
+// inputFingerprint returns the fingerprint of the complete input
+func (m *Matcher) inputFingerprint(chunks []*Chunk) uint64 {
+	if count := CountItems(chunks); count != m.fingerprinted {
+		m.fingerprint = chunksFingerprint(chunks)
+		m.fingerprinted = count
+	}
+	return m.fingerprint
+}
+
+// findResult looks up the persistent cache for the result of the request
+// made in the previous sessions
+func (m *Matcher) findResult(request MatchRequest) *Merger {
+	if m.resultCache == nil || !request.final || request.pattern.IsEmpty() {
+		return nil
+	}
+	indexes, found := m.resultCache.find(
+		m.inputFingerprint(request.chunks), m.sort, request.pattern.AsString())
+	if !found {
+		return nil
+	}
+	count := CountItems(request.chunks)
+	items := make([]*Item, len(indexes))
+	for idx, index := range indexes {
+		if int(index) >= count {
+			return nil
+		}
+		items[idx] = (*request.chunks[int(index)/chunkSize])[int(index)%chunkSize]
+	}
+
+	// Match the items again for the offsets of the matched substrings
+	matches := request.pattern.MatchItems(items)
+	if len(matches) != len(items) {
+		return nil
+	}
+	return NewMerger([][]*Item{matches}, false, false)
+}
+
+// resultToStore returns the items of the merger to store in the persistent
+// cache, or nil if the result should not be stored
+func (m *Matcher) resultToStore(request MatchRequest, merger *Merger) []*Item {
+	if m.resultCache == nil || !request.final || request.pattern.IsEmpty() ||
+		merger.Length() > resultCacheItemsMax {
+		return nil
+	}
+	return merger.Top(merger.Length())
+}
+
+func (m *Matcher) storeResult(request MatchRequest, items []*Item) {
+	if items == nil {
+		return
+	}
+	indexes := make([]int32, len(items))
+	for idx, item := range items {
+		indexes[idx] = item.Index()
+	}
+	m.resultCache.add(
+		m.inputFingerprint(request.chunks), m.sort, request.pattern.AsString(), indexes)
+}
+
+// rescore re-ranks the top items of the merger using the more accurate
+// matching algorithm. It gives up and returns nil when a new request arrives.
+// Match lengths can only decrease by rescoring, so the refined items are
+// kept in front of the rest of the items in the merger.
+func (m *Matcher) rescore(pattern *Pattern, merger *Merger, top []*Item) *Merger {
+	if len(top) == 0 {
+		return nil
+	}
+	rescored := make([]*Item, 0, len(top))
+	sliceStartedAt := time.Now()
+	for _, item := range top {
+		if len(rescored)%chunkSize == 0 {
+			if m.reqBox.Peek(reqReset) || m.reqBox.Peek(reqRetry) {
+				return nil
+			}
+			if time.Since(sliceStartedAt) > matchTimeSlice {
+				runtime.Gosched()
+				sliceStartedAt = time.Now()
+			}
 		}
+		rescored = append(rescored, pattern.Rescore([]*Item{item})...)
+	}
+	if len(rescored) != len(top) {
+		return nil
+	}
+	sortItems(rescored, m.tac)
+	return merger.Refine(rescored)
+}
+
+// chunkIndex returns the on-disk index of the chunks once the input is
+// complete. The index is opened only once for each list. Failing to open the
+// index is not fatal as it only serves to speed up the search.
+func (m *Matcher) chunkIndex(request MatchRequest) *ChunkIndex {
+	if len(m.indexPath) == 0 || !request.final {
+		return nil
+	}
+	if !m.indexed {
+		m.indexed = true
+		index, err := OpenChunkIndex(m.indexPath, request.chunks)
+		if err != nil {
+			m.indexPath = ""
+			return nil
+		}
+		m.index = index
+	} else if m.index != nil && m.index.fingerprint != m.inputFingerprint(request.chunks) {
+		// The list is no longer static as the items are appended to it. The
+		// index is not rebuilt for every batch of them, but until the list is
+		// replaced, the search goes without it.
+		m.closeIndex()
+	}
+	return m.index
+}
+
+// closeIndex unmaps the index of the previous list. It is only called from the
+// matcher loop while no scan is using the index.
+func (m *Matcher) closeIndex() {
+	if m.index != nil {
+		m.index.Close()
+		m.index = nil
 	}
 }
 
 func (m *Matcher) sliceChunks(chunks []*Chunk) [][]*Chunk {
-	perSlice := len(chunks) / m.partitions
+	partitions := m.partitions
+	perSlice := len(chunks) / partitions
 
-	// No need to parallelize
+	// Fewer chunks than partitions; one chunk per slice
 	if perSlice == 0 {
-		return [][]*Chunk{chunks}
+		partitions = len(chunks)
+		perSlice = 1
 	}
 
-	slices := make([][]*Chunk, m.partitions)
-	for i := 0; i < m.partitions; i++ {
+	slices := make([][]*Chunk, partitions)
+	for i := 0; i < partitions; i++ {
 		start := i * perSlice
 		end := start + perSlice
-		if i == m.partitions-1 {
+		if i == partitions-1 {
 			end = len(chunks)
 		}
 		slices[i] = chunks[start:end]
@@ -125,6 +410,14 @@ func (m *Matcher) sliceChunks(chunks []*Chunk) [][]*Chunk {
 	return slices
 }
 
+func sortItems(items []*Item, tac bool) {
+	if tac {
+		sort.Sort(ByRelevanceTac(items))
+	} else {
+		sort.Sort(ByRelevance(items))
+	}
+}
+
 type partialResult struct {
 	index   int
 	matches []*Item
@@ -139,39 +432,93 @@ func (m *Matcher) scan(request MatchRequest) (*Merger, bool) {
 	}
 	pattern := request.pattern
 	if pattern.IsEmpty() {
-		return PassMerger(&request.chunks, m.tac), false
+		merger := PassMerger(&request.chunks, m.tac)
+		if m.maxMatches > 0 && merger.Length() > m.maxMatches {
+			// Every item matches the empty pattern
+			return NewMerger([][]*Item{merger.Top(m.maxMatches)}, false, false), false
+		}
+		return merger, false
 	}
 
 	cancelled := util.NewAtomicBool(false)
+	var workerTime int64
 
+	// Each worker holds a slot while matching a chunk so that only a limited
+	// number of them keep the processors busy
+	var slots chan bool
+	if throttle := atomic.LoadInt32(&m.throttle); throttle > 0 {
+		slots = make(chan bool, throttle)
+	}
+	acquire := func() {
+		if slots != nil {
+			slots <- true
+		}
+	}
+	release := func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+
+	index := m.chunkIndex(request)
 	slices := m.sliceChunks(request.chunks)
 	numSlices := len(slices)
 	resultChan := make(chan partialResult, numSlices)
-	countChan := make(chan int, numChunks)
+	chunkChan := make(chan partialResult, numChunks)
 	waitGroup := sync.WaitGroup{}
 
+	offset := 0
 	for idx, chunks := range slices {
 		waitGroup.Add(1)
-		go func(idx int, chunks []*Chunk) {
+		go func(idx int, offset int, chunks []*Chunk) {
 			defer func() { waitGroup.Done() }()
 			sliceMatches := []*Item{}
-			for _, chunk := range chunks {
-				matches := request.pattern.Match(chunk)
-				sliceMatches = append(sliceMatches, matches...)
+			var topMatches *boundedHeap
+			if m.sort && m.maxMatches > 0 {
+				topMatches = newBoundedHeap(m.maxMatches, m.tac)
+			}
+			workerStartedAt := time.Now()
+			sliceStartedAt := workerStartedAt
+			for chunkIdx, chunk := range chunks {
+				// Yield the processor at the end of each time slice so that
+				// the other goroutines, including the one for the terminal,
+				// are not starved while scanning a large number of items
+				if time.Since(sliceStartedAt) > matchTimeSlice {
+					runtime.Gosched()
+					sliceStartedAt = time.Now()
+				}
+				acquire()
+				var matches []*Item
+				if (m.sort || m.maxMatches == 0 || m.tac || len(sliceMatches) < m.maxMatches) &&
+					(index == nil || index.MayMatch(offset+chunkIdx, pattern)) {
+					matches = pattern.Match(chunk)
+				}
+				if topMatches != nil {
+					topMatches.addAll(matches)
+				} else {
+					sliceMatches = append(sliceMatches, matches...)
+					if m.maxMatches > 0 && m.tac && len(sliceMatches) > 2*m.maxMatches {
+						sliceMatches = append([]*Item{}, sliceMatches[len(sliceMatches)-m.maxMatches:]...)
+					}
+				}
+				release()
 				if cancelled.Get() {
 					return
 				}
-				countChan <- len(matches)
+				chunkChan <- partialResult{idx, matches}
 			}
-			if m.sort {
-				if m.tac {
-					sort.Sort(ByRelevanceTac(sliceMatches))
-				} else {
-					sort.Sort(ByRelevance(sliceMatches))
-				}
+			if topMatches != nil {
+				sliceMatches = topMatches.items
+			}
+			if m.sort && !cancelled.Get() {
+				acquire()
+				sortItems(sliceMatches, m.tac)
+				release()
 			}
+			atomic.AddInt64(&workerTime, int64(time.Since(workerStartedAt)))
 			resultChan <- partialResult{idx, sliceMatches}
-		}(idx, chunks)
+		}(idx, offset, chunks)
+		offset += len(chunks)
 	}
 
 	wait := func() bool {
@@ -182,9 +529,11 @@ func (m *Matcher) scan(request MatchRequest) (*Merger, bool) {
 
 	count := 0
 	matchCount := 0
-	for matchesInChunk := range countChan {
+	partialMatches := make([][]*Item, numSlices)
+	partialAt := startedAt.Add(progressMinDuration)
+	for result := range chunkChan {
 		count++
-		matchCount += matchesInChunk
+		matchCount += len(result.matches)
 
 		if count == numChunks {
 			break
@@ -194,21 +543,93 @@ func (m *Matcher) scan(request MatchRequest) (*Merger, bool) {
 			return nil, wait()
 		}
 
-		if time.Now().Sub(startedAt) > progressMinDuration {
-			m.eventBox.Set(EvtSearchProgress, float32(count)/float32(numChunks))
+		// Keep the matches found so far so that we can show them before the
+		// scan is complete. We stop collecting them when there are too many
+		// as it is costly to sort them over and over again.
+		if matchCount <= partialResultsMax {
+			partialMatches[result.index] = append(partialMatches[result.index], result.matches...)
+		}
+
+		now := time.Now()
+		if now.Sub(startedAt) > progressMinDuration {
+			m.eventBox.Set(EvtSearchProgress, SearchStatus{
+				Total:    CountItems(request.chunks),
+				Matched:  matchCount,
+				Progress: float32(count) / float32(numChunks)})
+		}
+		if now.After(partialAt) && matchCount <= partialResultsMax {
+			m.eventBox.Set(EvtSearchPartial, m.partialMerger(partialMatches))
+			partialAt = now.Add(partialResultsInterval)
 		}
 	}
 
+	// Sorting a large number of matches can take a while, so we keep checking
+	// for a new request instead of blocking on resultChan. The workers are not
+	// waited for as they can't be interrupted in the middle of sorting.
+	ticker := time.NewTicker(cancelCheckInterval)
+	defer ticker.Stop()
 	partialResults := make([][]*Item, numSlices)
-	for _, _ = range slices {
-		partialResult := <-resultChan
-		partialResults[partialResult.index] = partialResult.matches
+	for received := 0; received < numSlices; {
+		select {
+		case partialResult := <-resultChan:
+			partialResults[partialResult.index] = partialResult.matches
+			received++
+		case <-ticker.C:
+			if m.reqBox.Peek(reqReset) {
+				cancelled.Set(true)
+				return nil, true
+			}
+		}
+	}
+	if m.maxMatches > 0 && !m.sort {
+		partialResults = [][]*Item{m.limitUnsorted(partialResults)}
+	}
+	merger := NewMerger(partialResults, m.sort, m.tac)
+	if m.maxMatches > 0 {
+		merger.count = util.Min(merger.count, m.maxMatches)
+	}
+
+	elapsed := time.Since(startedAt)
+	m.updateStats(func(stats *MatcherStats) {
+		stats.Scans++
+		stats.ScannedItems += CountItems(request.chunks)
+		stats.ScanTime += elapsed
+		stats.WorkerTime += time.Duration(atomic.LoadInt64(&workerTime))
+		stats.WorkerSlots += elapsed * time.Duration(numSlices)
+	})
+	return merger, false
+}
+
+// limitUnsorted returns the first maxMatches items of the lists in input
+// order, or the last ones when --tac is set
+func (m *Matcher) limitUnsorted(lists [][]*Item) []*Item {
+	matches := []*Item{}
+	for _, list := range lists {
+		matches = append(matches, list...)
 	}
-	return NewMerger(partialResults, m.sort, m.tac), false
+	if len(matches) <= m.maxMatches {
+		return matches
+	}
+	if m.tac {
+		return matches[len(matches)-m.maxMatches:]
+	}
+	return matches[:m.maxMatches]
+}
+
+func (m *Matcher) partialMerger(lists [][]*Item) *Merger {
+	partial := make([][]*Item, len(lists))
+	for idx, list := range lists {
+		partial[idx] = make([]*Item, len(list))
+		copy(partial[idx], list)
+		if m.sort {
+			sortItems(partial[idx], m.tac)
+		}
+	}
+	return NewMerger(partial, m.sort, m.tac)
 }
 
 // Reset is called to interrupt/signal the ongoing search
-func (m *Matcher) Reset(chunks []*Chunk, patternRunes []rune, cancel bool, final bool, sort bool) {
+func (m *Matcher) Reset(chunks []*Chunk, patternRunes []rune, cancel bool, final bool, sort bool, revision int) {
 	pattern := m.patternBuilder(patternRunes)
 
 	var event util.EventType
@@ -217,5 +638,31 @@ func (m *Matcher) Reset(chunks []*Chunk, patternRunes []rune, cancel bool, final
 	} else {
 		event = reqRetry
 	}
-	m.reqBox.Set(event, MatchRequest{chunks, pattern, final, sort})
+	m.reqBox.Set(event, MatchRequest{chunks, pattern, final, sort, revision})
+}
+
+// SetSecondary updates the pattern for the secondary list. The pattern is
+// independent of the one for the main list which is given to Reset.
+func (m *Matcher) SetSecondary(patternRunes []rune) {
+	pattern := m.patternBuilder(patternRunes)
+	m.secondaryMutex.Lock()
+	m.secondary = pattern
+	m.secondaryMutex.Unlock()
+}
+
+// MatchSecondary synchronously filters the given list of items with the
+// secondary pattern. The result is sorted when sort is set.
+func (m *Matcher) MatchSecondary(items []*Item, sort bool) *Merger {
+	m.secondaryMutex.Lock()
+	pattern := m.secondary
+	m.secondaryMutex.Unlock()
+
+	if pattern.IsEmpty() {
+		return NewMerger([][]*Item{items}, false, false)
+	}
+	matches := pattern.MatchItems(items)
+	if sort {
+		sortItems(matches, m.tac)
+	}
+	return NewMerger([][]*Item{matches}, false, false)
 }
@@ -0,0 +1,146 @@
+package fzf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSliceChunks(t *testing.T) {
+	m := Matcher{partitions: 4}
+	chunks := make([]*Chunk, 10)
+	for i := range chunks {
+		chunks[i] = &Chunk{}
+	}
+
+	check := func(numChunks int, expected ...int) {
+		slices := m.sliceChunks(chunks[:numChunks])
+		if len(slices) != len(expected) {
+			t.Errorf("Expected %d slices, got %d", len(expected), len(slices))
+			return
+		}
+		for idx, slice := range slices {
+			if len(slice) != expected[idx] {
+				t.Errorf("Expected %v, got %d at %d", expected, len(slice), idx)
+			}
+		}
+	}
+	check(10, 2, 2, 2, 4)
+	check(8, 2, 2, 2, 2)
+	check(3, 1, 1, 1)
+	check(0)
+}
+
+func TestLimitUnsorted(t *testing.T) {
+	lists := [][]*Item{}
+	index := int32(0)
+	for _, size := range []int{3, 0, 4, 2} {
+		list := []*Item{}
+		for i := 0; i < size; i++ {
+			list = append(list, &Item{rank: buildEmptyRank(index)})
+			index++
+		}
+		lists = append(lists, list)
+	}
+
+	check := func(tac bool, max int, first int32, last int32) {
+		m := Matcher{tac: tac, maxMatches: max}
+		matches := m.limitUnsorted(lists)
+		if matches[0].Index() != first || matches[len(matches)-1].Index() != last {
+			t.Errorf("Expected %d..%d, got %d..%d",
+				first, last, matches[0].Index(), matches[len(matches)-1].Index())
+		}
+	}
+	check(false, 5, 0, 4)
+	check(true, 5, 4, 8)
+	check(false, 100, 0, 8)
+	check(true, 100, 0, 8)
+}
+
+func TestScanForFilter(t *testing.T) {
+	defer clearPatternCache()
+	clearPatternCache()
+	sortCriteria = []criterion{byMatchLen, byLength}
+	m := NewMatcher(func(runes []rune) *Pattern {
+		return BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, runes)
+	}, true, false, 0, "", nil, nil)
+	chunks := buildIndexedChunks("f_o_o", "foobar", "xyz", "foo", "fo_o")
+
+	// Matches are sorted by the length of the matched substring, then by the
+	// length of the line, just like in the interactive finder
+	merger, cancelled := m.scan(MatchRequest{
+		chunks:  chunks,
+		pattern: m.patternBuilder([]rune("foo")),
+		final:   true})
+	expected := []string{"foo", "foobar", "fo_o", "f_o_o"}
+	if cancelled || merger.Length() != len(expected) {
+		t.Fatalf("Unexpected result: %d", merger.Length())
+	}
+	for idx, str := range expected {
+		if item := merger.Get(idx); item.AsString(false) != str {
+			t.Errorf("Expected %s at %d, got %s", str, idx, item.AsString(false))
+		}
+	}
+
+	// Same result with a single worker running at a time
+	m.SetThrottle(1)
+	throttled, _ := m.scan(MatchRequest{
+		chunks:  chunks,
+		pattern: m.patternBuilder([]rune("foo")),
+		final:   true})
+	if throttled.Length() != merger.Length() || throttled.Get(0).Index() != merger.Get(0).Index() {
+		t.Error("Unexpected result with throttle")
+	}
+	m.SetThrottle(0)
+
+	// Empty pattern
+	merger, _ = m.scan(MatchRequest{chunks: chunks, pattern: m.patternBuilder([]rune{})})
+	if merger.Length() != 5 || merger.Get(2).AsString(false) != "xyz" {
+		t.Error("Should return all items in the original order")
+	}
+
+	// Empty pattern with --max-matches
+	m.maxMatches = 2
+	merger, _ = m.scan(MatchRequest{chunks: chunks, pattern: m.patternBuilder([]rune{})})
+	if merger.Length() != 2 || merger.Get(1).AsString(false) != "foobar" {
+		t.Error("Should return the first items")
+	}
+	m.tac = true
+	merger, _ = m.scan(MatchRequest{chunks: chunks, pattern: m.patternBuilder([]rune{})})
+	if merger.Length() != 2 || merger.Get(0).AsString(false) != "fo_o" || merger.Get(1).AsString(false) != "foo" {
+		t.Error("Should return the last items in the reverse order")
+	}
+	m.tac, m.maxMatches = false, 0
+
+	// Only the actual scan is counted
+	if stats := m.Stats(); stats.Scans != 2 || stats.ScannedItems != 10 ||
+		stats.WorkerSlots < stats.WorkerTime {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestMatcherStats(t *testing.T) {
+	stats := MatcherStats{}
+	if stats.AverageLatency() != 0 || stats.Throughput() != 0 ||
+		stats.CacheHitRate() != 0 || stats.Utilization() != 0 {
+		t.Error("Should be zero without any query", stats)
+	}
+
+	stats = MatcherStats{
+		Queries:      4,
+		CacheHits:    1,
+		TotalLatency: 40 * time.Millisecond,
+		MaxLatency:   20 * time.Millisecond,
+		ScannedItems: 1000,
+		ScanTime:     100 * time.Millisecond,
+		WorkerTime:   300 * time.Millisecond,
+		WorkerSlots:  400 * time.Millisecond}
+	if stats.AverageLatency() != 10*time.Millisecond || stats.Throughput() != 10000 ||
+		stats.CacheHitRate() != 0.25 || stats.Utilization() != 0.75 {
+		t.Error("Unexpected metrics", stats)
+	}
+	expected := "queries: 4 (cancelled: 0), latency: 10ms (avg) / 20ms (max), " +
+		"throughput: 10000 items/sec, cache hit rate: 0.25, utilization: 0.75"
+	if stats.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, stats.String())
+	}
+}
@@ -1,6 +1,11 @@
 package fzf
 
-import "fmt"
+import (
+	"container/heap"
+	"fmt"
+
+	"github.com/junegunn/fzf/src/util"
+)
 
 // Merger with no data
 var EmptyMerger = NewMerger([][]*Item{}, false, false)
@@ -12,6 +17,9 @@ type Merger struct {
 	merged  []*Item
 	chunks  *[]*Chunk
 	cursors []int
+	heap    *mergeHeap
+	top     []*Item
+	base    *Merger
 	sorted  bool
 	tac     bool
 	final   bool
@@ -57,6 +65,13 @@ func (mg *Merger) Length() int {
 
 // Get returns the pointer to the Item object indexed by the given integer
 func (mg *Merger) Get(idx int) *Item {
+	if mg.base != nil {
+		if idx < len(mg.top) {
+			return mg.top[idx]
+		}
+		return mg.base.Get(idx)
+	}
+
 	if mg.chunks != nil {
 		if mg.tac {
 			idx = mg.count - idx - 1
@@ -82,37 +97,147 @@ func (mg *Merger) Get(idx int) *Item {
 	panic(fmt.Sprintf("Index out of bounds (unsorted, %d/%d)", idx, mg.count))
 }
 
+// Top returns the copy of the first n items
+func (mg *Merger) Top(n int) []*Item {
+	n = util.Min(n, mg.count)
+	items := make([]*Item, n)
+	for i := 0; i < n; i++ {
+		items[i] = mg.Get(i)
+	}
+	return items
+}
+
+// Refine returns a new Merger that replaces the first items of the Merger
+// with the given list. The list is expected to be a reordering of what Top
+// returns for the same number of items.
+func (mg *Merger) Refine(top []*Item) *Merger {
+	return &Merger{
+		top:    top,
+		base:   mg,
+		sorted: mg.sorted,
+		tac:    mg.tac,
+		final:  mg.final,
+		count:  mg.count}
+}
+
 func (mg *Merger) cacheable() bool {
 	return mg.count < mergerCacheMax
 }
 
+// mergeHeap is a min-heap of list indexes ordered by the rank of the item at
+// the cursor of each list
+type mergeHeap struct {
+	lists   [][]*Item
+	cursors []int
+	indexes []int
+	tac     bool
+}
+
+func (h *mergeHeap) head(i int) *Item {
+	listIdx := h.indexes[i]
+	return h.lists[listIdx][h.cursors[listIdx]]
+}
+
+func (h *mergeHeap) Len() int {
+	return len(h.indexes)
+}
+
+func (h *mergeHeap) Less(i, j int) bool {
+	return compareItems(h.head(i), h.head(j), h.tac)
+}
+
+func (h *mergeHeap) Swap(i, j int) {
+	h.indexes[i], h.indexes[j] = h.indexes[j], h.indexes[i]
+}
+
+func (h *mergeHeap) Push(x interface{}) {
+	h.indexes = append(h.indexes, x.(int))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	last := len(h.indexes) - 1
+	x := h.indexes[last]
+	h.indexes = h.indexes[:last]
+	return x
+}
+
 func (mg *Merger) mergedGet(idx int) *Item {
-	for i := len(mg.merged); i <= idx; i++ {
-		minRank := buildEmptyRank(0)
-		minIdx := -1
+	if mg.heap == nil {
+		mg.heap = &mergeHeap{
+			lists:   mg.lists,
+			cursors: mg.cursors,
+			indexes: make([]int, 0, len(mg.lists)),
+			tac:     mg.tac}
 		for listIdx, list := range mg.lists {
-			cursor := mg.cursors[listIdx]
-			if cursor < 0 || cursor == len(list) {
-				mg.cursors[listIdx] = -1
-				continue
-			}
-			if cursor >= 0 {
-				rank := list[cursor].Rank(false)
-				if minIdx < 0 || compareRanks(rank, minRank, mg.tac) {
-					minRank = rank
-					minIdx = listIdx
-				}
+			if len(list) > 0 {
+				mg.heap.indexes = append(mg.heap.indexes, listIdx)
 			}
-			mg.cursors[listIdx] = cursor
 		}
+		heap.Init(mg.heap)
+	}
 
-		if minIdx >= 0 {
-			chosen := mg.lists[minIdx]
-			mg.merged = append(mg.merged, chosen[mg.cursors[minIdx]])
-			mg.cursors[minIdx]++
-		} else {
+	// Only materialize as many items as requested
+	for i := len(mg.merged); i <= idx; i++ {
+		if mg.heap.Len() == 0 {
 			panic(fmt.Sprintf("Index out of bounds (sorted, %d/%d)", i, mg.count))
 		}
+		listIdx := mg.heap.indexes[0]
+		mg.merged = append(mg.merged, mg.heap.head(0))
+		mg.cursors[listIdx]++
+		if mg.cursors[listIdx] < len(mg.lists[listIdx]) {
+			heap.Fix(mg.heap, 0)
+		} else {
+			heap.Pop(mg.heap)
+		}
 	}
 	return mg.merged[idx]
 }
+
+// boundedHeap retains the best max items added to it. It is a max-heap that
+// has the worst of the retained items at the top.
+type boundedHeap struct {
+	items []*Item
+	max   int
+	tac   bool
+}
+
+func newBoundedHeap(max int, tac bool) *boundedHeap {
+	return &boundedHeap{
+		items: []*Item{},
+		max:   max,
+		tac:   tac}
+}
+
+func (h *boundedHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *boundedHeap) Less(i, j int) bool {
+	return compareItems(h.items[j], h.items[i], h.tac)
+}
+
+func (h *boundedHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *boundedHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(*Item))
+}
+
+func (h *boundedHeap) Pop() interface{} {
+	last := len(h.items) - 1
+	x := h.items[last]
+	h.items = h.items[:last]
+	return x
+}
+
+func (h *boundedHeap) addAll(items []*Item) {
+	for _, item := range items {
+		if len(h.items) < h.max {
+			heap.Push(h, item)
+		} else if compareItems(item, h.items[0], h.tac) {
+			h.items[0] = item
+			heap.Fix(h, 0)
+		}
+	}
+}
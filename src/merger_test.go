@@ -5,6 +5,8 @@ import (
 	"math/rand"
 	"sort"
 	"testing"
+
+	"github.com/junegunn/fzf/src/util"
 )
 
 func assert(t *testing.T, cond bool, msg ...string) {
@@ -91,3 +93,166 @@ func TestMergerSorted(t *testing.T) {
 		}
 	}
 }
+
+func TestMergerLazy(t *testing.T) {
+	lists, items := buildLists(true)
+	if len(items) == 0 {
+		return
+	}
+	mg := NewMerger(lists, true, false)
+	sort.Sort(ByRelevance(items))
+	if mg.Get(0) != items[0] {
+		t.Error("Not sorted", items[0], mg.Get(0))
+	}
+	if len(mg.merged) != 1 {
+		t.Error("Should only materialize the requested items", len(mg.merged))
+	}
+}
+
+func TestMergerRefine(t *testing.T) {
+	lists, items := buildLists(true)
+	if len(items) < 2 {
+		return
+	}
+	mg := NewMerger(lists, true, false)
+	top := mg.Top(2)
+	if len(top) != 2 || top[0] != mg.Get(0) || top[1] != mg.Get(1) {
+		t.Error("Invalid top items", top)
+	}
+	refined := mg.Refine([]*Item{top[1], top[0]})
+	if refined.Length() != mg.Length() ||
+		refined.Get(0) != mg.Get(1) || refined.Get(1) != mg.Get(0) {
+		t.Error("Top items should be replaced")
+	}
+	for i := 2; i < mg.Length(); i++ {
+		if refined.Get(i) != mg.Get(i) {
+			t.Error("Should return the rest of the items as they are", i)
+		}
+	}
+	if len(mg.Top(len(items)+1)) != len(items) {
+		t.Error("Should not return more than the number of items")
+	}
+}
+
+func TestMergerStableOrder(t *testing.T) {
+	// Items with identical scores, scattered across the lists in random order
+	numItems := 100
+	lists := make([][]*Item, 4)
+	for _, idx := range rand.Perm(numItems) {
+		item := &Item{
+			text:    []rune("foobar"),
+			rank:    buildEmptyRank(int32(idx)),
+			offsets: []Offset{Offset{0, 3, 6}}}
+		listIdx := rand.Int() % len(lists)
+		lists[listIdx] = append(lists[listIdx], item)
+	}
+	for _, tac := range []bool{false, true} {
+		for _, list := range lists {
+			sortItems(list, tac)
+		}
+		mg := NewMerger(lists, true, tac)
+		for i := 0; i < numItems; i++ {
+			expected := int32(i)
+			if tac {
+				expected = int32(numItems - i - 1)
+			}
+			if mg.Get(i).Index() != expected {
+				t.Errorf("Expected index %d, got %d (tac: %v)", expected, mg.Get(i).Index(), tac)
+			}
+		}
+	}
+}
+
+func TestMergerComparator(t *testing.T) {
+	sortCriteria = []criterion{byMatchLen, byLength}
+	tiebreaker = func(a *Item, b *Item) int {
+		// Buffers before files
+		return int(a.text[0]) - int(b.text[0])
+	}
+	defer func() { tiebreaker = nil }()
+
+	newItem := func(str string, idx int32) *Item {
+		return &Item{
+			text:    []rune(str),
+			rank:    buildEmptyRank(idx),
+			offsets: []Offset{Offset{1, 4, 6}}}
+	}
+	lists := [][]*Item{
+		{newItem("f:foo", 0), newItem("b:foo", 1)},
+		{newItem("f:fooo", 2), newItem("b:bar", 3), newItem("b:baz", 4)}}
+	for _, tac := range []bool{false, true} {
+		for _, list := range lists {
+			sortItems(list, tac)
+		}
+		mg := NewMerger(lists, true, tac)
+		expected := []int32{1, 3, 4, 0, 2}
+		if tac {
+			expected = []int32{4, 3, 1, 0, 2}
+		}
+		for i, idx := range expected {
+			if mg.Get(i).Index() != idx {
+				t.Errorf("Expected index %d at %d, got %d (tac: %v)", idx, i, mg.Get(i).Index(), tac)
+			}
+		}
+	}
+}
+
+func TestMergerTac(t *testing.T) {
+	lists, items := buildLists(false)
+	cnt := len(items)
+
+	// Not sorted: reverse order
+	mg := NewMerger(lists, false, true)
+	assert(t, cnt == mg.Length(), "Invalid Length")
+	for i := 0; i < cnt; i++ {
+		assert(t, items[cnt-i-1] == mg.Get(i), "Invalid Get")
+	}
+}
+
+func TestPassMergerTac(t *testing.T) {
+	chunks := []*Chunk{}
+	items := []*Item{}
+	for i := 0; i < chunkSize*2+3; i++ {
+		if i%chunkSize == 0 {
+			chunk := Chunk(make([]*Item, 0, chunkSize))
+			chunks = append(chunks, &chunk)
+		}
+		item := randItem()
+		last := chunks[len(chunks)-1]
+		*last = append(*last, item)
+		items = append(items, item)
+	}
+
+	cnt := len(items)
+	for _, tac := range []bool{false, true} {
+		mg := PassMerger(&chunks, tac)
+		assert(t, cnt == mg.Length(), "Invalid Length")
+		for i := 0; i < cnt; i++ {
+			expected := items[i]
+			if tac {
+				expected = items[cnt-i-1]
+			}
+			assert(t, expected == mg.Get(i), "Invalid Get")
+		}
+	}
+}
+
+func TestBoundedHeap(t *testing.T) {
+	_, items := buildLists(false)
+	for _, tac := range []bool{false, true} {
+		h := newBoundedHeap(5, tac)
+		h.addAll(items)
+		sortItems(h.items, tac)
+		sortItems(items, tac)
+
+		expected := util.Min(5, len(items))
+		if len(h.items) != expected {
+			t.Errorf("Expected %d items, got %d", expected, len(h.items))
+		}
+		for i, item := range h.items {
+			if item != items[i] {
+				t.Error("Not the best items", item, items[i])
+			}
+		}
+	}
+}
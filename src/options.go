@@ -1,6 +1,8 @@
 package fzf
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"regexp"
 	"strconv"
@@ -12,7 +14,7 @@ import (
 	"github.com/junegunn/go-shellwords"
 )
 
-const usage = `usage: fzf [options]
+const usage = `usage: fzf [options] [FILE...]
 
   Search
     -x, --extended        Extended-search mode
@@ -25,41 +27,144 @@ const usage = `usage: fzf [options]
                           integer or a range expression ([BEGIN]..[END]).
     --with-nth=N[,..]     Transform item using index expressions within finder
     -d, --delimiter=STR   Field delimiter regex for --nth (default: AWK-style)
+    --highlight-nth       Dim the fields outside of the search scope of --nth
     +s, --no-sort         Do not sort the result
     --tac                 Reverse the order of the input
+    --unique              Remove duplicate lines from the input
+    --intern              Share the memory of the duplicate lines in the
+                          input
+    --tail=N              Only keep about the last N items of the input
+                          (default: 0, no limit)
+    --source=[TAG]:CMD    Read items from the command, prefixed with the tag
+                          and a tab character if given (can be repeated)
+    --command=CMD         Read items from the command run by fzf instead of
+                          standard input. Run again by reload without command
+    --follow=FILE         Read items from the file, and keep reading the lines
+                          appended to it like tail -f
+    --walker=OPTS         Entries to list with the built-in file walker when
+                          the input is a terminal (default: file)
+                          [file][,dir][,follow][,hidden][,skip-links]
+    --walker-depth=N      Maximum depth of the entries to list (default: 0,
+                          no limit)
+    --no-walker-ignore    Do not skip the paths in .gitignore and .ignore
+                          files and .git directories
+    --payload-delimiter=STR
+                          The part of each line after STR is not displayed
+                          or matched, but printed on selection
+    --input-filter=CMD    Build items from the lines the command prints for
+                          the input lines, printing the original lines
     --tiebreak=CRI[,..]   Comma-separated list of sort criteria to apply
                           when the scores are tied;
                           [length|begin|end|index] (default: length)
+    --max-matches=N       Maximum number of matches to retain (default: 0,
+                          no limit)
+    --index=FILE          Index file to speed up repeated searches on
+                          the same static input
+    --result-cache=FILE   File to store the results of the recent queries
+                          for the same static input
+    --chunk-size=N        Number of items in each chunk of the input
+                          (default: 100)
 
   Interface
-    -m, --multi           Enable multi-select with tab/shift-tab
+    -m, --multi[=MAX]     Enable multi-select with tab/shift-tab
+    --selected-pane[=OPT] Display the selected items in a pane (default:
+                          down:30%) [up|down|left|right][:SIZE[%]][:hidden]
     --ansi                Enable processing of ANSI color codes
     --no-mouse            Disable mouse
     --color=COLSPEC       Base scheme (dark|light|16|bw) and/or custom colors
     --black               Use black background
-    --reverse             Reverse orientation
+    --no-auto-theme       Do not choose the colors for the background of the
+                          terminal detected with OSC 11 query
+    --plain               Plain output without colors, text attributes, spinner
+                          and horizontal scroll for screen readers
+    --bell                Ring the bell when no item matches the query
+    --layout=LAYOUT       Choose layout: [default|reverse|reverse-list]
+    --reverse             A synonym for --layout=reverse
     --margin=MARGIN       Screen margin (TRBL / TB,RL / T,RL,B / T,R,B,L)
+    --height=HEIGHT[%]    Display fzf below the cursor with the given height
+                          instead of using fullscreen
+    --no-alt-screen       Do not switch to the alternate screen in fullscreen mode
+    --no-clear            Do not clear the finder on exit
+    --tmux[=OPTS]         Start fzf in a tmux popup when running inside tmux
+                          [center|top|bottom|left|right][,SIZE[%]][,SIZE[%]]
+                          (default: center,50%)
+    --border[=STYLE]      Draw border around the finder
+                          [rounded|sharp|double|horizontal] (default: rounded)
+    --border-label=LABEL  Label to print on the border
+    --border-label-pos=N[:top|:bottom]
+                          Position of the border label (default: 0 (center))
     --tabstop=SPACES      Number of spaces for a tab character (default: 8)
     --cycle               Enable cyclic scroll
+    --track               Keep the cursor on the same item when the list is
+                          updated
+    --tree                Display the paths as an indented tree
+    --annotation          Display the last field of each item split by
+                          --delimiter on the right end of the line
+    --index-column[=TYPE] Display the index of each item in a column
+                          [input|visible] (default: input)
     --no-hscroll          Disable horizontal scroll
+    --wrap                Wrap long items instead of truncating them
+    --keep-right          Keep the right end of the line visible on overflow
+    --ellipsis=STR        Ellipsis to show on line overflow (default: '..')
     --hscroll-off=COL     Number of screen columns to keep to the right of the
                           highlighted substring (default: 10)
-    --inline-info         Display finder info inline with the query
+    --scroll-off=LINES    Number of screen lines to keep above or below when
+                          scrolling to the top or to the bottom (default: 0)
+    --info=STYLE          Finder info style
+                          [default|inline[:SEPARATOR]|hidden]
+    --info-format=FMT     Template of the info line with {matched}, {total},
+                          {selected}, {current}, and {progress}
+    --inline-info         A synonym for --info=inline
     --prompt=STR          Input prompt (default: '> ')
+    --pointer=STR         Pointer to the current line (default: '>')
+    --marker=STR          Multi-select marker (default: '>')
+    --spinner=CHARS       Frames of the spinner for streaming input
+                          (default: '-\|/')
+    --selected-counter=FMT
+                          Format of the number of the selected items where
+                          %s is replaced with the number (default: '(%s)')
+    --jump-labels=CHARS   Label characters for jump and jump-accept
     --bind=KEYBINDS       Custom key bindings. Refer to the man page.
+    --vi                  Enable vi editing mode for the query
+    --no-clipboard        Disable copy actions using OSC 52 escape sequence
+    --paste-first-line    Insert only the first line of the pasted text
+    --word-delimiters=CHARS
+                          Characters separating words in the query for word
+                          movement and deletion (e.g. '/-_.')
     --history=FILE        History file
     --history-size=N      Maximum number of history entries (default: 1000)
+    --boost-accepted=FILE File to record the accepted items, which are ranked
+                          higher in the subsequent sessions
     --header=STR          String to print as header
     --header-lines=N      The first N lines of the input are treated as header
+    --header-first        Print header before the prompt line
+    --footer=STR          String to print as footer at the other end of the list
+
+  Preview
+    --preview=COMMAND     Command to preview highlighted line ({})
+    --preview-window=OPT  Preview window layout (default: right:50%)
+                          [up|down|left|right][:SIZE[%]][:hidden][:follow]
+                          [:highlight][:+SCROLL[-OFFSET]]
+    --preview-label=LABEL Label to print on the border of the preview window
+    --preview-label-pos=N[:top|:bottom]
+                          Position of the preview label (default: 0 (center))
 
   Scripting
     -q, --query=STR       Start the finder with the given query
     -1, --select-1        Automatically select the only match
     -0, --exit-0          Exit immediately when there's no match
     -f, --filter=STR      Filter mode. Do not start interactive finder.
-    --print-query         Print query as the first line
+    --print-query         Print query as the first line (also on abort)
+    --read0               Read input delimited by ASCII NUL characters
+    --decompress          Decompress standard input compressed with gzip or
+                          zstd (files are always decompressed)
+    --print0              Print output delimited by ASCII NUL characters
     --expect=KEYS         Comma-separated list of keys to complete fzf
     --sync                Synchronous search for multi-staged filtering
+    --throttle=N          Limit the number of processors used for matching
+                          (default: 0, no limit)
+    --stats=FILE          Write the performance metrics of the matcher to
+                          the file on exit
 
   Environment variables
     FZF_DEFAULT_COMMAND   Default command to use when input is tty
@@ -67,6 +172,16 @@ const usage = `usage: fzf [options]
 
 `
 
+// Default symbols of the finder info
+const (
+	defaultSpinner         = `-\|/`
+	defaultInfoSep         = " < "
+	defaultSelectedCounter = "(%s)"
+)
+
+// Labels for the items in jump mode, starting from the keys on the home row
+const defaultJumpLabels = "asdfghjklqwertyuiopzxcvbnm1234567890ASDFGHJKLQWERTYUIOPZXCVBNM`~;:,<.>/?'\"!@#$%^&*()[{]}-_=+"
+
 // Case denotes case-sensitivity of search
 type Case int
 
@@ -87,49 +202,153 @@ const (
 	byEnd
 )
 
+// Styles of the finder info
+type infoStyle int
+
+const (
+	infoDefault infoStyle = iota
+	infoInline
+	infoHidden
+)
+
+// Styles of the border around the finder
+type borderStyle int
+
+const (
+	borderNone borderStyle = iota
+	borderRounded
+	borderSharp
+	borderDouble
+	borderHorizontal
+)
+
+// Numbers in the index column in front of the items
+type indexColumn int
+
+const (
+	indexNone indexColumn = iota
+	indexInput
+	indexVisible
+)
+
+// labelOpts is a label on the border and its position. A positive offset is
+// the column from the left end, a negative one from the right end, and 0
+// places the label at the center. The label is on the bottom line of the
+// border if bottom is set.
+type labelOpts struct {
+	label  string
+	offset int
+	bottom bool
+}
+
+// Layouts of the finder
+type layoutType int
+
+const (
+	layoutDefault layoutType = iota
+	layoutReverse
+	layoutReverseList
+)
+
 func defaultMargin() [4]string {
 	return [4]string{"0", "0", "0", "0"}
 }
 
 // Options stores the values of command-line options
 type Options struct {
-	Fuzzy       bool
-	Extended    bool
-	Case        Case
-	Nth         []Range
-	WithNth     []Range
-	Delimiter   Delimiter
-	Sort        int
-	Tac         bool
-	Criteria    []criterion
-	Multi       bool
-	Ansi        bool
-	Mouse       bool
-	Theme       *curses.ColorTheme
-	Black       bool
-	Reverse     bool
-	Cycle       bool
-	Hscroll     bool
-	HscrollOff  int
-	InlineInfo  bool
-	Prompt      string
-	Query       string
-	Select1     bool
-	Exit0       bool
-	Filter      *string
-	ToggleSort  bool
-	Expect      map[int]string
-	Keymap      map[int]actionType
-	Execmap     map[int]string
-	PrintQuery  bool
-	ReadZero    bool
-	Sync        bool
-	History     *History
-	Header      []string
-	HeaderLines int
-	Margin      [4]string
-	Tabstop     int
-	Version     bool
+	Fuzzy         bool
+	Extended      bool
+	Case          Case
+	Nth           []Range
+	WithNth       []Range
+	HighlightNth  bool
+	Delimiter     Delimiter
+	Sort          int
+	Tac           bool
+	Unique        bool
+	Tail          int
+	Sources       []Source
+	Command       string
+	Follow        string
+	Files         []string
+	Decompress    bool
+	Walker        walkerOpts
+	Payload       PayloadSplitter
+	InputFilter   string
+	Transform     InputTransformer
+	Subscribe     func(EventBus)
+	Criteria      []criterion
+	Comparator    Comparator
+	MaxMatches    int
+	Index         string
+	ResultCache   *ResultCache
+	StatsFile     string
+	Multi         bool
+	MultiMax      int
+	Ansi          bool
+	Mouse         bool
+	Theme         *curses.ColorTheme
+	ColorSpecs    []string
+	AutoTheme     bool
+	Black         bool
+	Plain         bool
+	Bell          bool
+	Layout        layoutType
+	Cycle         bool
+	Track         bool
+	Tree          bool
+	Annotation    bool
+	IndexColumn   indexColumn
+	Hscroll       bool
+	HscrollOff    int
+	ScrollOff     int
+	Wrap          bool
+	KeepRight     bool
+	Ellipsis      string
+	Info          infoStyle
+	InfoSep       string
+	InfoFormat    string
+	Spinner       string
+	SelCounter    string
+	Prompt        string
+	Pointer       string
+	Marker        string
+	JumpLabels    string
+	WordDelims    string
+	Vi            bool
+	Clipboard     bool
+	PasteFirst    bool
+	AltScreen     bool
+	Clear         bool
+	Tmux          *tmuxOpts
+	Query         string
+	Select1       bool
+	Exit0         bool
+	Filter        *string
+	ToggleSort    bool
+	Throttle      int
+	Expect        map[int]string
+	Keymap        map[int][]action
+	PrintQuery    bool
+	ReadZero      bool
+	PrintZero     bool
+	Sync          bool
+	History       *History
+	BoostAccepted *History
+	Header        []string
+	Footer        []string
+	HeaderLines   int
+	HeaderFirst   bool
+	Margin        [4]string
+	Height        string
+	Border        borderStyle
+	BorderLabel   labelOpts
+	Preview       previewOpts
+	SelectedPane  *previewOpts
+	Tabstop       int
+	ChunkSize     int
+	Intern        bool
+	Version       bool
 }
 
 func defaultTheme() *curses.ColorTheme {
@@ -139,45 +358,130 @@ func defaultTheme() *curses.ColorTheme {
 	return curses.Default16
 }
 
+// hasBaseScheme tells if the base scheme of the colors is given in any of
+// the color specifications
+func hasBaseScheme(specs []string) bool {
+	for _, spec := range specs {
+		for _, str := range strings.Split(strings.ToLower(spec), ",") {
+			switch str {
+			case "dark", "light", "16", "bw", "no":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// autoTheme returns the theme to use for the background of the terminal. The
+// light theme replaces the default dark theme if the background is light,
+// unless the base scheme is explicitly given. The color specifications are
+// applied to it again.
+func autoTheme(opts *Options) *curses.ColorTheme {
+	if !opts.AutoTheme || opts.Theme == nil || defaultTheme() != curses.Dark256 ||
+		hasBaseScheme(opts.ColorSpecs) {
+		return opts.Theme
+	}
+	if light, ok := curses.IsLightBackground(); !ok || !light {
+		return opts.Theme
+	}
+	theme := curses.Light256
+	for _, spec := range opts.ColorSpecs {
+		theme = parseTheme(theme, spec)
+	}
+	return theme
+}
+
 func defaultOptions() *Options {
 	return &Options{
-		Fuzzy:       true,
-		Extended:    true,
-		Case:        CaseSmart,
-		Nth:         make([]Range, 0),
-		WithNth:     make([]Range, 0),
-		Delimiter:   Delimiter{},
-		Sort:        1000,
-		Tac:         false,
-		Criteria:    []criterion{byMatchLen, byLength},
-		Multi:       false,
-		Ansi:        false,
-		Mouse:       true,
-		Theme:       defaultTheme(),
-		Black:       false,
-		Reverse:     false,
-		Cycle:       false,
-		Hscroll:     true,
-		HscrollOff:  10,
-		InlineInfo:  false,
-		Prompt:      "> ",
-		Query:       "",
-		Select1:     false,
-		Exit0:       false,
-		Filter:      nil,
-		ToggleSort:  false,
-		Expect:      make(map[int]string),
-		Keymap:      make(map[int]actionType),
-		Execmap:     make(map[int]string),
-		PrintQuery:  false,
-		ReadZero:    false,
-		Sync:        false,
-		History:     nil,
-		Header:      make([]string, 0),
-		HeaderLines: 0,
-		Margin:      defaultMargin(),
-		Tabstop:     8,
-		Version:     false}
+		Fuzzy:         true,
+		Extended:      true,
+		Case:          CaseSmart,
+		Nth:           make([]Range, 0),
+		WithNth:       make([]Range, 0),
+		HighlightNth:  false,
+		Delimiter:     Delimiter{},
+		Sort:          1000,
+		Tac:           false,
+		Unique:        false,
+		Tail:          0,
+		Sources:       []Source{},
+		Decompress:    false,
+		Walker:        defaultWalkerOpts(),
+		Payload:       nil,
+		InputFilter:   "",
+		Transform:     nil,
+		Subscribe:     nil,
+		Criteria:      []criterion{byMatchLen, byLength},
+		Comparator:    nil,
+		MaxMatches:    0,
+		Index:         "",
+		ResultCache:   nil,
+		StatsFile:     "",
+		Multi:         false,
+		MultiMax:      0,
+		Ansi:          false,
+		Mouse:         true,
+		Theme:         defaultTheme(),
+		ColorSpecs:    nil,
+		AutoTheme:     true,
+		Black:         false,
+		Plain:         false,
+		Bell:          false,
+		Layout:        layoutDefault,
+		Cycle:         false,
+		Track:         false,
+		Tree:          false,
+		Annotation:    false,
+		IndexColumn:   indexNone,
+		Hscroll:       true,
+		HscrollOff:    10,
+		ScrollOff:     0,
+		Wrap:          false,
+		KeepRight:     false,
+		Ellipsis:      "..",
+		Info:          infoDefault,
+		InfoSep:       defaultInfoSep,
+		InfoFormat:    "",
+		Spinner:       defaultSpinner,
+		SelCounter:    defaultSelectedCounter,
+		Prompt:        "> ",
+		Pointer:       ">",
+		Marker:        ">",
+		JumpLabels:    defaultJumpLabels,
+		Vi:            false,
+		Clipboard:     true,
+		PasteFirst:    false,
+		AltScreen:     true,
+		Clear:         true,
+		Tmux:          nil,
+		Query:         "",
+		Select1:       false,
+		Exit0:         false,
+		Filter:        nil,
+		ToggleSort:    false,
+		Throttle:      0,
+		Expect:        make(map[int]string),
+		Keymap:        make(map[int][]action),
+		PrintQuery:    false,
+		ReadZero:      false,
+		PrintZero:     false,
+		Sync:          false,
+		History:       nil,
+		BoostAccepted: nil,
+		Header:        make([]string, 0),
+		Footer:        nil,
+		HeaderLines:   0,
+		HeaderFirst:   false,
+		Margin:        defaultMargin(),
+		Height:        "",
+		Border:        borderNone,
+		BorderLabel:   labelOpts{},
+		Preview:       defaultPreviewOpts(""),
+		SelectedPane:  nil,
+		Tabstop:       8,
+		ChunkSize:     defaultChunkSize,
+		Intern:        false,
+		Version:       false}
 }
 
 func help(code int) {
@@ -344,8 +648,30 @@ func parseKeyChords(str string, message string) map[int]string {
 			chord = curses.SLeft
 		case "shift-right":
 			chord = curses.SRight
+		case "click":
+			chord = curses.Click
 		case "double-click":
 			chord = curses.DoubleClick
+		case "click-header":
+			chord = curses.ClickHeader
+		case "double-click-header":
+			chord = curses.DoubleClickHeader
+		case "click-border":
+			chord = curses.ClickBorder
+		case "double-click-border":
+			chord = curses.DoubleClickBorder
+		case "change":
+			chord = curses.Change
+		case "focus":
+			chord = curses.Focus
+		case "load":
+			chord = curses.Load
+		case "resize":
+			chord = curses.Resize
+		case "one":
+			chord = curses.One
+		case "zero":
+			chord = curses.Zero
 		default:
 			if len(key) == 6 && strings.HasPrefix(lkey, "ctrl-") && isAlphabet(lkey[5]) {
 				chord = curses.CtrlA + int(lkey[5]) - 'a'
@@ -366,6 +692,53 @@ func parseKeyChords(str string, message string) map[int]string {
 	return chords
 }
 
+// parseExpect adds the keys to the set of the keys that complete fzf. Events
+// cannot complete fzf as they are not pressed by the user.
+func parseExpect(expect map[int]string, str string) {
+	for key, name := range parseKeyChords(str, "key names required") {
+		switch key {
+		case curses.Change, curses.Focus, curses.Load, curses.Resize, curses.One, curses.Zero:
+			errorExit("unsupported key: " + name)
+		}
+		expect[key] = name
+	}
+}
+
+func payloadSplitter(delimiter string) PayloadSplitter {
+	if len(delimiter) == 0 {
+		errorExit("payload delimiter required")
+	}
+	delim := []byte(delimiter)
+	return func(data []byte) ([]byte, []byte) {
+		idx := bytes.Index(data, delim)
+		if idx < 0 {
+			return data, nil
+		}
+		return data[:idx], data[idx+len(delim):]
+	}
+}
+
+// parseSource parses TAG:COMMAND. The tag can be empty for the command
+// whose output is not prefixed.
+func parseSource(str string) Source {
+	tokens := strings.SplitN(str, ":", 2)
+	if len(tokens) < 2 || len(tokens[1]) == 0 {
+		errorExit("invalid source: " + str + " (expected: [TAG]:COMMAND)")
+	}
+	if strings.ContainsAny(tokens[0], "\t\n") {
+		errorExit("invalid source tag: " + tokens[0])
+	}
+	return Source{Tag: tokens[0], Command: tokens[1]}
+}
+
+func parseMultiMax(str string) int {
+	max := atoi(str)
+	if max < 1 {
+		errorExit("maximum number of selections must be positive")
+	}
+	return max
+}
+
 func parseTiebreak(str string) []criterion {
 	criteria := []criterion{byMatchLen}
 	hasIndex := false
@@ -409,6 +782,20 @@ func dupeTheme(theme *curses.ColorTheme) *curses.ColorTheme {
 	return nil
 }
 
+// parseColor parses a color number of the 256-color palette, or a 24-bit
+// color in #rrggbb format which is approximated to the closest one in the
+// palette
+func parseColor(str string) (int, error) {
+	if strings.HasPrefix(str, "#") {
+		rgb, err := strconv.ParseUint(str[1:], 16, 24)
+		if err != nil || len(str) != 7 {
+			return 0, errors.New("invalid color: " + str)
+		}
+		return rgbTo256(int(rgb>>16), int(rgb>>8&0xff), int(rgb&0xff)), nil
+	}
+	return strconv.Atoi(str)
+}
+
 func parseTheme(defaultTheme *curses.ColorTheme, str string) *curses.ColorTheme {
 	theme := dupeTheme(defaultTheme)
 	for _, str := range strings.Split(strings.ToLower(str), ",") {
@@ -434,7 +821,7 @@ func parseTheme(defaultTheme *curses.ColorTheme, str string) *curses.ColorTheme
 			if len(pair) != 2 {
 				fail()
 			}
-			ansi32, err := strconv.Atoi(pair[1])
+			ansi32, err := parseColor(pair[1])
 			if err != nil || ansi32 < -1 || ansi32 > 255 {
 				fail()
 			}
@@ -466,6 +853,14 @@ func parseTheme(defaultTheme *curses.ColorTheme, str string) *curses.ColorTheme
 				theme.Selected = ansi
 			case "header":
 				theme.Header = ansi
+			case "border":
+				theme.Border = ansi
+			case "nth":
+				theme.Nth = ansi
+			case "dim":
+				theme.Dim = ansi
+			case "annotation":
+				theme.Annotation = ansi
 			default:
 				fail()
 			}
@@ -488,19 +883,48 @@ const (
 	escapedComma = 1
 )
 
-func parseKeymap(keymap map[int]actionType, execmap map[int]string, str string) {
+// maskCommandActions replaces the arguments of the actions taking a command
+// with spaces so that the separators in them are not mistaken for the ones
+// between the actions
+func maskCommandActions(str string) string {
 	if executeRegexp == nil {
 		// Backreferences are not supported.
 		// "~!@#$%^&*;/|".each_char.map { |c| Regexp.escape(c) }.map { |c| "#{c}[^#{c}]*#{c}" }.join('|')
 		executeRegexp = regexp.MustCompile(
-			"(?s):execute(-multi)?:.*|:execute(-multi)?(\\([^)]*\\)|\\[[^\\]]*\\]|~[^~]*~|![^!]*!|@[^@]*@|\\#[^\\#]*\\#|\\$[^\\$]*\\$|%[^%]*%|\\^[^\\^]*\\^|&[^&]*&|\\*[^\\*]*\\*|;[^;]*;|/[^/]*/|\\|[^\\|]*\\|)")
+			"(?s)[:+](execute(-multi|-silent)?|reload(-sync)?|append|become|print|transform(-query|-prompt|-header)?|change-(border-label|preview-label|preview-window|preview|prompt|header|footer)):.*|[:+](execute(-multi|-silent)?|reload(-sync)?|append|become|print|transform(-query|-prompt|-header)?|change-(border-label|preview-label|preview-window|preview|prompt|header|footer))(\\([^)]*\\)|\\[[^\\]]*\\]|~[^~]*~|![^!]*!|@[^@]*@|\\#[^\\#]*\\#|\\$[^\\$]*\\$|%[^%]*%|\\^[^\\^]*\\^|&[^&]*&|\\*[^\\*]*\\*|;[^;]*;|/[^/]*/|\\|[^\\|]*\\|)")
 	}
-	masked := executeRegexp.ReplaceAllStringFunc(str, func(src string) string {
-		if strings.HasPrefix(src, ":execute-multi") {
-			return ":execute-multi(" + strings.Repeat(" ", len(src)-len(":execute-multi()")) + ")"
-		}
-		return ":execute(" + strings.Repeat(" ", len(src)-len(":execute()")) + ")"
+	return executeRegexp.ReplaceAllStringFunc(str, func(src string) string {
+		// The preceding character is either ':' or '+' of the chained actions
+		name := commandActionName(src[1:])
+		return src[:1] + name + "(" + strings.Repeat(" ", len(src)-len(name)-3) + ")"
 	})
+}
+
+// parseActions parses the actions chained with '+'. The masked string is the
+// one from maskCommandActions for the original string.
+func parseActions(masked string, str string) ([]action, error) {
+	actions := []action{}
+	idx := 0
+	for _, maskedAct := range strings.Split(masked, "+") {
+		act := str[idx : idx+len(maskedAct)]
+		idx += len(maskedAct) + 1
+		a, err := parseAction(act)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// parseActionList parses the list of actions given at runtime, e.g. the
+// output of the command of transform action
+func parseActionList(str string) ([]action, error) {
+	return parseActions(maskCommandActions(":" + str)[1:], str)
+}
+
+func parseKeymap(keymap map[int][]action, str string) {
+	masked := maskCommandActions(str)
 	masked = strings.Replace(masked, "::", string([]rune{escapedColon, ':'}), -1)
 	masked = strings.Replace(masked, ",:", string([]rune{escapedComma, ':'}), -1)
 
@@ -523,112 +947,220 @@ func parseKeymap(keymap map[int]actionType, execmap map[int]string, str string)
 			key = firstKey(keys)
 		}
 
-		act := origPairStr[len(pair[0])+1 : len(origPairStr)]
-		actLower := strings.ToLower(act)
-		switch actLower {
-		case "ignore":
-			keymap[key] = actIgnore
-		case "beginning-of-line":
-			keymap[key] = actBeginningOfLine
-		case "abort":
-			keymap[key] = actAbort
-		case "accept":
-			keymap[key] = actAccept
-		case "backward-char":
-			keymap[key] = actBackwardChar
-		case "backward-delete-char":
-			keymap[key] = actBackwardDeleteChar
-		case "backward-word":
-			keymap[key] = actBackwardWord
-		case "clear-screen":
-			keymap[key] = actClearScreen
-		case "delete-char":
-			keymap[key] = actDeleteChar
-		case "delete-char/eof":
-			keymap[key] = actDeleteCharEOF
-		case "end-of-line":
-			keymap[key] = actEndOfLine
-		case "cancel":
-			keymap[key] = actCancel
-		case "forward-char":
-			keymap[key] = actForwardChar
-		case "forward-word":
-			keymap[key] = actForwardWord
-		case "kill-line":
-			keymap[key] = actKillLine
-		case "kill-word":
-			keymap[key] = actKillWord
-		case "unix-line-discard", "line-discard":
-			keymap[key] = actUnixLineDiscard
-		case "unix-word-rubout", "word-rubout":
-			keymap[key] = actUnixWordRubout
-		case "yank":
-			keymap[key] = actYank
-		case "backward-kill-word":
-			keymap[key] = actBackwardKillWord
-		case "toggle-down":
-			keymap[key] = actToggleDown
-		case "toggle-up":
-			keymap[key] = actToggleUp
-		case "toggle-in":
-			keymap[key] = actToggleIn
-		case "toggle-out":
-			keymap[key] = actToggleOut
-		case "toggle-all":
-			keymap[key] = actToggleAll
-		case "select-all":
-			keymap[key] = actSelectAll
-		case "deselect-all":
-			keymap[key] = actDeselectAll
-		case "toggle":
-			keymap[key] = actToggle
-		case "down":
-			keymap[key] = actDown
-		case "up":
-			keymap[key] = actUp
-		case "page-up":
-			keymap[key] = actPageUp
-		case "page-down":
-			keymap[key] = actPageDown
-		case "previous-history":
-			keymap[key] = actPreviousHistory
-		case "next-history":
-			keymap[key] = actNextHistory
-		case "toggle-sort":
-			keymap[key] = actToggleSort
-		default:
-			if isExecuteAction(actLower) {
-				var offset int
-				if strings.HasPrefix(actLower, "execute-multi") {
-					keymap[key] = actExecuteMulti
-					offset = len("execute-multi")
-				} else {
-					keymap[key] = actExecute
-					offset = len("execute")
-				}
-				if act[offset] == ':' {
-					execmap[key] = act[offset+1:]
-				} else {
-					execmap[key] = act[offset+1 : len(act)-1]
-				}
+		actions, err := parseActions(pair[1], origPairStr[len(pair[0])+1:])
+		if err != nil {
+			errorExit(err.Error())
+		}
+		keymap[key] = actions
+	}
+}
+
+func parseAction(act string) (action, error) {
+	var t actionType
+	var arg string
+	actLower := strings.ToLower(act)
+	switch actLower {
+	case "ignore":
+		t = actIgnore
+	case "beginning-of-line":
+		t = actBeginningOfLine
+	case "abort":
+		t = actAbort
+	case "accept":
+		t = actAccept
+	case "accept-non-empty":
+		t = actAcceptNonEmpty
+	case "backward-char":
+		t = actBackwardChar
+	case "backward-delete-char":
+		t = actBackwardDeleteChar
+	case "backward-word":
+		t = actBackwardWord
+	case "clear-screen":
+		t = actClearScreen
+	case "delete-char":
+		t = actDeleteChar
+	case "delete-char/eof":
+		t = actDeleteCharEOF
+	case "end-of-line":
+		t = actEndOfLine
+	case "cancel":
+		t = actCancel
+	case "forward-char":
+		t = actForwardChar
+	case "forward-word":
+		t = actForwardWord
+	case "kill-line":
+		t = actKillLine
+	case "kill-word":
+		t = actKillWord
+	case "unix-line-discard", "line-discard":
+		t = actUnixLineDiscard
+	case "unix-word-rubout", "word-rubout":
+		t = actUnixWordRubout
+	case "yank":
+		t = actYank
+	case "yank-pop":
+		t = actYankPop
+	case "backward-kill-word":
+		t = actBackwardKillWord
+	case "toggle-down":
+		t = actToggleDown
+	case "toggle-up":
+		t = actToggleUp
+	case "toggle-in":
+		t = actToggleIn
+	case "toggle-out":
+		t = actToggleOut
+	case "toggle-all":
+		t = actToggleAll
+	case "select-all":
+		t = actSelectAll
+	case "deselect-all":
+		t = actDeselectAll
+	case "toggle":
+		t = actToggle
+	case "down":
+		t = actDown
+	case "up":
+		t = actUp
+	case "page-up":
+		t = actPageUp
+	case "page-down":
+		t = actPageDown
+	case "previous-history":
+		t = actPreviousHistory
+	case "next-history":
+		t = actNextHistory
+	case "toggle-sort":
+		t = actToggleSort
+	case "reload":
+		t = actReload
+	case "reload-sync":
+		t = actReloadSync
+	case "toggle-throttle":
+		t = actToggleThrottle
+	case "grow-preview":
+		t = actGrowPreview
+	case "shrink-preview":
+		t = actShrinkPreview
+	case "toggle-preview":
+		t = actTogglePreview
+	case "toggle-wrap":
+		t = actToggleWrap
+	case "toggle-track":
+		t = actToggleTrack
+	case "toggle-collapse":
+		t = actToggleCollapse
+	case "toggle-selected-pane":
+		t = actToggleSelectedPane
+	case "focus-selected-pane":
+		t = actFocusSelectedPane
+	case "copy":
+		t = actCopy
+	case "copy-selected":
+		t = actCopySelected
+	case "copy-query":
+		t = actCopyQuery
+	case "toggle-preview-follow":
+		t = actTogglePreviewFollow
+	case "preview-up":
+		t = actPreviewUp
+	case "preview-down":
+		t = actPreviewDown
+	case "preview-page-up":
+		t = actPreviewPageUp
+	case "preview-page-down":
+		t = actPreviewPageDown
+	case "preview-half-page-up":
+		t = actPreviewHalfPageUp
+	case "preview-half-page-down":
+		t = actPreviewHalfPageDown
+	case "clear-query":
+		t = actClearQuery
+	case "jump":
+		t = actJump
+	case "jump-accept":
+		t = actJumpAccept
+	default:
+		if isCommandAction(actLower) {
+			name := commandActionName(actLower)
+			switch name {
+			case "execute-multi":
+				t = actExecuteMulti
+			case "execute-silent":
+				t = actExecuteSilent
+			case "reload":
+				t = actReload
+			case "reload-sync":
+				t = actReloadSync
+			case "append":
+				t = actAppend
+			case "become":
+				t = actBecome
+			case "change-border-label":
+				t = actChangeBorderLabel
+			case "change-preview-label":
+				t = actChangePreviewLabel
+			case "change-footer":
+				t = actChangeFooter
+			case "change-header":
+				t = actChangeHeader
+			case "transform-header":
+				t = actTransformHeader
+			case "change-prompt":
+				t = actChangePrompt
+			case "change-preview":
+				t = actChangePreview
+			case "change-preview-window":
+				t = actChangePreviewWindow
+			case "print":
+				t = actPrint
+			case "transform":
+				t = actTransform
+			case "transform-query":
+				t = actTransformQuery
+			case "transform-prompt":
+				t = actTransformPrompt
+			default:
+				t = actExecute
+			}
+			offset := len(name)
+			if act[offset] == ':' {
+				arg = act[offset+1:]
 			} else {
-				errorExit("unknown action: " + act)
+				arg = act[offset+1 : len(act)-1]
+			}
+			if t == actChangePreviewWindow && len(arg) > 0 {
+				// Invalid layout is reported before the action is taken
+				if err := parsePreviewWindow(&previewOpts{}, arg); err != nil {
+					return action{}, err
+				}
 			}
+		} else {
+			return action{}, errors.New("unknown action: " + act)
 		}
 	}
+	return action{t: t, a: arg}, nil
 }
 
-func isExecuteAction(str string) bool {
-	if !strings.HasPrefix(str, "execute") || len(str) < len("execute()") {
-		return false
-	}
-	b := str[len("execute")]
-	if strings.HasPrefix(str, "execute-multi") {
-		if len(str) < len("execute-multi()") {
-			return false
+// commandActionName returns the name of the action taking a command at the
+// beginning of the string
+func commandActionName(str string) string {
+	for _, name := range []string{"execute-multi", "execute-silent", "execute", "reload-sync", "reload", "append", "become", "print", "transform-query", "transform-prompt", "transform-header", "transform", "change-border-label", "change-preview-label", "change-preview-window", "change-preview", "change-prompt", "change-header", "change-footer"} {
+		if strings.HasPrefix(str, name) {
+			return name
 		}
-		b = str[len("execute-multi")]
 	}
+	return ""
+}
+
+func isCommandAction(str string) bool {
+	name := commandActionName(str)
+	if len(name) == 0 || len(str) < len(name)+2 {
+		return false
+	}
+	b := str[len(name)]
 	e := str[len(str)-1]
 	if b == ':' || b == '(' && e == ')' || b == '[' && e == ']' ||
 		b == e && strings.ContainsAny(string(b), "~!@#$%^&*;/|") {
@@ -637,18 +1169,163 @@ func isExecuteAction(str string) bool {
 	return false
 }
 
-func parseToggleSort(keymap map[int]actionType, str string) {
+func parseToggleSort(keymap map[int][]action, str string) {
 	keys := parseKeyChords(str, "key name required")
 	if len(keys) != 1 {
 		errorExit("multiple keys specified")
 	}
-	keymap[firstKey(keys)] = actToggleSort
+	keymap[firstKey(keys)] = toActions(actToggleSort)
 }
 
 func strLines(str string) []string {
 	return strings.Split(strings.TrimSuffix(str, "\n"), "\n")
 }
 
+// footerLines splits the string into the lines of the footer. An empty string
+// removes the footer.
+func footerLines(str string) []string {
+	if len(str) == 0 {
+		return nil
+	}
+	return strLines(str)
+}
+
+func parsePreviewWindow(opts *previewOpts, input string) error {
+	sizeRegex := regexp.MustCompile("^[0-9]+%?$")
+	for _, token := range strings.Split(input, ":") {
+		switch token {
+		case "up":
+			opts.position = posUp
+		case "down":
+			opts.position = posDown
+		case "left":
+			opts.position = posLeft
+		case "right":
+			opts.position = posRight
+		case "hidden":
+			opts.hidden = true
+		case "follow":
+			opts.follow = true
+		case "nofollow":
+			opts.follow = false
+		case "highlight":
+			opts.highlight = true
+		case "nohighlight":
+			opts.highlight = false
+		default:
+			if strings.HasPrefix(token, "+") {
+				if !previewScrollRegex.MatchString(token) {
+					return errors.New("invalid preview window scroll offset: " + token)
+				}
+				opts.scroll = token
+				continue
+			}
+			if !sizeRegex.MatchString(token) {
+				return errors.New("invalid preview window layout: " + input)
+			}
+			if strings.HasSuffix(token, "%") && atof(token[:len(token)-1]) > 100 {
+				return errors.New("preview window size too large: " + token)
+			}
+			opts.size = token
+		}
+	}
+	return nil
+}
+
+func parseLayout(str string) layoutType {
+	switch str {
+	case "default":
+		return layoutDefault
+	case "reverse":
+		return layoutReverse
+	case "reverse-list":
+		return layoutReverseList
+	default:
+		errorExit("invalid layout (expected: default / reverse / reverse-list)")
+	}
+	return layoutDefault
+}
+
+// parseIndexColumn parses the type of the numbers in the index column: the
+// line numbers of the items in the input, or their positions in the list
+func parseIndexColumn(str string) indexColumn {
+	switch str {
+	case "input":
+		return indexInput
+	case "visible":
+		return indexVisible
+	}
+	errorExit("invalid index column (expected: input / visible)")
+	return indexNone
+}
+
+// parseInfoStyle parses the style of the finder info. The inline style can be
+// followed by the separator between the query and the info, e.g. inline:' | '
+func parseInfoStyle(str string) (infoStyle, string) {
+	switch str {
+	case "default":
+		return infoDefault, defaultInfoSep
+	case "inline":
+		return infoInline, defaultInfoSep
+	case "hidden":
+		return infoHidden, defaultInfoSep
+	}
+	if strings.HasPrefix(str, "inline:") {
+		return infoInline, str[len("inline:"):]
+	}
+	errorExit("invalid info style (expected: default / inline[:SEPARATOR] / hidden)")
+	return infoDefault, defaultInfoSep
+}
+
+func parseBorder(str string) borderStyle {
+	switch str {
+	case "rounded":
+		return borderRounded
+	case "sharp":
+		return borderSharp
+	case "double":
+		return borderDouble
+	case "horizontal":
+		return borderHorizontal
+	default:
+		errorExit("invalid border style (expected: rounded / sharp / double / horizontal)")
+	}
+	return borderNone
+}
+
+// parseLabelPosition parses N[:top|:bottom] where N is the offset of the label
+func parseLabelPosition(opts *labelOpts, str string) {
+	tokens := strings.Split(str, ":")
+	if len(tokens) > 2 {
+		errorExit("invalid label position: " + str)
+	}
+	opts.offset, opts.bottom = 0, false
+	if len(tokens[0]) > 0 {
+		opts.offset = atoi(tokens[0])
+	}
+	if len(tokens) > 1 {
+		switch tokens[1] {
+		case "top":
+		case "bottom":
+			opts.bottom = true
+		default:
+			errorExit("invalid label position: " + str)
+		}
+	}
+}
+
+func parseHeight(str string) string {
+	if strings.HasSuffix(str, "%") {
+		val := atof(str[:len(str)-1])
+		if val <= 0 || val > 100 {
+			errorExit("height must be between 0% and 100%")
+		}
+	} else if atoi(str) <= 0 {
+		errorExit("height must be positive")
+	}
+	return str
+}
+
 func parseMargin(margin string) [4]string {
 	margins := strings.Split(margin, ",")
 	checked := func(str string) string {
@@ -705,6 +1382,20 @@ func parseOptions(opts *Options, allArgs []string) {
 		}
 		opts.History = h
 	}
+	setBoostAccepted := func(path string) {
+		h, e := NewHistory(path, defaultHistoryMax)
+		if e != nil {
+			errorExit(e.Error())
+		}
+		opts.BoostAccepted = h
+	}
+	setResultCache := func(path string) {
+		rc, e := NewResultCache(path, resultCacheMax)
+		if e != nil {
+			errorExit(e.Error())
+		}
+		opts.ResultCache = rc
+	}
 	setHistoryMax := func(max int) {
 		historyMax = max
 		if historyMax < 1 {
@@ -737,17 +1428,35 @@ func parseOptions(opts *Options, allArgs []string) {
 			filter := nextString(allArgs, &i, "query string required")
 			opts.Filter = &filter
 		case "--expect":
-			opts.Expect = parseKeyChords(nextString(allArgs, &i, "key names required"), "key names required")
+			parseExpect(opts.Expect, nextString(allArgs, &i, "key names required"))
+		case "--no-expect":
+			opts.Expect = make(map[int]string)
 		case "--tiebreak":
 			opts.Criteria = parseTiebreak(nextString(allArgs, &i, "sort criterion required"))
+		case "--max-matches":
+			opts.MaxMatches = nextInt(allArgs, &i, "maximum number of matches required")
+		case "--chunk-size":
+			opts.ChunkSize = nextInt(allArgs, &i, "chunk size required")
+		case "--index":
+			opts.Index = nextString(allArgs, &i, "index file path required")
+		case "--no-index":
+			opts.Index = ""
+		case "--result-cache":
+			setResultCache(nextString(allArgs, &i, "result cache file path required"))
+		case "--no-result-cache":
+			opts.ResultCache = nil
+		case "--stats":
+			opts.StatsFile = nextString(allArgs, &i, "stats file path required")
 		case "--bind":
-			parseKeymap(opts.Keymap, opts.Execmap, nextString(allArgs, &i, "bind expression required"))
+			parseKeymap(opts.Keymap, nextString(allArgs, &i, "bind expression required"))
 		case "--color":
 			spec := optionalNextString(allArgs, &i)
 			if len(spec) == 0 {
 				opts.Theme = defaultTheme()
+				opts.ColorSpecs = nil
 			} else {
 				opts.Theme = parseTheme(opts.Theme, spec)
+				opts.ColorSpecs = append(opts.ColorSpecs, spec)
 			}
 		case "--toggle-sort":
 			parseToggleSort(opts.Keymap, nextString(allArgs, &i, "key name required"))
@@ -757,6 +1466,10 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.Nth = splitNth(nextString(allArgs, &i, "nth expression required"))
 		case "--with-nth":
 			opts.WithNth = splitNth(nextString(allArgs, &i, "nth expression required"))
+		case "--highlight-nth":
+			opts.HighlightNth = true
+		case "--no-highlight-nth":
+			opts.HighlightNth = false
 		case "-s", "--sort":
 			opts.Sort = optionalNumeric(allArgs, &i)
 		case "+s", "--no-sort":
@@ -765,14 +1478,64 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.Tac = true
 		case "--no-tac":
 			opts.Tac = false
+		case "--unique":
+			opts.Unique = true
+		case "--no-unique":
+			opts.Unique = false
+		case "--intern":
+			opts.Intern = true
+		case "--no-intern":
+			opts.Intern = false
+		case "--tail":
+			opts.Tail = nextInt(allArgs, &i, "number of items required")
+		case "--no-tail":
+			opts.Tail = 0
+		case "--walker":
+			parseWalker(&opts.Walker, nextString(allArgs, &i, "walker options required"))
+		case "--walker-depth":
+			opts.Walker.depth = nextInt(allArgs, &i, "walker depth required")
+		case "--walker-ignore":
+			opts.Walker.ignore = true
+		case "--no-walker-ignore":
+			opts.Walker.ignore = false
+		case "--source":
+			opts.Sources = append(opts.Sources, parseSource(nextString(allArgs, &i, "source required")))
+		case "--no-source":
+			opts.Sources = []Source{}
+		case "--command":
+			opts.Command = nextString(allArgs, &i, "command required")
+		case "--no-command":
+			opts.Command = ""
+		case "--follow":
+			opts.Follow = nextString(allArgs, &i, "file to follow required")
+		case "--no-follow":
+			opts.Follow = ""
+		case "--throttle":
+			opts.Throttle = nextInt(allArgs, &i, "number of processors required")
+		case "--no-throttle":
+			opts.Throttle = 0
+		case "--payload-delimiter":
+			opts.Payload = payloadSplitter(nextString(allArgs, &i, "payload delimiter required"))
+		case "--no-payload-delimiter":
+			opts.Payload = nil
+		case "--input-filter":
+			opts.InputFilter = nextString(allArgs, &i, "input filter command required")
+		case "--no-input-filter":
+			opts.InputFilter = ""
 		case "-i":
 			opts.Case = CaseIgnore
 		case "+i":
 			opts.Case = CaseRespect
 		case "-m", "--multi":
 			opts.Multi = true
+			opts.MultiMax = 0
 		case "+m", "--no-multi":
 			opts.Multi = false
+			opts.MultiMax = 0
+		case "--selected-pane":
+			opts.SelectedPane = defaultSelectedPane()
+		case "--no-selected-pane":
+			opts.SelectedPane = nil
 		case "--ansi":
 			opts.Ansi = true
 		case "--no-ansi":
@@ -781,30 +1544,78 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.Mouse = false
 		case "+c", "--no-color":
 			opts.Theme = nil
+			opts.ColorSpecs = []string{"bw"}
 		case "+2", "--no-256":
 			opts.Theme = curses.Default16
+			opts.ColorSpecs = []string{"16"}
+		case "--auto-theme":
+			opts.AutoTheme = true
+		case "--no-auto-theme":
+			opts.AutoTheme = false
 		case "--black":
 			opts.Black = true
+		case "--plain":
+			opts.Plain = true
+		case "--no-plain":
+			opts.Plain = false
+		case "--bell":
+			opts.Bell = true
+		case "--no-bell":
+			opts.Bell = false
 		case "--no-black":
 			opts.Black = false
 		case "--reverse":
-			opts.Reverse = true
+			opts.Layout = layoutReverse
 		case "--no-reverse":
-			opts.Reverse = false
+			opts.Layout = layoutDefault
+		case "--layout":
+			opts.Layout = parseLayout(nextString(allArgs, &i, "layout required (default / reverse / reverse-list)"))
 		case "--cycle":
 			opts.Cycle = true
 		case "--no-cycle":
 			opts.Cycle = false
+		case "--track":
+			opts.Track = true
+		case "--no-track":
+			opts.Track = false
+		case "--annotation":
+			opts.Annotation = true
+		case "--no-annotation":
+			opts.Annotation = false
+		case "--index-column":
+			opts.IndexColumn = indexInput
+		case "--no-index-column":
+			opts.IndexColumn = indexNone
+		case "--tree":
+			opts.Tree = true
+		case "--no-tree":
+			opts.Tree = false
 		case "--hscroll":
 			opts.Hscroll = true
 		case "--no-hscroll":
 			opts.Hscroll = false
 		case "--hscroll-off":
 			opts.HscrollOff = nextInt(allArgs, &i, "hscroll offset required")
+		case "--wrap":
+			opts.Wrap = true
+		case "--no-wrap":
+			opts.Wrap = false
+		case "--keep-right":
+			opts.KeepRight = true
+		case "--no-keep-right":
+			opts.KeepRight = false
+		case "--ellipsis":
+			opts.Ellipsis = nextString(allArgs, &i, "ellipsis string required")
+		case "--scroll-off":
+			opts.ScrollOff = nextInt(allArgs, &i, "scroll offset required")
 		case "--inline-info":
-			opts.InlineInfo = true
+			opts.Info = infoInline
 		case "--no-inline-info":
-			opts.InlineInfo = false
+			opts.Info = infoDefault
+		case "--info-format":
+			opts.InfoFormat = nextString(allArgs, &i, "info format required")
+		case "--info":
+			opts.Info, opts.InfoSep = parseInfoStyle(nextString(allArgs, &i, "info style required (default / inline / hidden)"))
 		case "-1", "--select-1":
 			opts.Select1 = true
 		case "+1", "--no-select-1":
@@ -817,12 +1628,44 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.ReadZero = true
 		case "--no-read0":
 			opts.ReadZero = false
+		case "--decompress":
+			opts.Decompress = true
+		case "--no-decompress":
+			opts.Decompress = false
+		case "--print0":
+			opts.PrintZero = true
+		case "--no-print0":
+			opts.PrintZero = false
 		case "--print-query":
 			opts.PrintQuery = true
 		case "--no-print-query":
 			opts.PrintQuery = false
 		case "--prompt":
 			opts.Prompt = nextString(allArgs, &i, "prompt string required")
+		case "--pointer":
+			opts.Pointer = nextString(allArgs, &i, "pointer sign string required")
+		case "--marker":
+			opts.Marker = nextString(allArgs, &i, "selected sign string required")
+		case "--spinner":
+			opts.Spinner = nextString(allArgs, &i, "spinner characters required")
+		case "--selected-counter":
+			opts.SelCounter = nextString(allArgs, &i, "selected counter format required")
+		case "--jump-labels":
+			opts.JumpLabels = nextString(allArgs, &i, "label characters required")
+		case "--word-delimiters":
+			opts.WordDelims = nextString(allArgs, &i, "word delimiters required")
+		case "--vi":
+			opts.Vi = true
+		case "--no-vi":
+			opts.Vi = false
+		case "--clipboard":
+			opts.Clipboard = true
+		case "--no-clipboard":
+			opts.Clipboard = false
+		case "--paste-first-line":
+			opts.PasteFirst = true
+		case "--no-paste-first-line":
+			opts.PasteFirst = false
 		case "--sync":
 			opts.Sync = true
 		case "--no-sync":
@@ -835,12 +1678,24 @@ func parseOptions(opts *Options, allArgs []string) {
 			setHistory(nextString(allArgs, &i, "history file path required"))
 		case "--history-size":
 			setHistoryMax(nextInt(allArgs, &i, "history max size required"))
+		case "--no-boost-accepted":
+			opts.BoostAccepted = nil
+		case "--boost-accepted":
+			setBoostAccepted(nextString(allArgs, &i, "file path required"))
 		case "--no-header":
 			opts.Header = []string{}
 		case "--no-header-lines":
 			opts.HeaderLines = 0
 		case "--header":
 			opts.Header = strLines(nextString(allArgs, &i, "header string required"))
+		case "--header-first":
+			opts.HeaderFirst = true
+		case "--no-header-first":
+			opts.HeaderFirst = false
+		case "--footer":
+			opts.Footer = footerLines(nextString(allArgs, &i, "footer string required"))
+		case "--no-footer":
+			opts.Footer = nil
 		case "--header-lines":
 			opts.HeaderLines = atoi(
 				nextString(allArgs, &i, "number of header lines required"))
@@ -849,8 +1704,47 @@ func parseOptions(opts *Options, allArgs []string) {
 		case "--margin":
 			opts.Margin = parseMargin(
 				nextString(allArgs, &i, "margin required (TRBL / TB,RL / T,RL,B / T,R,B,L)"))
+		case "--alt-screen":
+			opts.AltScreen = true
+		case "--no-alt-screen":
+			opts.AltScreen = false
+		case "--clear":
+			opts.Clear = true
+		case "--no-clear":
+			opts.Clear = false
+		case "--height":
+			opts.Height = parseHeight(nextString(allArgs, &i, "height required: HEIGHT[%]"))
+		case "--no-height":
+			opts.Height = ""
+		case "--border":
+			opts.Border = borderRounded
+		case "--no-border":
+			opts.Border = borderNone
+		case "--border-label":
+			opts.BorderLabel.label = nextString(allArgs, &i, "label required")
+		case "--border-label-pos":
+			parseLabelPosition(&opts.BorderLabel,
+				nextString(allArgs, &i, "label position required (N[:top|:bottom])"))
+		case "--tmux":
+			opts.Tmux = defaultTmuxOpts()
+		case "--no-tmux":
+			opts.Tmux = nil
 		case "--tabstop":
 			opts.Tabstop = nextInt(allArgs, &i, "tab stop required")
+		case "--preview":
+			opts.Preview.command = nextString(allArgs, &i, "preview command required")
+		case "--no-preview":
+			opts.Preview.command = ""
+		case "--preview-window":
+			if err := parsePreviewWindow(&opts.Preview,
+				nextString(allArgs, &i, "preview window layout required: [up|down|left|right][:SIZE[%]][:hidden]")); err != nil {
+				errorExit(err.Error())
+			}
+		case "--preview-label":
+			opts.Preview.label.label = nextString(allArgs, &i, "label required")
+		case "--preview-label-pos":
+			parseLabelPosition(&opts.Preview.label,
+				nextString(allArgs, &i, "label position required (N[:top|:bottom])"))
 		case "--version":
 			opts.Version = true
 		default:
@@ -862,6 +1756,18 @@ func parseOptions(opts *Options, allArgs []string) {
 				opts.Delimiter = delimiterRegexp(value)
 			} else if match, value := optString(arg, "--prompt="); match {
 				opts.Prompt = value
+			} else if match, value := optString(arg, "--pointer="); match {
+				opts.Pointer = value
+			} else if match, value := optString(arg, "--marker="); match {
+				opts.Marker = value
+			} else if match, value := optString(arg, "--spinner="); match {
+				opts.Spinner = value
+			} else if match, value := optString(arg, "--selected-counter="); match {
+				opts.SelCounter = value
+			} else if match, value := optString(arg, "--jump-labels="); match {
+				opts.JumpLabels = value
+			} else if match, value := optString(arg, "--word-delimiters="); match {
+				opts.WordDelims = value
 			} else if match, value := optString(arg, "-n", "--nth="); match {
 				opts.Nth = splitNth(value)
 			} else if match, value := optString(arg, "--with-nth="); match {
@@ -871,27 +1777,100 @@ func parseOptions(opts *Options, allArgs []string) {
 			} else if match, value := optString(arg, "--toggle-sort="); match {
 				parseToggleSort(opts.Keymap, value)
 			} else if match, value := optString(arg, "--expect="); match {
-				opts.Expect = parseKeyChords(value, "key names required")
+				parseExpect(opts.Expect, value)
 			} else if match, value := optString(arg, "--tiebreak="); match {
 				opts.Criteria = parseTiebreak(value)
+			} else if match, value := optString(arg, "--max-matches="); match {
+				opts.MaxMatches = atoi(value)
+			} else if match, value := optString(arg, "--multi="); match {
+				opts.Multi = true
+				opts.MultiMax = parseMultiMax(value)
+			} else if match, value := optString(arg, "--selected-pane="); match {
+				opts.SelectedPane = parseSelectedPane(value)
+			} else if match, value := optString(arg, "--tail="); match {
+				opts.Tail = atoi(value)
+			} else if match, value := optString(arg, "--source="); match {
+				opts.Sources = append(opts.Sources, parseSource(value))
+			} else if match, value := optString(arg, "--command="); match {
+				opts.Command = value
+			} else if match, value := optString(arg, "--follow="); match {
+				opts.Follow = value
+			} else if match, value := optString(arg, "--throttle="); match {
+				opts.Throttle = atoi(value)
+			} else if match, value := optString(arg, "--payload-delimiter="); match {
+				opts.Payload = payloadSplitter(value)
+			} else if match, value := optString(arg, "--input-filter="); match {
+				opts.InputFilter = value
+			} else if match, value := optString(arg, "--chunk-size="); match {
+				opts.ChunkSize = atoi(value)
+			} else if match, value := optString(arg, "--index="); match {
+				opts.Index = value
+			} else if match, value := optString(arg, "--result-cache="); match {
+				setResultCache(value)
+			} else if match, value := optString(arg, "--stats="); match {
+				opts.StatsFile = value
 			} else if match, value := optString(arg, "--color="); match {
 				opts.Theme = parseTheme(opts.Theme, value)
+				opts.ColorSpecs = append(opts.ColorSpecs, value)
 			} else if match, value := optString(arg, "--bind="); match {
-				parseKeymap(opts.Keymap, opts.Execmap, value)
+				parseKeymap(opts.Keymap, value)
 			} else if match, value := optString(arg, "--history="); match {
 				setHistory(value)
 			} else if match, value := optString(arg, "--history-size="); match {
 				setHistoryMax(atoi(value))
+			} else if match, value := optString(arg, "--boost-accepted="); match {
+				setBoostAccepted(value)
 			} else if match, value := optString(arg, "--header="); match {
 				opts.Header = strLines(value)
+			} else if match, value := optString(arg, "--footer="); match {
+				opts.Footer = footerLines(value)
 			} else if match, value := optString(arg, "--header-lines="); match {
 				opts.HeaderLines = atoi(value)
 			} else if match, value := optString(arg, "--margin="); match {
 				opts.Margin = parseMargin(value)
+			} else if match, value := optString(arg, "--info-format="); match {
+				opts.InfoFormat = value
+			} else if match, value := optString(arg, "--index-column="); match {
+				opts.IndexColumn = parseIndexColumn(value)
+			} else if match, value := optString(arg, "--walker="); match {
+				parseWalker(&opts.Walker, value)
+			} else if match, value := optString(arg, "--walker-depth="); match {
+				opts.Walker.depth = atoi(value)
+			} else if match, value := optString(arg, "--info="); match {
+				opts.Info, opts.InfoSep = parseInfoStyle(value)
+			} else if match, value := optString(arg, "--layout="); match {
+				opts.Layout = parseLayout(value)
+			} else if match, value := optString(arg, "--border="); match {
+				opts.Border = parseBorder(value)
+			} else if match, value := optString(arg, "--border-label="); match {
+				opts.BorderLabel.label = value
+			} else if match, value := optString(arg, "--border-label-pos="); match {
+				parseLabelPosition(&opts.BorderLabel, value)
+			} else if match, value := optString(arg, "--tmux="); match {
+				opts.Tmux = parseTmuxOpts(value)
+			} else if match, value := optString(arg, "--height="); match {
+				opts.Height = parseHeight(value)
 			} else if match, value := optString(arg, "--tabstop="); match {
 				opts.Tabstop = atoi(value)
+			} else if match, value := optString(arg, "--preview="); match {
+				opts.Preview.command = value
+			} else if match, value := optString(arg, "--preview-label="); match {
+				opts.Preview.label.label = value
+			} else if match, value := optString(arg, "--preview-label-pos="); match {
+				parseLabelPosition(&opts.Preview.label, value)
+			} else if match, value := optString(arg, "--preview-window="); match {
+				if err := parsePreviewWindow(&opts.Preview, value); err != nil {
+					errorExit(err.Error())
+				}
 			} else if match, value := optString(arg, "--hscroll-off="); match {
 				opts.HscrollOff = atoi(value)
+			} else if match, value := optString(arg, "--scroll-off="); match {
+				opts.ScrollOff = atoi(value)
+			} else if match, value := optString(arg, "--ellipsis="); match {
+				opts.Ellipsis = value
+			} else if len(arg) > 0 && arg[0] != '-' && arg[0] != '+' {
+				// Read items from the file instead of standard input
+				opts.Files = append(opts.Files, arg)
 			} else {
 				errorExit("unknown option: " + arg)
 			}
@@ -902,33 +1881,96 @@ func parseOptions(opts *Options, allArgs []string) {
 		errorExit("header lines must be a non-negative integer")
 	}
 
+	if opts.MaxMatches < 0 {
+		errorExit("max matches must be a non-negative integer")
+	}
+
 	if opts.HscrollOff < 0 {
 		errorExit("hscroll offset must be a non-negative integer")
 	}
 
+	if opts.ScrollOff < 0 {
+		errorExit("scroll offset must be a non-negative integer")
+	}
+
+	if opts.Walker.depth < 0 {
+		errorExit("walker depth must be a non-negative integer")
+	}
+
+	for _, path := range opts.Files {
+		if info, err := os.Stat(path); err != nil {
+			errorExit(err.Error())
+		} else if info.IsDir() {
+			errorExit("not a file: " + path)
+		}
+	}
+
 	if opts.Tabstop < 1 {
 		errorExit("tab stop must be a positive integer")
 	}
+
+	if opts.ChunkSize < 1 {
+		errorExit("chunk size must be a positive integer")
+	}
+
+	if len(opts.JumpLabels) == 0 {
+		errorExit("empty jump labels")
+	}
+	for _, r := range opts.JumpLabels {
+		if runeWidth(r, 0) != 1 {
+			errorExit("jump labels must be single-width characters")
+		}
+	}
+
+	if len(opts.Spinner) == 0 {
+		errorExit("empty spinner")
+	}
 }
 
 func postProcessOptions(opts *Options) {
 	// Default actions for CTRL-N / CTRL-P when --history is set
 	if opts.History != nil {
 		if _, prs := opts.Keymap[curses.CtrlP]; !prs {
-			opts.Keymap[curses.CtrlP] = actPreviousHistory
+			opts.Keymap[curses.CtrlP] = toActions(actPreviousHistory)
 		}
 		if _, prs := opts.Keymap[curses.CtrlN]; !prs {
-			opts.Keymap[curses.CtrlN] = actNextHistory
+			opts.Keymap[curses.CtrlN] = toActions(actNextHistory)
+		}
+	}
+
+	// The finder is drawn below the cursor with the full height of the
+	// terminal instead of switching to the alternate screen, which would
+	// discard the finder on exit
+	if len(opts.Height) == 0 && (!opts.AltScreen || !opts.Clear) {
+		opts.Height = "100%"
+	}
+
+	// Plain output keeps the text on the same columns without the colors
+	if opts.Plain {
+		opts.Theme = nil
+		opts.AutoTheme = false
+		opts.Hscroll = false
+	}
+
+	// The lines are sent to the filter command with the delimiter of the
+	// input, which is only known after all the options are parsed
+	if len(opts.InputFilter) > 0 {
+		delim := byte('\n')
+		if opts.ReadZero {
+			delim = 0
 		}
+		opts.Transform = commandTransformer(opts.InputFilter, delim)
 	}
 
 	// Extend the default key map
 	keymap := defaultKeymap()
-	for key, act := range opts.Keymap {
-		if act == actToggleSort {
-			opts.ToggleSort = true
+	for key, actions := range opts.Keymap {
+		for _, act := range actions {
+			if act.t == actToggleSort {
+				opts.ToggleSort = true
+			}
 		}
-		keymap[key] = act
+		keymap[key] = actions
 	}
 	opts.Keymap = keymap
 
@@ -2,6 +2,7 @@ package fzf
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/junegunn/fzf/src/curses"
@@ -91,6 +92,244 @@ func TestSplitNth(t *testing.T) {
 	}
 }
 
+func TestParseTiebreak(t *testing.T) {
+	check := func(str string, expected ...criterion) {
+		criteria := parseTiebreak(str)
+		if len(criteria) != len(expected)+1 || criteria[0] != byMatchLen {
+			t.Errorf("%v", criteria)
+			return
+		}
+		for idx, cri := range expected {
+			if criteria[idx+1] != cri {
+				t.Errorf("%v", criteria)
+			}
+		}
+	}
+	check("index")
+	check("length", byLength)
+	check("end,begin,index", byEnd, byBegin)
+	check("Begin,LENGTH,end", byBegin, byLength, byEnd)
+}
+
+func TestFileArguments(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"options.go", "-q", "foo", "--ansi", "./core.go"})
+	if !reflect.DeepEqual(opts.Files, []string{"options.go", "./core.go"}) || opts.Query != "foo" || !opts.Ansi {
+		t.Errorf("%q", opts.Files)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	source := parseSource("git:git ls-files | grep :")
+	if source.Tag != "git" || source.Command != "git ls-files | grep :" {
+		t.Errorf("%v", source)
+	}
+
+	source = parseSource(":ls -l")
+	if source.Tag != "" || source.Command != "ls -l" {
+		t.Errorf("%v", source)
+	}
+
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--source=a:ls", "--source", "b:find ."})
+	if len(opts.Sources) != 2 || opts.Sources[1].Tag != "b" || opts.Sources[1].Command != "find ." {
+		t.Errorf("%v", opts.Sources)
+	}
+	parseOptions(opts, []string{"--no-source"})
+	if len(opts.Sources) != 0 {
+		t.Errorf("%v", opts.Sources)
+	}
+}
+
+func TestExpect(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--expect=ctrl-o,ctrl-e", "--expect", "alt-a"})
+	if len(opts.Expect) != 3 || opts.Expect[curses.CtrlO] != "ctrl-o" ||
+		opts.Expect[curses.CtrlE] != "ctrl-e" || opts.Expect[curses.AltA] != "alt-a" {
+		t.Errorf("%v", opts.Expect)
+	}
+	parseOptions(opts, []string{"--no-expect", "--expect=f1"})
+	if len(opts.Expect) != 1 || opts.Expect[curses.F1] != "f1" {
+		t.Errorf("%v", opts.Expect)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	check := func(words []string, expected layoutType) {
+		opts := defaultOptions()
+		parseOptions(opts, words)
+		if opts.Layout != expected {
+			t.Errorf("%v: %d", words, opts.Layout)
+		}
+	}
+	check([]string{}, layoutDefault)
+	check([]string{"--reverse"}, layoutReverse)
+	check([]string{"--layout=reverse-list"}, layoutReverseList)
+	check([]string{"--layout", "reverse", "--no-reverse"}, layoutDefault)
+	check([]string{"--reverse", "--layout=default"}, layoutDefault)
+}
+
+func TestInfoStyle(t *testing.T) {
+	check := func(words []string, expected infoStyle) {
+		opts := defaultOptions()
+		parseOptions(opts, words)
+		if opts.Info != expected {
+			t.Errorf("%v: %d", words, opts.Info)
+		}
+	}
+	check([]string{}, infoDefault)
+	check([]string{"--inline-info"}, infoInline)
+	check([]string{"--info=hidden"}, infoHidden)
+	check([]string{"--info", "inline", "--no-inline-info"}, infoDefault)
+}
+
+func TestBorder(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--border"})
+	if opts.Border != borderRounded {
+		t.Errorf("%d", opts.Border)
+	}
+	parseOptions(opts, []string{"--border=horizontal"})
+	if opts.Border != borderHorizontal {
+		t.Errorf("%d", opts.Border)
+	}
+	parseOptions(opts, []string{"--border=double", "--no-border"})
+	if opts.Border != borderNone {
+		t.Errorf("%d", opts.Border)
+	}
+}
+
+func TestHeight(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--height=40%"})
+	if opts.Height != "40%" || heightFor(opts.Height, 50, minHeight) != 20 {
+		t.Errorf("%s", opts.Height)
+	}
+	parseOptions(opts, []string{"--height", "2"})
+	if opts.Height != "2" || heightFor(opts.Height, 50, minHeight) != minHeight {
+		t.Errorf("%s", opts.Height)
+	}
+	parseOptions(opts, []string{"--no-height"})
+	if len(opts.Height) > 0 {
+		t.Errorf("%s", opts.Height)
+	}
+}
+
+func TestPointerAndMarker(t *testing.T) {
+	opts := defaultOptions()
+	if opts.Pointer != ">" || opts.Marker != ">" {
+		t.Errorf("%q %q", opts.Pointer, opts.Marker)
+	}
+	parseOptions(opts, []string{"--pointer", "▶▶", "--marker=✔"})
+	if opts.Pointer != "▶▶" || opts.Marker != "✔" {
+		t.Errorf("%q %q", opts.Pointer, opts.Marker)
+	}
+}
+
+func TestJumpLabels(t *testing.T) {
+	opts := defaultOptions()
+	if opts.JumpLabels != defaultJumpLabels {
+		t.Errorf("%q", opts.JumpLabels)
+	}
+	parseOptions(opts, []string{"--jump-labels=abc", "--bind=ctrl-j:jump,ctrl-k:jump-accept"})
+	if opts.JumpLabels != "abc" {
+		t.Errorf("%q", opts.JumpLabels)
+	}
+	if opts.Keymap[curses.CtrlJ][0].t != actJump || opts.Keymap[curses.CtrlK][0].t != actJumpAccept {
+		t.Errorf("%v", opts.Keymap)
+	}
+}
+
+func TestInfoSymbols(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--info=inline:' | '", "--spinner", ".oO", "--selected-counter=[%s]"})
+	if opts.Info != infoInline || opts.InfoSep != "' | '" || opts.Spinner != ".oO" || opts.SelCounter != "[%s]" {
+		t.Errorf("%v %q %q %q", opts.Info, opts.InfoSep, opts.Spinner, opts.SelCounter)
+	}
+	parseOptions(opts, []string{"--info", "inline"})
+	if opts.Info != infoInline || opts.InfoSep != defaultInfoSep {
+		t.Errorf("%v %q", opts.Info, opts.InfoSep)
+	}
+}
+
+func TestScrollOff(t *testing.T) {
+	opts := defaultOptions()
+	if opts.ScrollOff != 0 {
+		t.Errorf("%d", opts.ScrollOff)
+	}
+	parseOptions(opts, []string{"--scroll-off", "3"})
+	if opts.ScrollOff != 3 {
+		t.Errorf("%d", opts.ScrollOff)
+	}
+	parseOptions(opts, []string{"--scroll-off=5"})
+	if opts.ScrollOff != 5 {
+		t.Errorf("%d", opts.ScrollOff)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--wrap", "--bind=ctrl-w:toggle-wrap"})
+	if !opts.Wrap || opts.Keymap[curses.CtrlW][0].t != actToggleWrap {
+		t.Errorf("%v %v", opts.Wrap, opts.Keymap[curses.CtrlW])
+	}
+	parseOptions(opts, []string{"--no-wrap"})
+	if opts.Wrap {
+		t.Error("wrap should be disabled")
+	}
+}
+
+func TestMultiMax(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--multi=3"})
+	if !opts.Multi || opts.MultiMax != 3 {
+		t.Errorf("%v %d", opts.Multi, opts.MultiMax)
+	}
+	parseOptions(opts, []string{"-m"})
+	if !opts.Multi || opts.MultiMax != 0 {
+		t.Errorf("%v %d", opts.Multi, opts.MultiMax)
+	}
+	parseOptions(opts, []string{"--multi=2", "+m"})
+	if opts.Multi || opts.MultiMax != 0 {
+		t.Errorf("%v %d", opts.Multi, opts.MultiMax)
+	}
+}
+
+func TestPreviewOpts(t *testing.T) {
+	opts := defaultOptions()
+	if opts.Preview != defaultPreviewOpts("") {
+		t.Errorf("%v", opts.Preview)
+	}
+	parseOptions(opts, []string{"--preview", "cat {}", "--preview-window=up:10"})
+	if opts.Preview != (previewOpts{"cat {}", posUp, "10", false, "", false, false, labelOpts{}}) {
+		t.Errorf("%v", opts.Preview)
+	}
+	parseOptions(opts, []string{"--preview-window", "30%:hidden:left"})
+	if opts.Preview != (previewOpts{"cat {}", posLeft, "30%", true, "", false, false, labelOpts{}}) {
+		t.Errorf("%v", opts.Preview)
+	}
+	parseOptions(opts, []string{"--preview-window=right:+{2}-/2"})
+	if opts.Preview != (previewOpts{"cat {}", posRight, "30%", true, "+{2}-/2", false, false, labelOpts{}}) {
+		t.Errorf("%v", opts.Preview)
+	}
+	parseOptions(opts, []string{"--preview-window=follow"})
+	if !opts.Preview.follow {
+		t.Errorf("%v", opts.Preview)
+	}
+	parseOptions(opts, []string{"--preview-window=highlight"})
+	if !opts.Preview.highlight {
+		t.Errorf("%v", opts.Preview)
+	}
+	parseOptions(opts, []string{"--preview-window=nofollow"})
+	if opts.Preview.follow {
+		t.Errorf("%v", opts.Preview)
+	}
+	parseOptions(opts, []string{"--no-preview"})
+	if len(opts.Preview.command) > 0 {
+		t.Errorf("%v", opts.Preview)
+	}
+}
+
 func TestIrrelevantNth(t *testing.T) {
 	{
 		opts := defaultOptions()
@@ -172,6 +411,27 @@ func TestParseKeys(t *testing.T) {
 	check(curses.BTab, "shift-tab")
 	check(curses.CtrlM, "Enter")
 	check(curses.BSpace, "bspace")
+
+	// Mouse clicks
+	pairs = parseKeyChords("click,double-click,click-header,double-click-header,click-border,double-click-border", "")
+	if len(pairs) != 6 {
+		t.Error(6)
+	}
+	check(curses.Click, "click")
+	check(curses.DoubleClick, "double-click")
+	check(curses.ClickHeader, "click-header")
+	check(curses.DoubleClickHeader, "double-click-header")
+	check(curses.ClickBorder, "click-border")
+	check(curses.DoubleClickBorder, "double-click-border")
+
+	// Events
+	pairs = parseKeyChords("change,focus,load,resize,one,zero", "")
+	if len(pairs) != 6 {
+		t.Error(6)
+	}
+	check(curses.Resize, "resize")
+	check(curses.One, "one")
+	check(curses.Zero, "zero")
 }
 
 func TestParseKeysWithComma(t *testing.T) {
@@ -232,38 +492,145 @@ func TestBind(t *testing.T) {
 		}
 	}
 	keymap := defaultKeymap()
-	execmap := make(map[int]string)
-	check(actBeginningOfLine, keymap[curses.CtrlA])
-	parseKeymap(keymap, execmap,
-		"ctrl-a:kill-line,ctrl-b:toggle-sort,c:page-up,alt-z:page-down,"+
+	check(actBeginningOfLine, keymap[curses.CtrlA][0].t)
+	parseKeymap(keymap,
+		"ctrl-a:kill-line,ctrl-b:toggle-sort,ctrl-r:reload,ctrl-t:toggle-throttle,ctrl-v:toggle-preview,c:page-up,alt-z:page-down,"+
 			"f1:execute(ls {}),f2:execute/echo {}, {}, {}/,f3:execute[echo '({})'],f4:execute;less {};,"+
 			"alt-a:execute@echo (,),[,],/,:,;,%,{}@,alt-b:execute;echo (,),[,],/,:,@,%,{};"+
 			",,:abort,::accept,X:execute:\nfoobar,Y:execute(baz)")
-	check(actKillLine, keymap[curses.CtrlA])
-	check(actToggleSort, keymap[curses.CtrlB])
-	check(actPageUp, keymap[curses.AltZ+'c'])
-	check(actAbort, keymap[curses.AltZ+','])
-	check(actAccept, keymap[curses.AltZ+':'])
-	check(actPageDown, keymap[curses.AltZ])
-	check(actExecute, keymap[curses.F1])
-	check(actExecute, keymap[curses.F2])
-	check(actExecute, keymap[curses.F3])
-	check(actExecute, keymap[curses.F4])
-	checkString("ls {}", execmap[curses.F1])
-	checkString("echo {}, {}, {}", execmap[curses.F2])
-	checkString("echo '({})'", execmap[curses.F3])
-	checkString("less {}", execmap[curses.F4])
-	checkString("echo (,),[,],/,:,;,%,{}", execmap[curses.AltA])
-	checkString("echo (,),[,],/,:,@,%,{}", execmap[curses.AltB])
-	checkString("\nfoobar,Y:execute(baz)", execmap[curses.AltZ+'X'])
+	check(actKillLine, keymap[curses.CtrlA][0].t)
+	check(actToggleSort, keymap[curses.CtrlB][0].t)
+	check(actReload, keymap[curses.CtrlR][0].t)
+	check(actToggleThrottle, keymap[curses.CtrlT][0].t)
+	check(actTogglePreview, keymap[curses.CtrlV][0].t)
+	check(actPageUp, keymap[curses.AltZ+'c'][0].t)
+	check(actAbort, keymap[curses.AltZ+','][0].t)
+	check(actAccept, keymap[curses.AltZ+':'][0].t)
+	check(actPageDown, keymap[curses.AltZ][0].t)
+	check(actExecute, keymap[curses.F1][0].t)
+	check(actExecute, keymap[curses.F2][0].t)
+	check(actExecute, keymap[curses.F3][0].t)
+	check(actExecute, keymap[curses.F4][0].t)
+	checkString("ls {}", keymap[curses.F1][0].a)
+	checkString("echo {}, {}, {}", keymap[curses.F2][0].a)
+	checkString("echo '({})'", keymap[curses.F3][0].a)
+	checkString("less {}", keymap[curses.F4][0].a)
+	checkString("echo (,),[,],/,:,;,%,{}", keymap[curses.AltA][0].a)
+	checkString("echo (,),[,],/,:,@,%,{}", keymap[curses.AltB][0].a)
+	checkString("\nfoobar,Y:execute(baz)", keymap[curses.AltZ+'X'][0].a)
 
 	for idx, char := range []rune{'~', '!', '@', '#', '$', '%', '^', '&', '*', '|', ';', '/'} {
-		parseKeymap(keymap, execmap, fmt.Sprintf("%d:execute%cfoobar%c", idx%10, char, char))
-		checkString("foobar", execmap[curses.AltZ+int([]rune(fmt.Sprintf("%d", idx%10))[0])])
-	}
+		parseKeymap(keymap, fmt.Sprintf("%d:execute%cfoobar%c", idx%10, char, char))
+		checkString("foobar", keymap[curses.AltZ+int([]rune(fmt.Sprintf("%d", idx%10))[0])][0].a)
+	}
+
+	parseKeymap(keymap, "f1:abort")
+	check(actAbort, keymap[curses.F1][0].t)
+
+	// Chained actions and events
+	parseKeymap(keymap, "ctrl-x:clear-query+execute(echo a+b)+accept,change:up,focus:ignore,load:execute:x+y")
+	if len(keymap[curses.CtrlX]) != 3 {
+		t.Errorf("%v", keymap[curses.CtrlX])
+	}
+	check(actClearQuery, keymap[curses.CtrlX][0].t)
+	check(actExecute, keymap[curses.CtrlX][1].t)
+	checkString("echo a+b", keymap[curses.CtrlX][1].a)
+	check(actAccept, keymap[curses.CtrlX][2].t)
+	check(actUp, keymap[curses.Change][0].t)
+	check(actExecute, keymap[curses.Load][0].t)
+	checkString("x+y", keymap[curses.Load][0].a)
+	check(actIgnore, keymap[curses.Focus][0].t)
+
+	parseKeymap(keymap, "ctrl-y:execute-silent(echo {q})+execute-multi[cat {}],ctrl-z:execute-silent:a,b")
+	check(actExecuteSilent, keymap[curses.CtrlY][0].t)
+	checkString("echo {q}", keymap[curses.CtrlY][0].a)
+	check(actExecuteMulti, keymap[curses.CtrlY][1].t)
+	checkString("cat {}", keymap[curses.CtrlY][1].a)
+	check(actExecuteSilent, keymap[curses.CtrlZ][0].t)
+	checkString("a,b", keymap[curses.CtrlZ][0].a)
+
+	parseKeymap(keymap, "ctrl-r:reload,f2:reload(grep -r {q} .),f3:reload-sync[ls]+accept")
+	check(actReload, keymap[curses.CtrlR][0].t)
+	checkString("", keymap[curses.CtrlR][0].a)
+	check(actReload, keymap[curses.F2][0].t)
+	checkString("grep -r {q} .", keymap[curses.F2][0].a)
+	check(actReloadSync, keymap[curses.F3][0].t)
+	checkString("ls", keymap[curses.F3][0].a)
+
+	parseKeymap(keymap, "ctrl-a:append(echo a+b,c),ctrl-b:reload(echo a+b)")
+	check(actAppend, keymap[curses.CtrlA][0].t)
+	checkString("echo a+b,c", keymap[curses.CtrlA][0].a)
+	check(actReload, keymap[curses.CtrlB][0].t)
+	checkString("echo a+b", keymap[curses.CtrlB][0].a)
+
+	parseKeymap(keymap, "enter:become(vim {+}),ctrl-o:become:less {}")
+	check(actBecome, keymap[curses.CtrlM][0].t)
+	checkString("vim {+}", keymap[curses.CtrlM][0].a)
+	check(actBecome, keymap[curses.CtrlO][0].t)
+	checkString("less {}", keymap[curses.CtrlO][0].a)
+
+	parseKeymap(keymap, "alt-c:copy,alt-s:copy-selected,alt-q:copy-query")
+	check(actCopy, keymap[curses.AltA+'c'-'a'][0].t)
+	check(actCopySelected, keymap[curses.AltA+'s'-'a'][0].t)
+	check(actCopyQuery, keymap[curses.AltA+'q'-'a'][0].t)
+	check(actYankPop, keymap[curses.AltA+'y'-'a'][0].t)
+
+	parseKeymap(keymap, "f4:change-border-label( Files ),alt-l:change-preview-label[],alt-p:change-preview-label:a+b")
+	check(actChangeBorderLabel, keymap[curses.F4][0].t)
+	checkString(" Files ", keymap[curses.F4][0].a)
+	check(actChangePreviewLabel, keymap[curses.AltA+'p'-'a'][0].t)
+	checkString("a+b", keymap[curses.AltA+'p'-'a'][0].a)
+	check(actChangePreviewLabel, keymap[curses.AltA+'l'-'a'][0].t)
+	checkString("", keymap[curses.AltA+'l'-'a'][0].a)
+
+	parseKeymap(keymap, "ctrl-f:change-prompt(Files> )+change-preview(cat {})+change-preview-window(up:40%),ctrl-g:change-preview()")
+	check(actChangePrompt, keymap[curses.CtrlF][0].t)
+	checkString("Files> ", keymap[curses.CtrlF][0].a)
+	check(actChangePreview, keymap[curses.CtrlF][1].t)
+	checkString("cat {}", keymap[curses.CtrlF][1].a)
+	check(actChangePreviewWindow, keymap[curses.CtrlF][2].t)
+	checkString("up:40%", keymap[curses.CtrlF][2].a)
+	check(actChangePreview, keymap[curses.CtrlG][0].t)
+	checkString("", keymap[curses.CtrlG][0].a)
+
+	parseKeymap(keymap, "alt-t:transform-prompt[date],ctrl-t:transform(echo up+down)+transform-query:echo {q}+x,y")
+	check(actTransform, keymap[curses.CtrlT][0].t)
+	checkString("echo up+down", keymap[curses.CtrlT][0].a)
+	check(actTransformQuery, keymap[curses.CtrlT][1].t)
+	checkString("echo {q}+x,y", keymap[curses.CtrlT][1].a)
+	check(actTransformPrompt, keymap[curses.AltA+'t'-'a'][0].t)
+	checkString("date", keymap[curses.AltA+'t'-'a'][0].a)
+
+	parseKeymap(keymap, "enter:print(enter: ok)+accept-non-empty,ctrl-o:print:+")
+	check(actPrint, keymap[curses.CtrlM][0].t)
+	checkString("enter: ok", keymap[curses.CtrlM][0].a)
+	check(actAcceptNonEmpty, keymap[curses.CtrlM][1].t)
+	check(actPrint, keymap[curses.CtrlO][0].t)
+	checkString("+", keymap[curses.CtrlO][0].a)
+
+	parseKeymap(keymap, "ctrl-t:toggle-track,ctrl-o:toggle-collapse")
+	check(actToggleTrack, keymap[curses.CtrlT][0].t)
+	check(actToggleCollapse, keymap[curses.CtrlO][0].t)
+
+	parseKeymap(keymap, "ctrl-h:change-header(a+b),ctrl-t:transform-header(echo {})")
+	check(actChangeHeader, keymap[curses.CtrlH][0].t)
+	checkString("a+b", keymap[curses.CtrlH][0].a)
+	check(actTransformHeader, keymap[curses.CtrlT][0].t)
+	checkString("echo {}", keymap[curses.CtrlT][0].a)
+}
 
-	parseKeymap(keymap, execmap, "f1:abort")
-	check(actAbort, keymap[curses.F1])
+func TestParseActionList(t *testing.T) {
+	actions, err := parseActionList("change-prompt(a+b> )+reload:ls -l")
+	if err != nil || len(actions) != 2 ||
+		actions[0].t != actChangePrompt || actions[0].a != "a+b> " ||
+		actions[1].t != actReload || actions[1].a != "ls -l" {
+		t.Errorf("%v %v", actions, err)
+	}
+	for _, str := range []string{"", "foo", "up+foo", "change-preview-window(foo)"} {
+		if _, err := parseActionList(str); err == nil {
+			t.Errorf("%q should be invalid", str)
+		}
+	}
 }
 
 func TestColorSpec(t *testing.T) {
@@ -300,6 +667,11 @@ func TestColorSpec(t *testing.T) {
 		t.Errorf("colors should now be equivalent")
 	}
 
+	customized = parseTheme(theme, "nth:231,dim:232")
+	if customized.Nth != 231 || customized.Dim != 232 {
+		t.Errorf("color not customized")
+	}
+
 	customized = parseTheme(theme, "fg:231,dark,bg:232")
 	if customized.Fg != curses.Dark256.Fg || customized.Bg == curses.Dark256.Bg {
 		t.Errorf("color not customized")
@@ -310,6 +682,11 @@ func TestColorSpec(t *testing.T) {
 	if !curses.Dark256.UseDefault {
 		t.Errorf("using default colors")
 	}
+
+	customized = parseTheme(theme, "border:#ff0000,hl:#FFFFFF")
+	if customized.Border != 196 || customized.Match != 231 {
+		t.Errorf("24-bit colors should be approximated: %v", customized)
+	}
 }
 
 func TestParseNilTheme(t *testing.T) {
@@ -329,7 +706,7 @@ func TestDefaultCtrlNP(t *testing.T) {
 		opts := defaultOptions()
 		parseOptions(opts, words)
 		postProcessOptions(opts)
-		if opts.Keymap[key] != expected {
+		if opts.Keymap[key][0].t != expected {
 			t.Error()
 		}
 	}
@@ -373,3 +750,126 @@ func TestToggle(t *testing.T) {
 		t.Error()
 	}
 }
+
+func TestTmuxOpts(t *testing.T) {
+	check := func(str string, args ...string) {
+		actual := parseTmuxOpts(str).popupArgs()
+		expected := append([]string{"display-popup", "-E"}, args...)
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Errorf("%s: %v != %v", str, actual, expected)
+		}
+	}
+	check("center", "-w", "50%", "-h", "50%", "-x", "C", "-y", "C")
+	check("80%", "-w", "80%", "-h", "80%", "-x", "C", "-y", "C")
+	check("80%,60%", "-w", "80%", "-h", "60%", "-x", "C", "-y", "C")
+	check("bottom,40%", "-w", "100%", "-h", "40%", "-x", "C", "-y", "9999")
+	check("top", "-w", "100%", "-h", "50%", "-x", "C", "-y", "0")
+	check("left,30", "-w", "30", "-h", "100%", "-x", "0", "-y", "C")
+	check("right,30%,50%", "-w", "30%", "-h", "50%", "-x", "R", "-y", "C")
+
+	if opts := defaultOptions(); opts.Tmux != nil {
+		t.Error()
+	}
+}
+
+func TestLabelOpts(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--border-label= Files ", "--border-label-pos=-2:bottom",
+		"--preview-label", "Diff", "--preview-label-pos", "3"})
+	if opts.BorderLabel != (labelOpts{" Files ", -2, true}) {
+		t.Errorf("%v", opts.BorderLabel)
+	}
+	if opts.Preview.label != (labelOpts{"Diff", 3, false}) {
+		t.Errorf("%v", opts.Preview.label)
+	}
+
+	parseOptions(opts, []string{"--border-label-pos=:bottom", "--preview-label-pos=0:top"})
+	if opts.BorderLabel != (labelOpts{" Files ", 0, true}) {
+		t.Errorf("%v", opts.BorderLabel)
+	}
+	if opts.Preview.label != (labelOpts{"Diff", 0, false}) {
+		t.Errorf("%v", opts.Preview.label)
+	}
+}
+
+func TestFooter(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--footer=enter: open\nctrl-t: toggle\n"})
+	if !reflect.DeepEqual(opts.Footer, []string{"enter: open", "ctrl-t: toggle"}) {
+		t.Errorf("%q", opts.Footer)
+	}
+	parseOptions(opts, []string{"--footer", ""})
+	if opts.Footer != nil {
+		t.Errorf("%q", opts.Footer)
+	}
+	parseOptions(opts, []string{"--footer", "foo", "--no-footer"})
+	if opts.Footer != nil {
+		t.Errorf("%q", opts.Footer)
+	}
+
+	keymap := defaultKeymap()
+	parseKeymap(keymap, "ctrl-t:change-footer(a: b)")
+	if act := keymap[curses.CtrlT][0]; act.t != actChangeFooter || act.a != "a: b" {
+		t.Errorf("%v", act)
+	}
+}
+
+func TestAltScreen(t *testing.T) {
+	check := func(expected string, words ...string) {
+		opts := defaultOptions()
+		parseOptions(opts, words)
+		postProcessOptions(opts)
+		if opts.Height != expected {
+			t.Errorf("%v: %q (expected: %q)", words, opts.Height, expected)
+		}
+	}
+	check("")
+	check("100%", "--no-alt-screen")
+	check("100%", "--no-clear")
+	check("", "--no-clear", "--clear")
+	check("", "--no-alt-screen", "--alt-screen")
+	check("40%", "--no-clear", "--height=40%")
+}
+
+func TestPlain(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--color=fg:1", "--plain", "--bell"})
+	postProcessOptions(opts)
+	if !opts.Plain || !opts.Bell || opts.Theme != nil || opts.AutoTheme || opts.Hscroll {
+		t.Errorf("plain: %v, bell: %v, theme: %v, hscroll: %v", opts.Plain, opts.Bell, opts.Theme, opts.Hscroll)
+	}
+
+	opts = defaultOptions()
+	parseOptions(opts, []string{"--plain", "--no-plain"})
+	postProcessOptions(opts)
+	if opts.Plain || opts.Theme == nil || !opts.Hscroll {
+		t.Error("plain mode not disabled")
+	}
+}
+
+func TestChunkSize(t *testing.T) {
+	opts := defaultOptions()
+	if opts.ChunkSize != defaultChunkSize {
+		t.Errorf("default chunk size: %d", opts.ChunkSize)
+	}
+	parseOptions(opts, []string{"--chunk-size", "500"})
+	if opts.ChunkSize != 500 {
+		t.Errorf("chunk size: %d", opts.ChunkSize)
+	}
+	parseOptions(opts, []string{"--chunk-size=1000"})
+	if opts.ChunkSize != 1000 {
+		t.Errorf("chunk size: %d", opts.ChunkSize)
+	}
+}
+
+func TestIntern(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--intern"})
+	if !opts.Intern {
+		t.Error("intern not enabled")
+	}
+	parseOptions(opts, []string{"--no-intern"})
+	if opts.Intern {
+		t.Error("intern not disabled")
+	}
+}
@@ -1,6 +1,7 @@
 package fzf
 
 import (
+	"fmt"
 	"regexp"
 	"sort"
 	"strings"
@@ -47,6 +48,8 @@ type Pattern struct {
 	text          []rune
 	termSets      []termSet
 	cacheable     bool
+	cacheScope    string
+	ownTokens     bool
 	delimiter     Delimiter
 	nth           []Range
 	procFun       map[termType]func(bool, bool, []rune, []rune) (int, int)
@@ -78,17 +81,29 @@ func clearChunkCache() {
 func BuildPattern(fuzzy bool, extended bool, caseMode Case, forward bool,
 	nth []Range, delimiter Delimiter, runes []rune) *Pattern {
 
-	var asString string
-	if extended {
-		asString = strings.Trim(string(runes), " ")
-	} else {
-		asString = string(runes)
-	}
-
+	asString := patternString(extended, runes)
 	cached, found := _patternCache[asString]
 	if found {
 		return cached
 	}
+	ptr := buildPattern(fuzzy, extended, caseMode, forward, nth, delimiter, asString)
+	_patternCache[asString] = ptr
+	return ptr
+}
+
+// patternString returns the query string for the pattern, which is trimmed in
+// extended-search mode
+func patternString(extended bool, runes []rune) string {
+	if extended {
+		return strings.Trim(string(runes), " ")
+	}
+	return string(runes)
+}
+
+// buildPattern builds Pattern object for the query string without the cache,
+// which is only accessed by the matcher
+func buildPattern(fuzzy bool, extended bool, caseMode Case, forward bool,
+	nth []Range, delimiter Delimiter, asString string) *Pattern {
 
 	caseSensitive, cacheable := true, true
 	termSets := []termSet{}
@@ -123,18 +138,29 @@ func BuildPattern(fuzzy bool, extended bool, caseMode Case, forward bool,
 		text:          []rune(asString),
 		termSets:      termSets,
 		cacheable:     cacheable,
+		cacheScope:    cacheScope(fuzzy, extended, []Case{caseMode}, nth, delimiter),
 		nth:           nth,
 		delimiter:     delimiter,
-		procFun:       make(map[termType]func(bool, bool, []rune, []rune) (int, int))}
+		procFun:       buildProcFun()}
+	return ptr
+}
 
-	ptr.procFun[termFuzzy] = algo.FuzzyMatch
-	ptr.procFun[termEqual] = algo.EqualMatch
-	ptr.procFun[termExact] = algo.ExactMatchNaive
-	ptr.procFun[termPrefix] = algo.PrefixMatch
-	ptr.procFun[termSuffix] = algo.SuffixMatch
+// cacheScope returns the prefix of the keys of the chunk cache for the
+// settings of the pattern, so that the patterns only differing in the
+// settings do not share the cached results. cases is the case mode of the
+// pattern, or the ones of the terms of a Query.
+func cacheScope(fuzzy bool, extended bool, cases []Case, nth []Range, delimiter Delimiter) string {
+	return fmt.Sprintf("%v %v %v %v %q\x00", fuzzy, extended, cases, nth, delimiter.String())
+}
 
-	_patternCache[asString] = ptr
-	return ptr
+func buildProcFun() map[termType]func(bool, bool, []rune, []rune) (int, int) {
+	procFun := make(map[termType]func(bool, bool, []rune, []rune) (int, int))
+	procFun[termFuzzy] = algo.FuzzyMatch
+	procFun[termEqual] = algo.EqualMatch
+	procFun[termExact] = algo.ExactMatchNaive
+	procFun[termPrefix] = algo.PrefixMatch
+	procFun[termSuffix] = algo.SuffixMatch
+	return procFun
 }
 
 func parseTerms(fuzzy bool, caseMode Case, str string) []termSet {
@@ -241,11 +267,16 @@ func (p *Pattern) Match(chunk *Chunk) []*Item {
 	// ChunkCache: Exact match
 	cacheKey := p.CacheKey()
 	if p.cacheable {
-		if cached, found := _cache.Find(chunk, cacheKey); found {
+		if cached, found := _cache.Find(chunk, p.cacheScope+cacheKey); found {
 			return cached
 		}
 	}
 
+	// ChunkCache: Skip the chunk without some of the characters in the pattern
+	if !_cache.MayMatch(chunk, p) {
+		return []*Item{}
+	}
+
 	// ChunkCache: Prefix/suffix match
 Loop:
 	for idx := 1; idx < len(cacheKey); idx++ {
@@ -255,7 +286,7 @@ Loop:
 		prefix := cacheKey[:len(cacheKey)-idx]
 		suffix := cacheKey[idx:]
 		for _, substr := range [2]*string{&prefix, &suffix} {
-			if cached, found := _cache.Find(chunk, *substr); found {
+			if cached, found := _cache.Find(chunk, p.cacheScope+*substr); found {
 				cachedChunk := Chunk(cached)
 				space = &cachedChunk
 				break Loop
@@ -265,8 +296,8 @@ Loop:
 
 	matches := p.matchChunk(space)
 
-	if p.cacheable {
-		_cache.Add(chunk, cacheKey, matches)
+	if p.cacheable && len(cacheKey) > 0 {
+		_cache.Add(chunk, p.cacheScope+cacheKey, matches)
 	}
 	return matches
 }
@@ -290,6 +321,39 @@ func (p *Pattern) matchChunk(chunk *Chunk) []*Item {
 	return matches
 }
 
+// MatchItems returns the list of matches in the given list of Items. Unlike
+// Match, it does not consult ChunkCache so it can be used for an ad-hoc list
+// of items such as the selection set.
+func (p *Pattern) MatchItems(items []*Item) []*Item {
+	chunk := Chunk(items)
+	return p.matchChunk(&chunk)
+}
+
+// Rescore matches the given items again using the algorithm that finds the
+// shortest fuzzy match, so that they can be ranked more accurately. It is
+// much slower than Match and meant for a small number of top-ranked items.
+func (p *Pattern) Rescore(items []*Item) []*Item {
+	rescorer := *p
+	rescorer.procFun = buildProcFun()
+	rescorer.procFun[termFuzzy] = algo.FuzzyMatchShortest
+	return rescorer.MatchItems(items)
+}
+
+// IsRescorable returns true if Rescore can yield a different result
+func (p *Pattern) IsRescorable() bool {
+	if !p.extended {
+		return p.fuzzy && len(p.text) > 1
+	}
+	for _, termSet := range p.termSets {
+		for _, term := range termSet {
+			if term.typ == termFuzzy && !term.inv && len(term.text) > 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // MatchItem returns true if the Item is a match
 func (p *Pattern) MatchItem(item *Item) bool {
 	if !p.extended {
@@ -308,15 +372,17 @@ func dupItem(item *Item, offsets []Offset) *Item {
 		transformed: item.transformed,
 		offsets:     offsets,
 		colors:      item.colors,
-		rank:        buildEmptyRank(item.Index())}
+		rank:        buildEmptyRank(item.Index()),
+		boosted:     item.boosted,
+		payload:     item.payload}
 }
 
 func (p *Pattern) basicMatch(item *Item) (int, int, int) {
 	input := p.prepareInput(item)
 	if p.fuzzy {
-		return p.iter(algo.FuzzyMatch, input, p.caseSensitive, p.forward, p.text)
+		return p.iter(p.procFun[termFuzzy], input, p.caseSensitive, p.forward, p.text)
 	}
-	return p.iter(algo.ExactMatchNaive, input, p.caseSensitive, p.forward, p.text)
+	return p.iter(p.procFun[termExact], input, p.caseSensitive, p.forward, p.text)
 }
 
 func (p *Pattern) extendedMatch(item *Item) []Offset {
@@ -344,8 +410,26 @@ func (p *Pattern) extendedMatch(item *Item) []Offset {
 	return offsets
 }
 
+// matchLine returns the offsets of the terms of the pattern found in the line,
+// which is searched as a whole regardless of --nth
+func (p *Pattern) matchLine(line []rune) []Offset {
+	if p.IsEmpty() {
+		return nil
+	}
+	item := &Item{text: line, transformed: []Token{{text: line, prefixLength: 0, trimLength: util.TrimLen(line)}}}
+	if !p.extended {
+		if sidx, eidx, tlen := p.basicMatch(item); sidx >= 0 {
+			return []Offset{{int32(sidx), int32(eidx), int32(tlen)}}
+		}
+		return nil
+	}
+	return p.extendedMatch(item)
+}
+
+// prepareInput returns the tokens of the item in the search scope. They are
+// kept in the item for the next patterns unless the pattern has its own scope.
 func (p *Pattern) prepareInput(item *Item) []Token {
-	if item.transformed != nil {
+	if item.transformed != nil && !p.ownTokens {
 		return item.transformed
 	}
 
@@ -356,7 +440,9 @@ func (p *Pattern) prepareInput(item *Item) []Token {
 	} else {
 		ret = []Token{Token{text: item.text, prefixLength: 0, trimLength: util.TrimLen(item.text)}}
 	}
-	item.transformed = ret
+	if !p.ownTokens {
+		item.transformed = ret
+	}
 	return ret
 }
 
@@ -141,6 +141,21 @@ func TestOrigTextAndTransformed(t *testing.T) {
 	}
 }
 
+func TestMatchLine(t *testing.T) {
+	test := func(extended bool, patStr string, line string, expected []Offset) {
+		pat := buildPattern(true, extended, CaseSmart, true, []Range{Range{2, 2}}, Delimiter{},
+			patternString(extended, []rune(patStr)))
+		if offsets := pat.matchLine([]rune(line)); !reflect.DeepEqual(offsets, expected) {
+			t.Errorf("%s / %s: %v (expected: %v)", patStr, line, offsets, expected)
+		}
+	}
+	test(false, "", "foo bar", nil)
+	test(false, "fb", "foo bar", []Offset{{0, 5, 7}})
+	test(false, "xyz", "foo bar", nil)
+	test(true, " 'bar foo ", "foo bar", []Offset{{4, 7, 7}, {0, 3, 7}})
+	test(true, "!baz 'bar", "foo bar", []Offset{{0, 0, 0}, {4, 7, 7}})
+}
+
 func TestCacheKey(t *testing.T) {
 	test := func(extended bool, patStr string, expected string, cacheable bool) {
 		pat := BuildPattern(true, extended, CaseSmart, true, []Range{}, Delimiter{}, []rune(patStr))
@@ -162,3 +177,42 @@ func TestCacheKey(t *testing.T) {
 	test(true, "foo | bar !baz", "", false)
 	test(true, "| | | foo", "foo", true)
 }
+
+func TestMatchItems(t *testing.T) {
+	defer clearPatternCache()
+	clearPatternCache()
+	pattern := BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, []rune("fo"))
+	items := []*Item{
+		&Item{text: []rune("foo"), rank: buildEmptyRank(0)},
+		&Item{text: []rune("bar"), rank: buildEmptyRank(1)},
+		&Item{text: []rune("f_o"), rank: buildEmptyRank(2)}}
+	matches := pattern.MatchItems(items)
+	if len(matches) != 2 || matches[0].Index() != 0 || matches[1].Index() != 2 {
+		t.Errorf("%v", matches)
+	}
+}
+
+func TestRescore(t *testing.T) {
+	defer clearPatternCache()
+	clearPatternCache()
+	sortCriteria = []criterion{byMatchLen, byLength}
+	pattern := BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, []rune("ab"))
+	if !pattern.IsRescorable() {
+		t.Error("Fuzzy pattern should be rescorable")
+	}
+	items := pattern.MatchItems([]*Item{&Item{text: []rune("a_b__ab"), rank: buildEmptyRank(3)}})
+	rescored := pattern.Rescore(items)
+	if len(rescored) != 1 || rescored[0].Index() != 3 ||
+		rescored[0].offsets[0][0] != 5 || rescored[0].offsets[0][1] != 7 {
+		t.Errorf("%v", rescored)
+	}
+	if rescored[0].Rank(false)[0] >= items[0].Rank(false)[0] {
+		t.Error("Match length should decrease")
+	}
+
+	clearPatternCache()
+	pattern = BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, []rune("'ab ^a !b$"))
+	if pattern.IsRescorable() {
+		t.Error("Pattern without fuzzy terms is not rescorable")
+	}
+}
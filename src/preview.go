@@ -0,0 +1,803 @@
+package fzf
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	C "github.com/junegunn/fzf/src/curses"
+	"github.com/junegunn/fzf/src/util"
+)
+
+type previewPosition int
+
+const (
+	posUp previewPosition = iota
+	posDown
+	posLeft
+	posRight
+)
+
+type previewOpts struct {
+	command   string
+	position  previewPosition
+	size      string
+	hidden    bool
+	scroll    string
+	follow    bool
+	highlight bool
+	label     labelOpts
+}
+
+func defaultPreviewOpts(command string) previewOpts {
+	return previewOpts{command, posRight, "50%", false, "", false, false, labelOpts{}}
+}
+
+var numberRegex = regexp.MustCompile("[0-9]+")
+
+// previewScrollRegex matches the expression for the initial scroll offset of
+// the preview window. The base is the line number or the field of the item
+// containing it, which can be followed by the number of lines to subtract or
+// the fraction of the window height.
+var previewScrollRegex = regexp.MustCompile(`^\+([0-9]+|\{-?[0-9]+\})(-[0-9]+|-/[1-9][0-9]*)?$`)
+
+// screenArea is a rectangular region of the screen such as the one for the
+// preview window including its border
+type screenArea struct {
+	y      int
+	x      int
+	height int
+	width  int
+}
+
+// graphicsRegex matches the escape sequences of the terminal graphics
+// protocols: APC sequences of kitty, DCS sequences of sixel, and OSC 1337
+// sequences of iTerm2
+var graphicsRegex = regexp.MustCompile(
+	"\x1b_G[^\x1b]*\x1b\\\\|\x1bP[0-9;]*q[^\x1b]*\x1b\\\\|\x1b\\]1337;File=[^\x07\x1b]*(\x07|\x1b\\\\)")
+
+var (
+	kittyControlRegex = regexp.MustCompile(`\x1b_G([^;\x1b]*)`)
+	sixelRowsRegex    = regexp.MustCompile(`\x1bP[0-9;]*q"[0-9]+;[0-9]+;[0-9]+;([0-9]+)`)
+	itermHeightRegex  = regexp.MustCompile(`\x1b\]1337;File=[^:\x07\x1b]*height=([0-9]+)(px|%)?`)
+)
+
+// previewImage is an image in the output of the preview command drawn on the
+// row of the preview window
+type previewImage struct {
+	row int
+	seq string
+}
+
+// previewer runs the preview command for the current item in the background
+type previewer struct {
+	command string
+	notify  func()
+	environ func() []string
+	mutex   sync.Mutex
+	started bool
+	item    *string
+	index   int32
+	version int
+	process *os.Process
+	// The output of the command for the version is appended to data, and
+	// text is converted from it when it is displayed
+	data    []byte
+	dataVer int
+	dirty   bool
+	text    string
+	offset  int
+	follow  bool
+}
+
+func newPreviewer(command string, notify func()) *previewer {
+	return &previewer{command: command, notify: notify}
+}
+
+// request starts the command for the item at the 0-based index in the input
+// unless it is already the one being previewed. The command for the previous
+// item is killed, and its output is discarded. A nil item clears the preview.
+// The output is displayed from the line at the offset.
+func (p *previewer) request(item *string, index int32, offset int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.started && (item == nil && p.item == nil ||
+		item != nil && p.item != nil && *item == *p.item && index == p.index) {
+		return
+	}
+	p.started = true
+	p.item = item
+	p.index = index
+	p.version++
+	p.offset = offset
+	if p.process != nil {
+		p.process.Kill()
+		p.process = nil
+	}
+	if item == nil {
+		p.setText("")
+		go p.notify()
+		return
+	}
+
+	command := strings.Replace(p.command, "{n}", strconv.Itoa(int(index)), -1)
+	cmd := util.ExecCommand(strings.Replace(command, "{}", quoteEntry(*item), -1))
+	if p.environ != nil {
+		cmd.Env = p.environ()
+	}
+	out, err := cmd.StdoutPipe()
+	if err == nil {
+		cmd.Stderr = cmd.Stdout
+		err = cmd.Start()
+	}
+	if err != nil {
+		p.setText(err.Error())
+		go p.notify()
+		return
+	}
+	p.process = cmd.Process
+
+	version := p.version
+	go func() {
+		// The output is displayed as it arrives so that the preview window
+		// can follow the output of a long-running command
+		received := false
+		buf := make([]byte, 4096)
+		for {
+			n, err := out.Read(buf)
+			if n > 0 {
+				received = true
+				if !p.update(version, buf[:n]) {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		// We don't need the rest of the output
+		cmd.Process.Kill()
+		cmd.Wait()
+
+		p.mutex.Lock()
+		current := version == p.version
+		if current {
+			p.process = nil
+			p.offset = util.Min(p.offset, p.lines()-1)
+		}
+		p.mutex.Unlock()
+		if current && !received {
+			p.update(version, nil)
+		}
+	}()
+}
+
+// update appends the output of the command to the text if it is for the
+// current item. The first output for the item replaces the text of the
+// previous one. Once the output reaches previewBufferMax, the rest of it is
+// discarded, or the beginning of it in follow mode. It returns false if the
+// item has changed or no more output is needed.
+func (p *previewer) update(version int, data []byte) bool {
+	p.mutex.Lock()
+	current := version == p.version
+	more := current
+	if current {
+		if p.dataVer != version {
+			p.data = nil
+			p.dataVer = version
+		}
+		p.data = append(p.data, data...)
+		if len(p.data) >= previewBufferMax {
+			if p.follow {
+				// Keep the last half of the output from the start of a line
+				tail := p.data[len(p.data)-previewBufferMax/2:]
+				if idx := bytes.IndexByte(tail, '\n'); idx >= 0 {
+					tail = tail[idx+1:]
+				}
+				p.data = append([]byte{}, tail...)
+			} else {
+				p.data = p.data[:previewBufferMax]
+				more = false
+			}
+		}
+		p.dirty = true
+	}
+	p.mutex.Unlock()
+	if current {
+		p.notify()
+	}
+	return more
+}
+
+// setText replaces the text. The caller holds the mutex.
+func (p *previewer) setText(text string) {
+	p.text = text
+	p.data = nil
+	p.dirty = false
+}
+
+// content returns the text converted from the output received so far. The
+// caller holds the mutex.
+func (p *previewer) content() string {
+	if p.dirty {
+		p.text = string(p.data)
+		p.dirty = false
+	}
+	return p.text
+}
+
+// lines returns the number of the lines of the text. The caller holds the
+// mutex.
+func (p *previewer) lines() int {
+	return strings.Count(strings.TrimRight(p.content(), "\n"), "\n") + 1
+}
+
+// output returns the output of the command and the offset of the first line
+// to display. If follow is set, the last lines of the output are to be
+// displayed instead.
+func (p *previewer) output() (text string, offset int, follow bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.content(), p.offset, p.follow
+}
+
+// toggleFollow turns on or off follow mode, in which the preview window
+// displays the end of the output
+func (p *previewer) toggleFollow() {
+	p.mutex.Lock()
+	p.follow = !p.follow
+	p.mutex.Unlock()
+}
+
+// scroll moves the first line of the preview window by diff lines, or to the
+// given line if absolute is set, so that the last line of the output can
+// still fill the window of the height. Follow mode is turned off unless the
+// window stays at the end of the output. It returns false if the window
+// doesn't move.
+func (p *previewer) scroll(diff int, absolute bool, height int) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	max := util.Max(0, p.lines()-height)
+	if p.follow {
+		p.offset = max
+	}
+	offset := p.offset + diff
+	if absolute {
+		offset = diff
+	}
+	offset = util.Constrain(offset, 0, max)
+	p.follow = p.follow && offset == max
+	if offset == p.offset {
+		return false
+	}
+	p.offset = offset
+	return true
+}
+
+// setCommand replaces the preview command. The command is run again for the
+// current item on the next request.
+func (p *previewer) setCommand(command string) {
+	p.mutex.Lock()
+	p.command = command
+	p.started = false
+	p.mutex.Unlock()
+}
+
+// rerun makes the command run again for the current item on the next request
+func (p *previewer) rerun() {
+	p.mutex.Lock()
+	p.started = false
+	p.mutex.Unlock()
+}
+
+// newPreviewer starts the previewer for the preview options
+func (t *Terminal) newPreviewer() {
+	t.previewer = newPreviewer(t.preview.command, func() {
+		t.reqBox.Set(reqPreview, nil)
+	})
+	t.previewer.follow = t.preview.follow
+	t.previewer.environ = t.environ
+}
+
+// changePreview replaces the preview command. The preview window is opened if
+// there wasn't one, and the empty command closes it. It returns true if the
+// layout of the screen changes.
+func (t *Terminal) changePreview(command string) bool {
+	t.preview.command = command
+	if len(command) == 0 {
+		if t.previewer == nil {
+			return false
+		}
+		t.previewer.request(nil, 0, 0)
+		t.previewer = nil
+		return true
+	}
+	if t.previewer == nil {
+		t.newPreviewer()
+		return true
+	}
+	t.previewer.setCommand(command)
+	return false
+}
+
+// changePreviewWindow applies the layout of the preview window on top of the
+// one given by --preview-window
+func (t *Terminal) changePreviewWindow(layout string) {
+	preview := t.previewBase
+	if len(layout) > 0 {
+		// The layout is validated when the action is parsed
+		parsePreviewWindow(&preview, layout)
+	}
+	preview.command = t.preview.command
+	preview.label = t.preview.label
+	t.preview = preview
+	if t.previewer != nil {
+		t.previewer.mutex.Lock()
+		t.previewer.follow = preview.follow
+		t.previewer.mutex.Unlock()
+	}
+}
+
+func (t *Terminal) hasPreviewWindow() bool {
+	return t.previewer != nil && !t.preview.hidden
+}
+
+// previewTextArea returns the part of the preview window for the output of
+// the command, and the line or column of its border
+func (t *Terminal) previewTextArea() (screenArea, int) {
+	area, border := paneTextArea(t.previewArea, t.preview.position)
+	if t.hasPreviewLabelLine() {
+		if !t.preview.label.bottom {
+			area.y++
+		}
+		area.height--
+	}
+	return area, border
+}
+
+// previewPattern returns the pattern of the query to highlight the matches in
+// the output of the preview command, or nil if they are not highlighted
+func (t *Terminal) previewPattern() *Pattern {
+	if !t.preview.highlight || t.newPattern == nil {
+		return nil
+	}
+	return t.newPattern(t.input)
+}
+
+// previewMatches returns the offsets of the matches of the pattern in the line
+// of the preview window to highlight
+func previewMatches(pattern *Pattern, line []rune) []colorOffset {
+	if pattern == nil || len(line) == 0 {
+		return nil
+	}
+	matches := pattern.matchLine(line)
+	sort.Sort(ByOrder(matches))
+	offsets := []colorOffset{}
+	for _, offset := range matches {
+		if offset[0] < offset[1] {
+			offsets = append(offsets, colorOffset{offset: [2]int32{offset[0], offset[1]}, color: C.ColMatch, bold: false})
+		}
+	}
+	return offsets
+}
+
+// paneTextArea returns the part of the area of the pane at the position inside
+// the border on the side of the list, and the line or column of the border
+func paneTextArea(area screenArea, position previewPosition) (screenArea, int) {
+	var border int
+	switch position {
+	case posUp:
+		border = area.y + area.height - 1
+		area.height--
+	case posDown:
+		border = area.y
+		area.y++
+		area.height--
+	case posLeft:
+		border = area.x + area.width - 1
+		area.width -= 2
+	case posRight:
+		border = area.x
+		area.x += 2
+		area.width -= 2
+	}
+	return area, border
+}
+
+// printPaneBorder prints the border of the pane at the position on the line
+// or the column
+func printPaneBorder(area screenArea, position previewPosition, border int) {
+	switch position {
+	case posUp, posDown:
+		C.Move(border, area.x)
+		C.CPrint(C.ColBorder, false, strings.Repeat("─", area.width))
+	case posLeft, posRight:
+		for row := 0; row < area.height; row++ {
+			C.Move(area.y+row, border)
+			C.CPrint(C.ColBorder, false, "│")
+		}
+	}
+}
+
+// hasPreviewLabelLine tells if a line is added to the preview window for the
+// label, which is otherwise printed on the border line of the window
+func (t *Terminal) hasPreviewLabelLine() bool {
+	if len(t.preview.label.label) == 0 {
+		return false
+	}
+	switch t.preview.position {
+	case posUp:
+		return !t.preview.label.bottom
+	case posDown:
+		return t.preview.label.bottom
+	}
+	return true
+}
+
+// inPreviewArea tells if the position is inside the preview window including
+// its border
+func (t *Terminal) inPreviewArea(y int, x int) bool {
+	area := t.previewArea
+	return t.hasPreviewWindow() && y >= area.y && y < area.y+area.height &&
+		x >= area.x && x < area.x+area.width
+}
+
+// onPreviewBorder tells if the position is on the border of the preview window
+// on the side of the list, which can be dragged to resize the window
+func (t *Terminal) onPreviewBorder(y int, x int) bool {
+	_, border := t.previewTextArea()
+	switch t.preview.position {
+	case posUp, posDown:
+		return y == border
+	}
+	return x == border
+}
+
+// dragPreview resizes the preview window so that its border is moved to the
+// position where it is released. It returns false if the border is not moved.
+func (t *Terminal) dragPreview(y int, x int) bool {
+	if !t.hasPreviewWindow() || t.onPreviewBorder(y, x) {
+		return false
+	}
+	area := t.previewArea
+	var size int
+	switch t.preview.position {
+	case posUp:
+		size = y - area.y + 1
+	case posDown:
+		size = area.y + area.height - y
+	case posLeft:
+		size = x - area.x + 1
+	case posRight:
+		size = area.x + area.width - x
+	}
+	return t.resizePreview(size)
+}
+
+// previewLength returns the current width or height of the preview window
+// including its border in the direction it can be resized
+func (t *Terminal) previewLength() int {
+	switch t.preview.position {
+	case posUp, posDown:
+		return t.previewArea.height
+	}
+	return t.previewArea.width
+}
+
+// resizePreview changes the size of the preview window to the number of the
+// lines or the columns. The size is kept as the ratio to the space for the
+// list and the preview window, which persists across the changes of the
+// layout for the rest of the session. It returns false if the size doesn't
+// change.
+func (t *Terminal) resizePreview(size int) bool {
+	if t.previewSpan < 1 {
+		return false
+	}
+	min := minWidth
+	if t.preview.position == posUp || t.preview.position == posDown {
+		min = minHeight
+	}
+	size = util.Constrain(size, 2, util.Max(t.previewSpan-min, 2))
+	if size == t.previewLength() {
+		return false
+	}
+	// Half a cell is added so that the size is not rounded down
+	ratio := (float64(size) + 0.5) * 100 / float64(t.previewSpan)
+	t.preview.size = strconv.FormatFloat(ratio, 'f', 2, 64) + "%"
+	t.previewBase.size = t.preview.size
+	return true
+}
+
+// clickPreview handles a click on the preview window. Clicking on the border
+// scrolls the output to the relative position of the click along the border
+// like a scroll bar. It returns false if the preview window doesn't change.
+func (t *Terminal) clickPreview(y int, x int) bool {
+	area, border := t.previewTextArea()
+	if area.height < 1 {
+		return false
+	}
+	text, _, _ := t.previewer.output()
+	lines := strings.Count(strings.TrimRight(text, "\n"), "\n") + 1
+	var pos, length int
+	switch t.preview.position {
+	case posUp, posDown:
+		if y != border {
+			return false
+		}
+		pos, length = x-area.x, area.width
+	case posLeft, posRight:
+		if x != border {
+			return false
+		}
+		pos, length = y-area.y, area.height
+	}
+	if length < 2 {
+		return false
+	}
+	offset := pos * util.Max(0, lines-area.height) / (length - 1)
+	return t.previewer.scroll(offset, true, area.height)
+}
+
+// calculatePreviewArea takes the space for the preview window out of the
+// area inside the margins, leaving at least the minimum space for the list
+func (t *Terminal) calculatePreviewArea(screenWidth int, screenHeight int) {
+	if !t.hasPreviewWindow() {
+		return
+	}
+	if t.preview.position == posUp || t.preview.position == posDown {
+		t.previewSpan = screenHeight - t.marginInt[0] - t.marginInt[2]
+	} else {
+		t.previewSpan = screenWidth - t.marginInt[1] - t.marginInt[3]
+	}
+	t.previewArea = t.paneArea(t.preview.position, t.preview.size, screenWidth, screenHeight)
+}
+
+// paneArea takes the area of the size at the position for a pane such as the
+// preview window from the screen inside the margins, and moves the margins
+// inside the rest of it
+func (t *Terminal) paneArea(position previewPosition, sizeStr string, screenWidth int, screenHeight int) screenArea {
+	top, right, bottom, left := t.marginInt[0], t.marginInt[1], t.marginInt[2], t.marginInt[3]
+	width := screenWidth - right - left
+	height := screenHeight - top - bottom
+
+	vertical := position == posUp || position == posDown
+	max := width - minWidth
+	if vertical {
+		max = height - minHeight
+	}
+	var size int
+	if strings.HasSuffix(sizeStr, "%") {
+		num, _ := strconv.ParseFloat(sizeStr[:len(sizeStr)-1], 64)
+		if vertical {
+			size = int(float64(height) * num * 0.01)
+		} else {
+			size = int(float64(width) * num * 0.01)
+		}
+	} else {
+		size, _ = strconv.Atoi(sizeStr)
+	}
+	size = util.Constrain(size, 0, util.Max(max, 0))
+
+	var area screenArea
+	switch position {
+	case posUp:
+		area = screenArea{top, left, size, width}
+		t.marginInt[0] += size
+	case posDown:
+		area = screenArea{screenHeight - bottom - size, left, size, width}
+		t.marginInt[2] += size
+	case posLeft:
+		area = screenArea{top, left, height, size}
+		t.marginInt[3] += size
+	case posRight:
+		area = screenArea{top, screenWidth - right - size, height, size}
+		t.marginInt[1] += size
+	}
+	return area
+}
+
+// requestPreview starts the preview command for the current item
+func (t *Terminal) requestPreview() {
+	if !t.hasPreviewWindow() {
+		return
+	}
+	var item *string
+	var index int32
+	var offset int
+	if t.cy >= 0 && t.cy < t.merger.Length() {
+		current := t.merger.Get(t.cy)
+		item = current.StringPtr(t.ansi)
+		index = current.Index()
+		area, _ := t.previewTextArea()
+		offset = t.previewOffset(*item, area.height)
+	}
+	t.previewer.request(item, index, offset)
+}
+
+// previewOffset evaluates the scroll offset expression of the preview window
+// for the item. For example, +{2}-/2 places the line whose number is in the
+// second field of the item at the middle of the window.
+func (t *Terminal) previewOffset(item string, height int) int {
+	match := previewScrollRegex.FindStringSubmatch(t.preview.scroll)
+	if match == nil {
+		return 0
+	}
+	base := match[1]
+	if strings.HasPrefix(base, "{") {
+		field := base[1 : len(base)-1]
+		r, _ := ParseRange(&field)
+		tokens := Transform(Tokenize([]rune(item), t.delimiter), []Range{r})
+		base = numberRegex.FindString(string(joinTokens(tokens)))
+	}
+	line, err := strconv.Atoi(base)
+	if err != nil {
+		return 0
+	}
+	offset := line - 1
+	if strings.HasPrefix(match[2], "-/") {
+		num, _ := strconv.Atoi(match[2][2:])
+		offset -= height / num
+	} else if len(match[2]) > 0 {
+		num, _ := strconv.Atoi(match[2][1:])
+		offset -= num
+	}
+	return util.Max(0, offset)
+}
+
+// extractGraphics removes the sequences of the terminal graphics protocols
+// from the line and returns them
+func extractGraphics(line string) (string, string) {
+	seqs := graphicsRegex.FindAllString(line, -1)
+	if len(seqs) == 0 {
+		return line, ""
+	}
+	return graphicsRegex.ReplaceAllString(line, ""), strings.Join(seqs, "")
+}
+
+// graphicsRows returns the number of lines covered by the image of the
+// sequences in the window of the height, or 0 if it is not known from the
+// sequences. The height of the image in pixels is converted with the height
+// of a character cell, which is 0 if unknown.
+func graphicsRows(seq string, height int, cellHeight int) int {
+	pixels := func(num int) int {
+		if cellHeight <= 0 {
+			return 0
+		}
+		return (num + cellHeight - 1) / cellHeight
+	}
+	if match := kittyControlRegex.FindStringSubmatch(seq); match != nil {
+		// Number of rows to display the image over, or the height of the
+		// image in pixels
+		rows := 0
+		for _, pair := range strings.Split(match[1], ",") {
+			if len(pair) < 3 {
+				continue
+			}
+			num, err := strconv.Atoi(pair[2:])
+			if err != nil {
+				continue
+			}
+			switch pair[:2] {
+			case "r=":
+				return num
+			case "v=":
+				rows = pixels(num)
+			}
+		}
+		return rows
+	}
+	if match := sixelRowsRegex.FindStringSubmatch(seq); match != nil {
+		num, _ := strconv.Atoi(match[1])
+		return pixels(num)
+	}
+	if match := itermHeightRegex.FindStringSubmatch(seq); match != nil {
+		num, _ := strconv.Atoi(match[1])
+		switch match[2] {
+		case "px":
+			return pixels(num)
+		case "%":
+			return height * num / 100
+		}
+		return num
+	}
+	return 0
+}
+
+// printGraphics draws the images in the preview window unless the same images
+// are already on the screen. The previous images are cleared first.
+func (t *Terminal) printGraphics(area screenArea, images []previewImage) {
+	key := ""
+	for _, image := range images {
+		key += strconv.Itoa(image.row) + ":" + image.seq
+	}
+	if key == t.images && area == t.imageArea && C.Incremental() {
+		return
+	}
+	t.clearGraphics()
+	for _, image := range images {
+		C.DrawGraphics(area.y+image.row, area.x, image.seq)
+	}
+	t.images, t.imageArea = key, area
+}
+
+// clearGraphics removes the images in the preview window
+func (t *Terminal) clearGraphics() {
+	if len(t.images) > 0 {
+		C.ClearGraphics(t.imageArea.y, t.imageArea.height)
+		t.images = ""
+	}
+}
+
+// printPreview draws the preview window. It is called after the other parts
+// of the screen are updated as clearing the lines of the list can also erase
+// the preview window on the same lines.
+func (t *Terminal) printPreview() {
+	area := t.previewArea
+	if !t.hasPreviewWindow() || area.width < 3 || area.height < 2 {
+		t.clearGraphics()
+		return
+	}
+
+	// Border and the area for the text
+	text, border := t.previewTextArea()
+	y, x, height, width := text.y, text.x, text.height, text.width
+	printPaneBorder(area, t.preview.position, border)
+	if len(t.preview.label.label) > 0 {
+		x, width := area.x, area.width
+		if t.hasPreviewLabelLine() {
+			x, width = text.x, text.width
+			y := area.y
+			if t.preview.label.bottom {
+				y = area.y + area.height - 1
+			}
+			C.Move(y, x)
+			C.CPrint(C.ColBorder, false, strings.Repeat("─", width))
+		}
+		t.printBorderLabel(t.preview.label, area, x, width)
+	}
+
+	output, offset, follow := t.previewer.output()
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if follow {
+		offset = util.Max(0, len(lines)-height)
+	}
+	// The line of an image covers as many rows as the image, or the rest of
+	// the window if it is not known
+	cellHeight := C.CellHeight()
+	images := []previewImage{}
+	pattern := t.previewPattern()
+	for row, idx := 0, offset; row < height; idx++ {
+		var line []rune
+		rows := 1
+		if idx < len(lines) {
+			str, seq := extractGraphics(lines[idx])
+			if len(seq) > 0 {
+				rows = graphicsRows(seq, height, cellHeight)
+				if rows <= 0 || rows > height-row {
+					rows = height - row
+				}
+				images = append(images, previewImage{row, seq})
+				str = ""
+			}
+			str, _, _ = extractColor(str, nil)
+			line, _ = trimRight([]rune(str), width)
+			if displayWidth(line) > width {
+				line = line[:len(line)-1]
+			}
+		}
+		for ; rows > 0; rows-- {
+			C.Move(y+row, x)
+			t.printColored(line, previewMatches(pattern, line), C.ColNormal, false)
+			C.Print(strings.Repeat(" ", width-displayWidth(line)))
+			line = nil
+			row++
+		}
+	}
+	t.printGraphics(text, images)
+}
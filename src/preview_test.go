@@ -0,0 +1,320 @@
+package fzf
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junegunn/fzf/src/util"
+)
+
+func TestPreviewer(t *testing.T) {
+	notified := make(chan bool, 10)
+	p := newPreviewer("echo preview: {}", func() { notified <- true })
+	wait := func() {
+		select {
+		case <-notified:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Preview not updated")
+		}
+	}
+
+	item := "foo bar"
+	p.request(&item, 0, 0)
+	wait()
+	if out, _, _ := p.output(); out != "preview: foo bar\n" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	// Command is not run again for the same item
+	same := "foo bar"
+	p.request(&same, 0, 0)
+	select {
+	case <-notified:
+		t.Error("Should not run the command again")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The output of the slow command for the previous item is discarded
+	p.command = "sleep 0.2; echo {}"
+	slow, fast := "slow", "fast"
+	p.request(&slow, 0, 0)
+	p.command = "echo {}"
+	p.request(&fast, 0, 0)
+	wait()
+	time.Sleep(300 * time.Millisecond)
+	if out, _, _ := p.output(); out != "fast\n" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	p.request(nil, 0, 0)
+	wait()
+	if out, _, _ := p.output(); out != "" {
+		t.Errorf("Preview should be cleared: %q", out)
+	}
+
+	// The item is not expanded by the shell
+	dir, err := ioutil.TempDir("", "fzf-preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	crafted := "$(touch " + dir + "/x) `touch " + dir + "/y` it's"
+	p.command = "echo {}"
+	p.request(&crafted, 0, 0)
+	wait()
+	if out, _, _ := p.output(); out != crafted+"\n" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+	for _, name := range []string{"x", "y"} {
+		if _, err := os.Stat(dir + "/" + name); err == nil {
+			t.Errorf("%s should not be created", name)
+		}
+	}
+}
+
+func TestPreviewScroll(t *testing.T) {
+	p := newPreviewer("", nil)
+	p.text = "1\n2\n3\n4\n5\n"
+	check := func(diff int, absolute bool, moved bool, expected int) {
+		if p.scroll(diff, absolute, 2) != moved {
+			t.Errorf("scroll(%d, %v) should return %v", diff, absolute, moved)
+		}
+		if _, offset, _ := p.output(); offset != expected {
+			t.Errorf("scroll(%d, %v): %d (expected: %d)", diff, absolute, offset, expected)
+		}
+	}
+	check(-1, false, false, 0)
+	check(1, false, true, 1)
+	check(10, false, true, 3)
+	check(1, true, true, 1)
+
+	// Scrolling up turns off follow mode
+	p.toggleFollow()
+	check(0, false, false, 3)
+	if _, _, follow := p.output(); !follow {
+		t.Error("Follow mode should stay on at the end of the output")
+	}
+	check(-1, false, true, 2)
+	if _, _, follow := p.output(); follow {
+		t.Error("Follow mode should be turned off")
+	}
+	check(1, true, true, 1)
+
+	// Clicking on the border scrolls to the relative position
+	term := Terminal{
+		preview:     previewOpts{"", posRight, "50%", false, "", false, false, labelOpts{}},
+		previewer:   p,
+		previewArea: screenArea{0, 40, 11, 40}}
+	if term.clickPreview(5, 41) || !term.clickPreview(10, 40) {
+		t.Error("Only the click on the border should scroll the preview window")
+	}
+	if _, offset, _ := p.output(); offset != 0 {
+		t.Errorf("Output is shorter than the window: %d", offset)
+	}
+	p.text = strings.Repeat("line\n", 21)
+	term.clickPreview(5, 40)
+	if _, offset, _ := p.output(); offset != 5 {
+		t.Errorf("Unexpected offset: %d", offset)
+	}
+}
+
+func TestPreviewArea(t *testing.T) {
+	check := func(opts previewOpts, margin [4]int, area screenArea, expected [4]int) {
+		term := Terminal{preview: opts, previewer: newPreviewer(opts.command, nil), marginInt: margin}
+		term.calculatePreviewArea(80, 24)
+		if term.previewArea != area || term.marginInt != expected {
+			t.Errorf("%v: %v %v", opts, term.previewArea, term.marginInt)
+		}
+	}
+	check(defaultPreviewOpts("cat {}"), [4]int{0, 0, 0, 0},
+		screenArea{0, 40, 24, 40}, [4]int{0, 40, 0, 0})
+	check(previewOpts{"cat {}", posLeft, "10", false, "", false, false, labelOpts{}}, [4]int{1, 2, 3, 4},
+		screenArea{1, 4, 20, 10}, [4]int{1, 2, 3, 14})
+	check(previewOpts{"cat {}", posUp, "50%", false, "", false, false, labelOpts{}}, [4]int{0, 0, 0, 0},
+		screenArea{0, 0, 12, 80}, [4]int{12, 0, 0, 0})
+	check(previewOpts{"cat {}", posDown, "3", false, "", false, false, labelOpts{}}, [4]int{0, 0, 2, 0},
+		screenArea{19, 0, 3, 80}, [4]int{0, 0, 5, 0})
+
+	// Leaves the minimum space for the list
+	check(previewOpts{"cat {}", posRight, "100%", false, "", false, false, labelOpts{}}, [4]int{0, 0, 0, 0},
+		screenArea{0, minWidth, 24, 80 - minWidth}, [4]int{0, 80 - minWidth, 0, 0})
+
+	// Hidden
+	check(previewOpts{"cat {}", posRight, "50%", true, "", false, false, labelOpts{}}, [4]int{0, 0, 0, 0},
+		screenArea{}, [4]int{0, 0, 0, 0})
+}
+
+func TestBorderArea(t *testing.T) {
+	term := Terminal{
+		border:    borderRounded,
+		preview:   previewOpts{"cat {}", posRight, "50%", false, "", false, false, labelOpts{}},
+		previewer: newPreviewer("cat {}", nil),
+		marginInt: [4]int{1, 0, 1, 0}}
+	term.calculateBorderArea(80, 24)
+	term.calculatePreviewArea(80, 24)
+	if term.borderArea != (screenArea{1, 0, 22, 80}) {
+		t.Errorf("%v", term.borderArea)
+	}
+	// The preview window is inside the border
+	if term.previewArea != (screenArea{2, 40, 20, 38}) || term.marginInt != [4]int{2, 40, 2, 2} {
+		t.Errorf("%v %v", term.previewArea, term.marginInt)
+	}
+
+	term = Terminal{border: borderHorizontal}
+	term.calculateBorderArea(80, 24)
+	if term.borderArea != (screenArea{0, 0, 24, 80}) || term.marginInt != [4]int{1, 0, 1, 0} {
+		t.Errorf("%v %v", term.borderArea, term.marginInt)
+	}
+}
+
+func TestPreviewOffset(t *testing.T) {
+	check := func(scroll string, delimiter string, item string, expected int) {
+		term := Terminal{preview: previewOpts{scroll: scroll}}
+		if len(delimiter) > 0 {
+			term.delimiter = delimiterRegexp(delimiter)
+		}
+		if offset := term.previewOffset(item, 20); offset != expected {
+			t.Errorf("%s %q: %d (expected: %d)", scroll, item, offset, expected)
+		}
+	}
+	check("", "", "foo 100", 0)
+	check("+5", "", "foo", 4)
+	check("+100-10", "", "foo", 89)
+	check("+{2}", "", "foo 100 bar", 99)
+	check("+{2}-/2", ":", "foo.go:100:bar", 89)
+	check("+{-1}-3", "", "foo 100", 96)
+	check("+{2}-/2", "", "foo 5", 0)
+	check("+{3}", "", "foo 5", 0)
+}
+
+func TestChangePreview(t *testing.T) {
+	base := defaultPreviewOpts("")
+	parsePreviewWindow(&base, "left:30%")
+	term := Terminal{preview: base, previewBase: base, reqBox: util.NewEventBox()}
+
+	term.changePreviewWindow("up:hidden")
+	if term.preview.position != posUp || term.preview.size != "30%" || !term.preview.hidden {
+		t.Errorf("%v", term.preview)
+	}
+	term.changePreviewWindow("10")
+	if term.preview.position != posLeft || term.preview.size != "10" || term.preview.hidden {
+		t.Errorf("%v", term.preview)
+	}
+
+	if !term.changePreview("cat {}") || term.previewer == nil || term.previewer.command != "cat {}" {
+		t.Error("preview window not opened")
+	}
+	if term.changePreview("head {}") || term.previewer.command != "head {}" || term.preview.command != "head {}" {
+		t.Error("preview command not changed")
+	}
+	if !term.changePreview("") || term.previewer != nil || term.changePreview("") {
+		t.Error("preview window not closed")
+	}
+}
+
+func TestGraphics(t *testing.T) {
+	kitty := "\x1b_Ga=T,f=100,m=1;AAAA\x1b\\\x1b_Gm=0;BBBB\x1b\\"
+	sixel := "\x1bPq\"1;1;40;64#0~~@@\x1b\\"
+	iterm := "\x1b]1337;File=inline=1;height=5:AAAA\x07"
+
+	for _, seq := range []string{kitty, sixel, iterm} {
+		text, images := extractGraphics("\x1b[31mfoo" + seq + "bar")
+		if text != "\x1b[31mfoobar" || images != seq {
+			t.Errorf("%q %q", text, images)
+		}
+	}
+	if text, images := extractGraphics("foo\x1b]8;;url\x07bar"); text != "foo\x1b]8;;url\x07bar" || images != "" {
+		t.Errorf("%q %q", text, images)
+	}
+
+	check := func(seq string, cellHeight int, expected int) {
+		if rows := graphicsRows(seq, 20, cellHeight); rows != expected {
+			t.Errorf("%q: %d (expected: %d)", seq, rows, expected)
+		}
+	}
+	check(kitty, 16, 0)
+	check("\x1b_Ga=T,v=40,r=3;AAAA\x1b\\", 16, 3)
+	check("\x1b_Ga=T,v=40;AAAA\x1b\\", 16, 3)
+	check("\x1b_Ga=T,v=40;AAAA\x1b\\", 0, 0)
+	check(sixel, 16, 4)
+	check(sixel, 0, 0)
+	check("\x1bPq#0~~\x1b\\", 16, 0)
+	check(iterm, 16, 5)
+	check("\x1b]1337;File=height=50px:AAAA\x07", 16, 4)
+	check("\x1b]1337;File=height=50%:AAAA\x07", 16, 10)
+	check("\x1b]1337;File=height=auto:AAAA\x07", 16, 0)
+}
+
+func TestResizePreview(t *testing.T) {
+	base := defaultPreviewOpts("cat {}")
+	term := Terminal{preview: base, previewBase: base, reqBox: util.NewEventBox()}
+	term.newPreviewer()
+	check := func(expected int) {
+		term.marginInt = [4]int{0, 0, 0, 0}
+		term.calculatePreviewArea(100, 40)
+		if length := term.previewLength(); length != expected {
+			t.Errorf("%s: %d (expected: %d)", term.preview.size, length, expected)
+		}
+	}
+	check(50)
+
+	// Dragging the border on the left side of the window
+	if term.dragPreview(10, 50) || !term.onPreviewBorder(10, 50) {
+		t.Error("border not found")
+	}
+	if !term.dragPreview(10, 30) {
+		t.Error("preview window not resized")
+	}
+	check(70)
+	if term.resizePreview(70) {
+		t.Error("preview window resized to the same size")
+	}
+	term.resizePreview(100)
+	check(100 - minWidth)
+	term.resizePreview(33)
+	check(33)
+
+	// The ratio is kept after the change of the layout
+	term.changePreviewWindow("up")
+	check(13)
+	term.resizePreview(term.previewLength() - 1)
+	check(12)
+	term.dragPreview(4, 10)
+	check(5)
+}
+
+func TestPreviewerBufferMax(t *testing.T) {
+	for _, follow := range []bool{false, true} {
+		p := newPreviewer("seq 1 300000", func() {})
+		p.follow = follow
+		item := "foo"
+		p.request(&item, 0, 0)
+		for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+			p.mutex.Lock()
+			done := p.process == nil
+			p.mutex.Unlock()
+			if done {
+				break
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("Preview command not finished")
+			}
+		}
+		out, _, _ := p.output()
+		if follow {
+			// The last part of the output is kept from the start of a line
+			lines := strings.Split(out, "\n")
+			first, _ := strconv.Atoi(lines[0])
+			second, _ := strconv.Atoi(lines[1])
+			if len(out) > previewBufferMax || !strings.HasSuffix(out, "\n300000\n") || second != first+1 {
+				t.Errorf("Unexpected tail: %d %q %q", len(out), lines[:2], out[len(out)-20:])
+			}
+		} else if len(out) != previewBufferMax || !strings.HasPrefix(out, "1\n2\n") {
+			t.Errorf("Unexpected output: %d %q", len(out), out[:20])
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package fzf
+
+import (
+	"strings"
+)
+
+// QueryTermType denotes how a QueryTerm is matched against an item
+type QueryTermType int
+
+// Types of query terms
+const (
+	QueryFuzzy QueryTermType = iota
+	QueryExact
+	QueryPrefix
+	QuerySuffix
+	QueryEqual
+)
+
+// QueryTerm is a single search term of a Query
+type QueryTerm struct {
+	Type    QueryTermType
+	Inverse bool
+	Case    Case
+	Text    string
+}
+
+// Query is the structured form of a search query that can be built
+// programmatically instead of assembling a query string. Each element of
+// Sets is a list of alternative terms (OR) and an item matches the query when
+// it matches every set (AND). Nth and Delimiter limit the search scope just
+// like --nth and --delimiter.
+type Query struct {
+	Sets      [][]QueryTerm
+	Nth       []Range
+	Delimiter Delimiter
+}
+
+// Term returns a new QueryTerm of the given type with smart-case matching
+func Term(typ QueryTermType, text string) QueryTerm {
+	return QueryTerm{Type: typ, Inverse: false, Case: CaseSmart, Text: text}
+}
+
+// Not returns the negated copy of the term
+func (t QueryTerm) Not() QueryTerm {
+	t.Inverse = !t.Inverse
+	return t
+}
+
+// WithCase returns the copy of the term with the given case-sensitivity
+func (t QueryTerm) WithCase(caseMode Case) QueryTerm {
+	t.Case = caseMode
+	return t
+}
+
+// String returns the term in extended-search syntax
+func (t QueryTerm) String() string {
+	str := t.Text
+	switch t.Type {
+	case QueryExact:
+		str = "'" + str
+	case QueryPrefix:
+		str = "^" + str
+	case QuerySuffix:
+		str = str + "$"
+	case QueryEqual:
+		str = "^" + str + "$"
+	}
+	if t.Inverse {
+		str = "!" + str
+	}
+	return str
+}
+
+// NewQuery returns a new, empty Query
+func NewQuery() *Query {
+	return &Query{
+		Sets:      [][]QueryTerm{},
+		Nth:       []Range{},
+		Delimiter: Delimiter{}}
+}
+
+// And appends a new set of alternative terms to the query
+func (q *Query) And(terms ...QueryTerm) *Query {
+	if len(terms) > 0 {
+		q.Sets = append(q.Sets, terms)
+	}
+	return q
+}
+
+// Or adds alternative terms to the last set of the query
+func (q *Query) Or(terms ...QueryTerm) *Query {
+	if len(q.Sets) == 0 {
+		return q.And(terms...)
+	}
+	last := len(q.Sets) - 1
+	q.Sets[last] = append(q.Sets[last], terms...)
+	return q
+}
+
+// Within limits the search scope of the query to the given fields
+func (q *Query) Within(nth []Range, delimiter Delimiter) *Query {
+	q.Nth = nth
+	q.Delimiter = delimiter
+	return q
+}
+
+// String returns the query in extended-search syntax
+func (q *Query) String() string {
+	sets := make([]string, len(q.Sets))
+	for idx, set := range q.Sets {
+		terms := make([]string, len(set))
+		for tidx, term := range set {
+			terms[tidx] = term.String()
+		}
+		sets[idx] = strings.Join(terms, " | ")
+	}
+	return strings.Join(sets, " ")
+}
+
+// Pattern builds the Pattern object from the Query. Unlike BuildPattern, the
+// result is not stored in the pattern cache as the same query string can be
+// built from different sets of terms. The items are tokenized for the scope of
+// the query instead of sharing the tokens for --nth.
+func (q *Query) Pattern(forward bool) *Pattern {
+	cacheable := true
+	termSets := []termSet{}
+	// The case-sensitivity of each term is a part of the scope of the cache
+	cases := []Case{}
+	for _, set := range q.Sets {
+		termSet := termSet{}
+		for _, qterm := range set {
+			if len(qterm.Text) == 0 {
+				continue
+			}
+			cases = append(cases, qterm.Case)
+			text := qterm.Text
+			lowerText := strings.ToLower(text)
+			caseSensitive := qterm.Case == CaseRespect ||
+				qterm.Case == CaseSmart && text != lowerText
+			if !caseSensitive {
+				text = lowerText
+			}
+			termSet = append(termSet, term{
+				typ:           termType(qterm.Type),
+				inv:           qterm.Inverse,
+				text:          []rune(text),
+				caseSensitive: caseSensitive,
+				origText:      []rune(qterm.String())})
+		}
+		if len(termSet) == 0 {
+			continue
+		}
+		if len(termSet) > 1 || termSet[0].inv {
+			cacheable = false
+		}
+		termSets = append(termSets, termSet)
+	}
+
+	return &Pattern{
+		fuzzy:         true,
+		extended:      true,
+		caseSensitive: true,
+		forward:       forward,
+		text:          []rune(q.String()),
+		termSets:      termSets,
+		cacheable:     cacheable,
+		cacheScope:    cacheScope(true, true, cases, q.Nth, q.Delimiter),
+		ownTokens:     true,
+		nth:           q.Nth,
+		delimiter:     q.Delimiter,
+		procFun:       buildProcFun()}
+}
+
+// Query returns the structured form of the parsed pattern
+func (p *Pattern) Query() *Query {
+	caseOf := func(caseSensitive bool) Case {
+		if caseSensitive {
+			return CaseRespect
+		}
+		return CaseIgnore
+	}
+	query := NewQuery().Within(p.nth, p.delimiter)
+	if !p.extended {
+		typ := QueryFuzzy
+		if !p.fuzzy {
+			typ = QueryExact
+		}
+		if len(p.text) > 0 {
+			query.And(Term(typ, string(p.text)).WithCase(caseOf(p.caseSensitive)))
+		}
+		return query
+	}
+	for _, termSet := range p.termSets {
+		set := make([]QueryTerm, len(termSet))
+		for idx, term := range termSet {
+			set[idx] = QueryTerm{
+				Type:    QueryTermType(term.typ),
+				Inverse: term.inv,
+				Case:    caseOf(term.caseSensitive),
+				Text:    string(term.text)}
+		}
+		query.And(set...)
+	}
+	return query
+}
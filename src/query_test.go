@@ -0,0 +1,92 @@
+package fzf
+
+import (
+	"testing"
+)
+
+func TestQueryString(t *testing.T) {
+	query := NewQuery().
+		And(Term(QueryFuzzy, "foo")).
+		And(Term(QueryPrefix, "bar"), Term(QuerySuffix, "baz").Not()).
+		Or(Term(QueryEqual, "qux")).
+		And(Term(QueryExact, "xyz").Not())
+	if query.String() != "foo ^bar | !baz$ | ^qux$ !'xyz" {
+		t.Errorf("Unexpected query string: %s", query.String())
+	}
+}
+
+func TestQueryPattern(t *testing.T) {
+	query := NewQuery().
+		And(Term(QueryFuzzy, "ABC"), Term(QueryExact, "")).
+		And(Term(QueryExact, "def").WithCase(CaseRespect)).
+		And(Term(QueryPrefix, "Ghi").WithCase(CaseIgnore))
+	pattern := query.Pattern(true)
+	if len(pattern.termSets) != 3 || !pattern.cacheable ||
+		len(pattern.termSets[0]) != 1 ||
+		string(pattern.termSets[0][0].text) != "ABC" || !pattern.termSets[0][0].caseSensitive ||
+		string(pattern.termSets[1][0].text) != "def" || !pattern.termSets[1][0].caseSensitive ||
+		string(pattern.termSets[2][0].text) != "ghi" || pattern.termSets[2][0].caseSensitive ||
+		pattern.termSets[2][0].typ != termPrefix {
+		t.Errorf("%v", pattern.termSets)
+	}
+
+	item := &Item{text: []rune("ghijkl ABCdef")}
+	if !pattern.MatchItem(item) {
+		t.Error("Should match")
+	}
+	pattern = NewQuery().And(Term(QueryExact, "def").Not()).Pattern(true)
+	if pattern.cacheable || pattern.MatchItem(item) {
+		t.Error("Should not match")
+	}
+}
+
+func TestPatternQuery(t *testing.T) {
+	defer clearPatternCache()
+	clearPatternCache()
+	pattern := BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{},
+		[]rune("foo 'Bar | !^baz"))
+	query := pattern.Query()
+	if len(query.Sets) != 2 || len(query.Sets[1]) != 2 ||
+		query.Sets[0][0].Type != QueryFuzzy || query.Sets[0][0].Case != CaseIgnore ||
+		query.Sets[1][0].Type != QueryExact || query.Sets[1][0].Case != CaseRespect ||
+		query.Sets[1][1].Type != QueryPrefix || !query.Sets[1][1].Inverse ||
+		query.Sets[1][1].Text != "baz" {
+		t.Errorf("%v", query.Sets)
+	}
+	if query.String() != "foo 'Bar | !^baz" {
+		t.Errorf("Unexpected query string: %s", query.String())
+	}
+
+	clearPatternCache()
+	pattern = BuildPattern(false, false, CaseSmart, true, []Range{}, Delimiter{},
+		[]rune("foo bar"))
+	query = pattern.Query()
+	if len(query.Sets) != 1 || query.Sets[0][0].Type != QueryExact ||
+		query.Sets[0][0].Text != "foo bar" {
+		t.Errorf("%v", query.Sets)
+	}
+}
+
+func TestQueryCacheScope(t *testing.T) {
+	clearChunkCache()
+	chunk := Chunk{}
+	for i := 0; i < chunkSize; i++ {
+		text := "foo bar"
+		if i%2 == 1 {
+			text = "FOO foo"
+		}
+		chunk = append(chunk, &Item{text: []rune(text), rank: buildEmptyRank(int32(i))})
+	}
+	check := func(query *Query, expected int) {
+		if matches := query.Pattern(true).Match(&chunk); len(matches) != expected {
+			t.Errorf("%s: %d (expected: %d)", query, len(matches), expected)
+		}
+	}
+
+	// The patterns only differing in the case mode or the scope do not share
+	// the cached results
+	check(NewQuery().And(Term(QueryPrefix, "FOO").WithCase(CaseRespect)), chunkSize/2)
+	check(NewQuery().And(Term(QueryPrefix, "FOO").WithCase(CaseIgnore)), chunkSize)
+	check(NewQuery().And(Term(QueryExact, "foo")).Within([]Range{Range{2, 2}}, Delimiter{}), chunkSize/2)
+	check(NewQuery().And(Term(QueryExact, "foo")), chunkSize)
+}
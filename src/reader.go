@@ -2,38 +2,163 @@ package fzf
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/junegunn/fzf/src/util"
 )
 
+// Source is a command to read items from along with the tag to prefix them
+// with
+type Source struct {
+	Tag     string
+	Command string
+}
+
 // Reader reads from command or standard input
 type Reader struct {
 	pusher   func([]byte) bool
 	eventBox *util.EventBox
 	delimNil bool
+	revision int
+	sources  []Source
+	walker   walkerOpts
+	command  string
+	follow   string
+	files    []string
+	inflate  bool
+	appended bool
+	env      []string
+	mutex    sync.Mutex
+	killed   bool
+	commands []*exec.Cmd
+	pipes    []io.ReadCloser
+	err      error
+	batch    *time.Timer
 }
 
-// ReadSource reads data from the default command or from standard input
+// ReadSource reads data from the command of the reader, the file to follow,
+// the given files, the given sources, the default command, the built-in
+// walker, or from standard input
 func (r *Reader) ReadSource() {
-	if util.IsTty() {
-		cmd := os.Getenv("FZF_DEFAULT_COMMAND")
-		if len(cmd) == 0 {
-			cmd = defaultCommand
+	if len(r.command) > 0 {
+		r.readFromCommand(r.command, r.pusher)
+	} else if len(r.follow) > 0 {
+		r.readFromFile(r.follow)
+	} else if len(r.files) > 0 {
+		r.readFromFiles()
+	} else if len(r.sources) > 0 {
+		r.readFromSources()
+	} else if util.IsTty() {
+		if cmd := os.Getenv("FZF_DEFAULT_COMMAND"); len(cmd) > 0 {
+			r.readFromCommand(cmd, r.pusher)
+		} else {
+			r.readFromWalker()
 		}
-		r.readFromCommand(cmd)
 	} else {
 		r.readFromStdin()
 	}
-	r.eventBox.Set(EvtReadFin, nil)
+	r.flush()
+	// The items appended to the list do not end the input of the list
+	if r.appended {
+		r.eventBox.Set(EvtReadNew, nil)
+	} else {
+		r.eventBox.Set(EvtReadFin, r.revision)
+	}
+}
+
+// terminate kills the process groups of the running commands the reader is
+// reading from and closes their output so that the reader does not wait for
+// the processes that left the group. The commands started afterwards are
+// killed as well.
+func (r *Reader) terminate() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.killed = true
+	for i, cmd := range r.commands {
+		util.KillGroup(cmd)
+		r.pipes[i].Close()
+	}
+}
+
+// fail records the first error that stopped the reader from reading the input
+func (r *Reader) fail(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
 }
 
-func (r *Reader) feed(src io.Reader) {
-	delim := byte('\n')
+// failure returns the error that stopped the reader from reading the input
+func (r *Reader) failure() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+// notify tells the coordinator that new items are read. The notifications are
+// batched so that the items read within readerBatchInterval are searched
+// together with the current query, instead of triggering a search for each
+// item.
+func (r *Reader) notify() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.batch == nil {
+		r.batch = time.AfterFunc(readerBatchInterval, r.flush)
+	}
+}
+
+// flush sends the pending notification of the new items without waiting for
+// the end of the batch
+func (r *Reader) flush() {
+	r.mutex.Lock()
+	pending := r.batch != nil
+	if pending {
+		r.batch.Stop()
+		r.batch = nil
+	}
+	r.mutex.Unlock()
+	if pending {
+		r.eventBox.Set(EvtReadNew, nil)
+	}
+}
+
+// isKilled tells if the reader is terminated
+func (r *Reader) isKilled() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.killed
+}
+
+// readFromWalker lists the files under the current directory with the
+// built-in walker
+func (r *Reader) readFromWalker() {
+	walker := newWalker(r.walker, func(path string) {
+		if r.pusher([]byte(path)) {
+			r.notify()
+		}
+	}, r.isKilled)
+	walker.run(".")
+	r.flush()
+}
+
+// delimiter returns the byte separating the items in the input
+func (r *Reader) delimiter() byte {
 	if r.delimNil {
-		delim = '\000'
+		return '\000'
 	}
+	return '\n'
+}
+
+func (r *Reader) feed(src io.Reader, pusher func([]byte) bool) {
+	delim := r.delimiter()
 	reader := bufio.NewReader(src)
 	for {
 		// ReadBytes returns err != nil if and only if the returned data does not
@@ -43,22 +168,195 @@ func (r *Reader) feed(src io.Reader) {
 			if err == nil {
 				bytea = bytea[:len(bytea)-1]
 			}
-			if r.pusher(bytea) {
-				r.eventBox.Set(EvtReadNew, nil)
+			if pusher(bytea) {
+				r.notify()
 			}
 		}
-		if err != nil {
+		if err != nil || r.isKilled() {
 			break
 		}
 	}
+	r.flush()
 }
 
+// readFromStdin reads the items from standard input, which is decompressed
+// if it is compressed and the reader is told to inflate it
 func (r *Reader) readFromStdin() {
-	r.feed(os.Stdin)
+	if r.inflate {
+		r.feedDecompressed(bufio.NewReader(os.Stdin))
+	} else {
+		r.feed(os.Stdin, r.pusher)
+	}
+}
+
+// feedDecompressed pushes the items in the input, which is decompressed if it
+// is compressed with gzip or zstd. The reader fails if the input cannot be
+// decompressed, e.g. when zstd command is not found.
+func (r *Reader) feedDecompressed(in *bufio.Reader) {
+	decompressed, err := decompressReader(in)
+	if err != nil {
+		r.fail(fmt.Errorf("failed to decompress the input: %v", err))
+		return
+	}
+	if decompressed == nil {
+		r.feed(in, r.pusher)
+		return
+	}
+	r.feed(decompressed, r.pusher)
+	if err := decompressed.Close(); err != nil && !r.isKilled() {
+		r.fail(fmt.Errorf("failed to decompress the input: %v", err))
+	}
+}
+
+// readFromFiles reads the items from the files in order. A large file is
+// memory-mapped instead of being read through the buffer unless it is
+// compressed. The last line without the trailing delimiter is read as well.
+func (r *Reader) readFromFiles() {
+	for _, path := range r.files {
+		if r.isKilled() {
+			return
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		in := bufio.NewReader(file)
+		if magic, _ := in.Peek(len(zstdMagic)); isCompressed(magic) {
+			r.feedDecompressed(in)
+		} else if data := mmapFile(file); data != nil {
+			r.feedBytes(data)
+			syscall.Munmap(data)
+		} else {
+			r.feed(in, r.pusher)
+		}
+		file.Close()
+	}
+}
+
+// mmapFile maps the file into memory if it is large enough, or returns nil
+func mmapFile(file *os.File) []byte {
+	info, err := file.Stat()
+	if err != nil || info.Size() < fileMmapMin || int64(int(info.Size())) != info.Size() {
+		return nil
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil
+	}
+	return data
 }
 
-func (r *Reader) readFromCommand(cmd string) {
-	listCommand := util.ExecCommand(cmd)
+// feedBytes pushes the items in the data separated by the delimiter
+func (r *Reader) feedBytes(data []byte) {
+	delim := r.delimiter()
+	for len(data) > 0 && !r.isKilled() {
+		line := data
+		if idx := bytes.IndexByte(data, delim); idx >= 0 {
+			line, data = data[:idx], data[idx+1:]
+		} else {
+			data = nil
+		}
+		if r.pusher(line) {
+			r.notify()
+		}
+	}
+	r.flush()
+}
+
+// readFromFile reads the lines of the file, and keeps reading the lines
+// appended to it like tail -f until the reader is terminated. The file is
+// read again from the beginning when it is truncated, or replaced by another
+// file with the same path by log rotation. The last line is not read until it
+// is complete.
+func (r *Reader) readFromFile(path string) {
+	delim := r.delimiter()
+	var file *os.File
+	var info os.FileInfo
+	var offset int64
+	var partial []byte
+	buf := make([]byte, 64*1024)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+	for !r.isKilled() {
+		if file == nil {
+			var err error
+			if file, err = os.Open(path); err != nil {
+				file = nil
+				time.Sleep(followInterval)
+				continue
+			}
+			info, _ = file.Stat()
+			offset, partial = 0, nil
+		}
+
+		n, _ := file.Read(buf)
+		if n > 0 {
+			offset += int64(n)
+			data := append(partial, buf[:n]...)
+			pushed := false
+			for {
+				idx := bytes.IndexByte(data, delim)
+				if idx < 0 {
+					break
+				}
+				pushed = r.pusher(data[:idx]) || pushed
+				data = data[idx+1:]
+			}
+			partial = append([]byte{}, data...)
+			if pushed {
+				r.notify()
+			}
+			continue
+		}
+
+		// Reached the end of the file
+		if current, err := os.Stat(path); err == nil && info != nil {
+			if !os.SameFile(current, info) {
+				file.Close()
+				file = nil
+				continue
+			}
+			if current.Size() < offset {
+				file.Seek(0, io.SeekStart)
+				offset, partial = 0, nil
+				continue
+			}
+		}
+		time.Sleep(followInterval)
+	}
+}
+
+// readFromSources runs the commands concurrently and prefixes each line with
+// the tag of its source followed by a tab character, so that the tag can be
+// used as the first field for --nth and --with-nth. The lines of the sources
+// without the tag are not prefixed.
+func (r *Reader) readFromSources() {
+	mutex := sync.Mutex{}
+	waitGroup := sync.WaitGroup{}
+	for _, source := range r.sources {
+		waitGroup.Add(1)
+		go func(source Source) {
+			defer waitGroup.Done()
+			var prefix []byte
+			if len(source.Tag) > 0 {
+				prefix = []byte(source.Tag + "\t")
+			}
+			r.readFromCommand(source.Command, func(data []byte) bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return r.pusher(append(append([]byte{}, prefix...), data...))
+			})
+		}(source)
+	}
+	waitGroup.Wait()
+}
+
+func (r *Reader) readFromCommand(cmd string, pusher func([]byte) bool) {
+	listCommand := util.ExecCommandGroup(cmd)
+	listCommand.Env = r.env
 	out, err := listCommand.StdoutPipe()
 	if err != nil {
 		return
@@ -67,6 +365,30 @@ func (r *Reader) readFromCommand(cmd string) {
 	if err != nil {
 		return
 	}
-	defer listCommand.Wait()
-	r.feed(out)
+	r.mutex.Lock()
+	if r.killed {
+		util.KillGroup(listCommand)
+		out.Close()
+	}
+	r.commands = append(r.commands, listCommand)
+	r.pipes = append(r.pipes, out)
+	r.mutex.Unlock()
+
+	r.feed(out, pusher)
+	listCommand.Wait()
+	r.forget(listCommand)
+}
+
+// forget removes the command that has finished from the ones to kill on
+// terminate, as its process group ID can be reused by another process
+func (r *Reader) forget(cmd *exec.Cmd) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, c := range r.commands {
+		if c == cmd {
+			r.commands = append(r.commands[:i], r.commands[i+1:]...)
+			r.pipes = append(r.pipes[:i], r.pipes[i+1:]...)
+			return
+		}
+	}
 }
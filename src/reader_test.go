@@ -1,7 +1,19 @@
 package fzf
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/junegunn/fzf/src/util"
 )
@@ -19,7 +31,7 @@ func TestReadFromCommand(t *testing.T) {
 	}
 
 	// Normal command
-	reader.readFromCommand(`echo abc && echo def`)
+	reader.readFromCommand(`echo abc && echo def`, reader.pusher)
 	if len(strs) != 2 || strs[0] != "abc" || strs[1] != "def" {
 		t.Errorf("%s", strs)
 	}
@@ -43,7 +55,7 @@ func TestReadFromCommand(t *testing.T) {
 	}
 
 	// Failing command
-	reader.readFromCommand(`no-such-command`)
+	reader.readFromCommand(`no-such-command`, reader.pusher)
 	strs = []string{}
 	if len(strs) > 0 {
 		t.Errorf("%s", strs)
@@ -54,3 +66,274 @@ func TestReadFromCommand(t *testing.T) {
 		t.Error("Command failed. EvtReadNew should be set")
 	}
 }
+
+func TestReadFromSources(t *testing.T) {
+	strs := []string{}
+	reader := Reader{
+		pusher:   func(s []byte) bool { strs = append(strs, string(s)); return true },
+		eventBox: util.NewEventBox(),
+		sources: []Source{
+			Source{"foo", "echo abc && echo def"},
+			Source{"bar", "echo ghi"},
+			Source{"", "echo jkl"},
+			Source{"baz", "no-such-command"}}}
+
+	reader.readFromSources()
+	sort.Strings(strs)
+	if len(strs) != 4 || strs[0] != "bar\tghi" || strs[1] != "foo\tabc" || strs[2] != "foo\tdef" || strs[3] != "jkl" {
+		t.Errorf("%v", strs)
+	}
+}
+
+func TestReaderAppended(t *testing.T) {
+	eb := util.NewEventBox()
+	reader := Reader{
+		pusher:   func(s []byte) bool { return true },
+		eventBox: eb,
+		revision: 1,
+		command:  "echo foo",
+		appended: true}
+	reader.ReadSource()
+	if eb.Peek(EvtReadFin) || !eb.Peek(EvtReadNew) {
+		t.Error("Appended items should not end the input")
+	}
+}
+
+func TestReaderTerminate(t *testing.T) {
+	eb := util.NewEventBox()
+	reader := Reader{
+		pusher:   func(s []byte) bool { return true },
+		eventBox: eb,
+		command:  "exec sleep 10"}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		reader.terminate()
+	}()
+	done := make(chan bool)
+	go func() {
+		reader.ReadSource()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("The command should be killed")
+	}
+
+	// The commands started after termination are killed as well
+	reader.readFromCommand("exec sleep 10", reader.pusher)
+}
+
+func TestReaderBatch(t *testing.T) {
+	// The items are searchable before the end of the input
+	eb := util.NewEventBox()
+	var mutex sync.Mutex
+	strs := []string{}
+	reader := Reader{
+		pusher: func(s []byte) bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			strs = append(strs, string(s))
+			return true
+		},
+		eventBox: eb,
+		command:  "seq 100; sleep 1; echo done"}
+	go reader.ReadSource()
+	start := time.Now()
+	eb.Wait(func(events *util.Events) {
+		if _, found := (*events)[EvtReadFin]; found {
+			t.Error("The input should not be complete")
+		}
+		events.Clear()
+	})
+	mutex.Lock()
+	count := len(strs)
+	mutex.Unlock()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond || count == 0 || count > 100 {
+		t.Errorf("Items not notified before EOF: %d items in %v", count, elapsed)
+	}
+	reader.terminate()
+}
+
+func TestReaderForget(t *testing.T) {
+	reader := Reader{
+		pusher:   func(s []byte) bool { return true },
+		eventBox: util.NewEventBox(),
+		command:  "echo foo"}
+	reader.ReadSource()
+	// The finished command is not killed on terminate
+	if len(reader.commands) > 0 || len(reader.pipes) > 0 {
+		t.Errorf("The finished command should be forgotten: %d", len(reader.commands))
+	}
+}
+
+func TestReaderTerminateGroup(t *testing.T) {
+	// The children of the shell holding the output are killed, and the output
+	// of a process that left the process group is not waited for
+	for _, command := range []string{"sleep 10; echo", "sleep 10 | cat", "setsid sleep 10"} {
+		reader := Reader{
+			pusher:   func(s []byte) bool { return true },
+			eventBox: util.NewEventBox(),
+			command:  command}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			reader.terminate()
+		}()
+		start := time.Now()
+		reader.ReadSource()
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: took %v", command, elapsed)
+		}
+	}
+}
+
+func TestReadZero(t *testing.T) {
+	strs := []string{}
+	reader := Reader{
+		pusher:   func(s []byte) bool { strs = append(strs, string(s)); return true },
+		eventBox: util.NewEventBox(),
+		delimNil: true}
+
+	reader.readFromCommand(`printf 'foo\nbar\000baz\000'`, reader.pusher)
+	if len(strs) != 2 || strs[0] != "foo\nbar" || strs[1] != "baz" {
+		t.Errorf("%q", strs)
+	}
+}
+
+func TestReadFromFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "fzf-follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := file.Name()
+	defer os.Remove(path)
+	file.WriteString("foo\nbar")
+
+	mutex := sync.Mutex{}
+	strs := []string{}
+	reader := Reader{
+		pusher: func(s []byte) bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			strs = append(strs, string(s))
+			return true
+		},
+		eventBox: util.NewEventBox(),
+		follow:   path}
+	done := make(chan bool)
+	go func() {
+		reader.ReadSource()
+		done <- true
+	}()
+	check := func(expected ...string) {
+		time.Sleep(3 * followInterval)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !reflect.DeepEqual(strs, expected) {
+			t.Errorf("%q (expected: %q)", strs, expected)
+		}
+	}
+
+	// The incomplete last line is not read
+	check("foo")
+	file.WriteString("\nbaz\n")
+	check("foo", "bar", "baz")
+
+	// Truncated
+	file.Truncate(0)
+	file.WriteAt([]byte("a\n"), 0)
+	check("foo", "bar", "baz", "a")
+
+	// Replaced by another file
+	file.Close()
+	os.Remove(path)
+	ioutil.WriteFile(path, []byte("b\n"), 0600)
+	check("foo", "bar", "baz", "a", "b")
+
+	reader.terminate()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("The reader should stop following the file")
+	}
+}
+
+func TestReadFromFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fzf-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	paths := []string{}
+	for idx, content := range []string{"foo\nbar\n", "baz", ""} {
+		path := fmt.Sprintf("%s/%d", dir, idx)
+		ioutil.WriteFile(path, []byte(content), 0600)
+		paths = append(paths, path)
+	}
+
+	strs := []string{}
+	reader := Reader{
+		pusher:   func(s []byte) bool { strs = append(strs, string(s)); return true },
+		eventBox: util.NewEventBox(),
+		files:    paths}
+	reader.ReadSource()
+	if !reflect.DeepEqual(strs, []string{"foo", "bar", "baz"}) {
+		t.Errorf("%q", strs)
+	}
+
+	// Memory-mapped data
+	strs = []string{}
+	reader.delimNil = true
+	reader.feedBytes([]byte("foo\nbar\x00\x00baz"))
+	if !reflect.DeepEqual(strs, []string{"foo\nbar", "", "baz"}) {
+		t.Errorf("%q", strs)
+	}
+}
+
+func TestReadCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fzf-compressed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte("foo\nbar\n"))
+	writer.Close()
+	paths := []string{dir + "/gz", dir + "/plain"}
+	ioutil.WriteFile(paths[0], buf.Bytes(), 0600)
+	ioutil.WriteFile(paths[1], []byte("\x1f"), 0600)
+	expected := []string{"foo", "bar", "\x1f"}
+	zstd := exec.Command("zstd", "-cq")
+	zstd.Stdin = strings.NewReader("baz\n")
+	if data, err := zstd.Output(); err == nil {
+		paths = append(paths, dir+"/zst")
+		ioutil.WriteFile(paths[2], data, 0600)
+		expected = append(expected, "baz")
+	}
+
+	strs := []string{}
+	reader := Reader{
+		pusher:   func(s []byte) bool { strs = append(strs, string(s)); return true },
+		eventBox: util.NewEventBox(),
+		files:    paths}
+	reader.ReadSource()
+	if !reflect.DeepEqual(strs, expected) {
+		t.Errorf("%q", strs)
+	}
+}
+
+func TestReadCompressedError(t *testing.T) {
+	// The reader fails when zstd command is not found
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	defer os.Setenv("PATH", path)
+	reader := Reader{
+		pusher:   func(s []byte) bool { return true },
+		eventBox: util.NewEventBox()}
+	reader.feedDecompressed(bufio.NewReader(bytes.NewReader(append(zstdMagic, 0))))
+	if reader.failure() == nil {
+		t.Error("The reader should fail")
+	}
+}
@@ -0,0 +1,144 @@
+package fzf
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+type resultCacheEntry struct {
+	Fingerprint uint64
+	Key         string
+	Indexes     []int32
+}
+
+// ResultCache is a persistent cache of the search results for the recent
+// queries. The results are stored as the indexes of the matched items, so they
+// are only valid for the same input and the same set of search options. The
+// file is written in the background not to delay the search, and flush waits
+// for it before exiting.
+type ResultCache struct {
+	path      string
+	signature string
+	entries   []resultCacheEntry
+	maxSize   int
+	mutex     sync.Mutex
+	dirty     bool
+	writing   bool
+	writer    sync.WaitGroup
+}
+
+// NewResultCache returns the pointer to a new ResultCache struct
+func NewResultCache(path string, maxSize int) (*ResultCache, error) {
+	fmtError := func(e error) error {
+		if os.IsPermission(e) {
+			return errors.New("permission denied: " + path)
+		}
+		return errors.New("invalid cache file: " + e.Error())
+	}
+
+	// Read cache file
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		// If it doesn't exist, check if we can create a file with the name
+		if os.IsNotExist(err) {
+			data = []byte{}
+			if err := ioutil.WriteFile(path, data, 0600); err != nil {
+				return nil, fmtError(err)
+			}
+		} else {
+			return nil, fmtError(err)
+		}
+	}
+
+	// A broken or outdated cache file is simply discarded
+	entries := []resultCacheEntry{}
+	if len(data) > 0 {
+		if gob.NewDecoder(bytes.NewReader(data)).Decode(&entries) != nil {
+			entries = []resultCacheEntry{}
+		}
+	}
+	return &ResultCache{
+		path:      path,
+		signature: "",
+		entries:   entries,
+		maxSize:   maxSize,
+		mutex:     sync.Mutex{}}, nil
+}
+
+func (rc *ResultCache) key(sort bool, query string) string {
+	mode := "sort"
+	if !sort {
+		mode = "no-sort"
+	}
+	return rc.signature + "\x00" + mode + "\x00" + query
+}
+
+func (rc *ResultCache) find(fingerprint uint64, sort bool, query string) ([]int32, bool) {
+	key := rc.key(sort, query)
+	for _, entry := range rc.entries {
+		if entry.Fingerprint == fingerprint && entry.Key == key {
+			return entry.Indexes, true
+		}
+	}
+	return nil, false
+}
+
+// add adds the result to the cache, and starts writing the entries to the file
+// unless it is already being written, in which case the writer writes them
+// again once it is done
+func (rc *ResultCache) add(fingerprint uint64, sort bool, query string, indexes []int32) {
+	key := rc.key(sort, query)
+
+	// The most recent entry comes first
+	entries := []resultCacheEntry{resultCacheEntry{fingerprint, key, indexes}}
+	for _, entry := range rc.entries {
+		if len(entries) == rc.maxSize {
+			break
+		}
+		if entry.Fingerprint != fingerprint || entry.Key != key {
+			entries = append(entries, entry)
+		}
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.entries = entries
+	rc.dirty = true
+	if !rc.writing {
+		rc.writing = true
+		rc.writer.Add(1)
+		go rc.write()
+	}
+}
+
+// write writes the entries to the file until there are no more changes.
+// Failing to update the cache file is not fatal.
+func (rc *ResultCache) write() {
+	defer rc.writer.Done()
+	for {
+		rc.mutex.Lock()
+		if !rc.dirty {
+			rc.writing = false
+			rc.mutex.Unlock()
+			return
+		}
+		// The slice is replaced instead of being modified on add
+		entries := rc.entries
+		rc.dirty = false
+		rc.mutex.Unlock()
+
+		var buf bytes.Buffer
+		if gob.NewEncoder(&buf).Encode(entries) == nil {
+			ioutil.WriteFile(rc.path, buf.Bytes(), 0600)
+		}
+	}
+}
+
+// flush waits for the entries to be written to the file
+func (rc *ResultCache) flush() {
+	rc.writer.Wait()
+}
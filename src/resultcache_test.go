@@ -0,0 +1,103 @@
+package fzf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResultCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fzf-result-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache")
+
+	if _, e := NewResultCache("/proc/fzf-result-cache", 3); e == nil {
+		t.Error("Error expected")
+	}
+
+	rc, e := NewResultCache(path, 3)
+	if e != nil {
+		t.Fatal(e)
+	}
+	rc.signature = "foo"
+	for i := 0; i < 5; i++ {
+		rc.add(uint64(i), true, fmt.Sprintf("q%d", i), []int32{int32(i)})
+	}
+	rc.add(1, false, "q1", []int32{})
+	if len(rc.entries) != 3 {
+		t.Errorf("Expected 3 entries, got %d", len(rc.entries))
+	}
+	rc.flush()
+
+	// Read the entries back from the file
+	rc, _ = NewResultCache(path, 3)
+	rc.signature = "foo"
+	if indexes, found := rc.find(4, true, "q4"); !found || len(indexes) != 1 || indexes[0] != 4 {
+		t.Errorf("%v %v", indexes, found)
+	}
+	if indexes, found := rc.find(1, false, "q1"); !found || len(indexes) != 0 {
+		t.Errorf("%v %v", indexes, found)
+	}
+	for _, miss := range []func() bool{
+		func() bool { _, found := rc.find(1, true, "q1"); return found },
+		func() bool { _, found := rc.find(3, true, "q4"); return found },
+		func() bool { _, found := rc.find(3, false, "q3"); return found }} {
+		if miss() {
+			t.Error("Should not be found")
+		}
+	}
+	rc.signature = "bar"
+	if _, found := rc.find(4, true, "q4"); found {
+		t.Error("Should not be found with different options")
+	}
+
+	// Broken cache file is discarded
+	ioutil.WriteFile(path, []byte("broken"), 0600)
+	if rc, e := NewResultCache(path, 3); e != nil || len(rc.entries) != 0 {
+		t.Error("Broken cache file should be discarded", e)
+	}
+}
+
+func TestMatcherResultCache(t *testing.T) {
+	defer clearPatternCache()
+	dir, err := ioutil.TempDir("", "fzf-result-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache")
+
+	rc, _ := NewResultCache(path, 3)
+	m := NewMatcher(func(runes []rune) *Pattern {
+		return BuildPattern(true, true, CaseSmart, true, []Range{}, Delimiter{}, runes)
+	}, false, false, 0, "", rc, nil)
+	chunks := buildIndexedChunks("foo", "bar", "fob", "baz")
+	request := MatchRequest{chunks, m.patternBuilder([]rune("fo")), true, false, 0}
+	if m.findResult(request) != nil {
+		t.Error("Should not be found")
+	}
+	merger, _ := m.scan(request)
+	m.storeResult(request, m.resultToStore(request, merger))
+	rc.flush()
+
+	rc, _ = NewResultCache(path, 3)
+	m.resultCache = rc
+	m.fingerprinted = -1
+	stored := m.findResult(request)
+	if stored == nil || stored.Length() != 2 ||
+		string(stored.Get(0).text) != "foo" || string(stored.Get(1).text) != "fob" ||
+		len(stored.Get(1).offsets) != 1 {
+		t.Error("Unexpected result", stored)
+	}
+
+	request.chunks = buildIndexedChunks("foo", "bar", "fob", "bazz")
+	m.fingerprinted = -1
+	if m.findResult(request) != nil {
+		t.Error("Should not be found for a different input")
+	}
+}
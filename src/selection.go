@@ -0,0 +1,166 @@
+package fzf
+
+import (
+	"strings"
+
+	C "github.com/junegunn/fzf/src/curses"
+	"github.com/junegunn/fzf/src/util"
+)
+
+// defaultSelectedPane returns the layout of the selected pane when
+// --selected-pane is given without the value
+func defaultSelectedPane() *previewOpts {
+	return &previewOpts{position: posDown, size: "30%"}
+}
+
+// parseSelectedPane parses the layout of the selected pane, which is the same
+// as the one of the preview window: [up|down|left|right][:SIZE[%]][:hidden]
+func parseSelectedPane(str string) *previewOpts {
+	opts := defaultSelectedPane()
+	if err := parsePreviewWindow(opts, str); err != nil {
+		errorExit(strings.Replace(err.Error(), "preview window", "selected pane", 1))
+	}
+	return opts
+}
+
+// hasSelectedPane tells if the pane listing the selected items is displayed
+func (t *Terminal) hasSelectedPane() bool {
+	return t.multi && t.selPane != nil && !t.selPane.hidden
+}
+
+// calculateSelectedPaneArea takes the space for the selected pane out of the
+// area inside the margins in the same way as the preview window
+func (t *Terminal) calculateSelectedPaneArea(screenWidth int, screenHeight int) {
+	if !t.hasSelectedPane() {
+		return
+	}
+	t.selArea = t.paneArea(t.selPane.position, t.selPane.size, screenWidth, screenHeight)
+}
+
+// toggleSelectedPane shows or hides the selected pane. The focus is moved
+// back to the list when it is hidden.
+func (t *Terminal) toggleSelectedPane() bool {
+	if !t.multi || t.selPane == nil {
+		return false
+	}
+	t.selPane.hidden = !t.selPane.hidden
+	t.selFocus = false
+	return true
+}
+
+// focusSelectedPane moves the focus between the list and the selected pane.
+// The pane can't take the focus when it is hidden or nothing is selected.
+func (t *Terminal) focusSelectedPane() bool {
+	if !t.selFocus && (!t.hasSelectedPane() || len(t.selected) == 0) {
+		return false
+	}
+	t.selFocus = !t.selFocus
+	t.selCursor = util.Constrain(t.selCursor, 0, util.Max(len(t.selected)-1, 0))
+	return true
+}
+
+// deselectAt deselects the item at the position in the selected pane. The
+// pane loses the focus when no item is left.
+func (t *Terminal) deselectAt(pos int) bool {
+	sels := t.sortSelected()
+	if pos < 0 || pos >= len(sels) {
+		return false
+	}
+	for idx, sel := range t.selected {
+		if sel.text == sels[pos].text && sel.at.Equal(sels[pos].at) {
+			delete(t.selected, idx)
+			break
+		}
+	}
+	t.selCursor = util.Constrain(t.selCursor, 0, util.Max(len(t.selected)-1, 0))
+	if len(t.selected) == 0 {
+		t.selFocus = false
+	}
+	return true
+}
+
+// selectedPaneAction performs the action on the selected pane while it has
+// the focus. Moving the cursor moves the one in the pane, and toggling the
+// selection deselects the item under it. It returns false for the other
+// actions, which are performed on the list as usual.
+func (t *Terminal) selectedPaneAction(at actionType) bool {
+	if len(t.selected) == 0 {
+		t.selFocus = false
+		return false
+	}
+	switch at {
+	case actUp:
+		t.selCursor = util.Constrain(t.selCursor-1, 0, len(t.selected)-1)
+	case actDown:
+		t.selCursor = util.Constrain(t.selCursor+1, 0, len(t.selected)-1)
+	case actToggle, actToggleDown, actToggleUp, actToggleIn, actToggleOut:
+		t.deselectAt(t.selCursor)
+	default:
+		return false
+	}
+	return true
+}
+
+// inSelectedPaneArea tells if the position is inside the selected pane
+// including its border
+func (t *Terminal) inSelectedPaneArea(y int, x int) bool {
+	area := t.selArea
+	return t.hasSelectedPane() && y >= area.y && y < area.y+area.height &&
+		x >= area.x && x < area.x+area.width
+}
+
+// clickSelectedPane deselects the item on the line of the selected pane
+func (t *Terminal) clickSelectedPane(y int) bool {
+	text, _ := paneTextArea(t.selArea, t.selPane.position)
+	if y < text.y || y >= text.y+text.height {
+		return false
+	}
+	return t.deselectAt(t.selectedPaneOffset(text.height) + y - text.y)
+}
+
+// selectedPaneOffset returns the index of the item on the first line of the
+// selected pane, which keeps the cursor visible
+func (t *Terminal) selectedPaneOffset(height int) int {
+	return util.Max(0, t.selCursor-height+1)
+}
+
+// printSelectedPane prints the selected items in the order of selection. The
+// pointer is printed in front of the item under the cursor while the pane has
+// the focus.
+func (t *Terminal) printSelectedPane() {
+	area := t.selArea
+	if !t.hasSelectedPane() || area.width < 3 || area.height < 2 {
+		return
+	}
+	text, border := paneTextArea(area, t.selPane.position)
+	printPaneBorder(area, t.selPane.position, border)
+
+	sels := t.sortSelected()
+	width := text.width - len(t.pointerPad)
+	offset := t.selectedPaneOffset(text.height)
+	for row := 0; row < text.height; row++ {
+		C.Move(text.y+row, text.x)
+		idx := offset + row
+		if idx >= len(sels) || width < 1 {
+			C.Print(strings.Repeat(" ", text.width))
+			continue
+		}
+		current := t.selFocus && idx == t.selCursor
+		if current {
+			C.CPrint(C.ColCursor, true, t.pointer)
+		} else {
+			C.Print(t.pointerPad)
+		}
+		str, _ := processTabs([]rune(*sels[idx].text), 0)
+		line, _ := trimRight([]rune(str), width)
+		if displayWidth(line) > width {
+			line = line[:len(line)-1]
+		}
+		padded := string(line) + strings.Repeat(" ", width-displayWidth(line))
+		if current {
+			C.CPrint(C.ColCurrent, true, padded)
+		} else {
+			C.Print(padded)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package fzf
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSelectedPaneAction(t *testing.T) {
+	term := &Terminal{multi: true, selPane: defaultSelectedPane(), selected: make(map[int32]selectedItem)}
+	base := time.Now()
+	for i, str := range []string{"foo", "bar", "baz"} {
+		text := str
+		term.selected[int32(10-i)] = selectedItem{base.Add(time.Duration(i) * time.Second), &text}
+	}
+	check := func(expected ...string) {
+		var list []string
+		for _, sel := range term.sortSelected() {
+			list = append(list, *sel.text)
+		}
+		if !reflect.DeepEqual(list, expected) {
+			t.Errorf("%q (expected: %q)", list, expected)
+		}
+	}
+
+	if !term.focusSelectedPane() || !term.selFocus {
+		t.Error("selected pane not focused")
+	}
+	term.selectedPaneAction(actDown)
+	term.selectedPaneAction(actDown)
+	term.selectedPaneAction(actDown)
+	if term.selCursor != 2 {
+		t.Errorf("cursor out of the list: %d", term.selCursor)
+	}
+	if term.selectedPaneAction(actAccept) {
+		t.Error("accept is not handled by the selected pane")
+	}
+
+	term.selectedPaneAction(actToggle)
+	check("foo", "bar")
+	if term.selCursor != 1 {
+		t.Errorf("cursor not moved to the last item: %d", term.selCursor)
+	}
+	term.selectedPaneAction(actUp)
+	term.selectedPaneAction(actToggleDown)
+	check("bar")
+	if _, found := term.selected[9]; !found {
+		t.Error("wrong item deselected")
+	}
+	term.selectedPaneAction(actToggle)
+	check()
+	if term.selFocus {
+		t.Error("focus not moved back to the list")
+	}
+	if term.focusSelectedPane() {
+		t.Error("selected pane focused without selection")
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	C "github.com/junegunn/fzf/src/curses"
 	"github.com/junegunn/fzf/src/util"
@@ -21,45 +23,126 @@ import (
 
 // Terminal represents terminal input/output
 type Terminal struct {
-	initDelay  time.Duration
-	inlineInfo bool
-	prompt     string
-	reverse    bool
-	hscroll    bool
-	hscrollOff int
-	cx         int
-	cy         int
-	offset     int
-	yanked     []rune
-	input      []rune
-	multi      bool
-	sort       bool
-	toggleSort bool
-	expect     map[int]string
-	keymap     map[int]actionType
-	execmap    map[int]string
-	pressed    string
-	printQuery bool
-	history    *History
-	cycle      bool
-	header     []string
-	header0    []string
-	ansi       bool
-	margin     [4]string
-	marginInt  [4]int
-	count      int
-	progress   int
-	reading    bool
-	merger     *Merger
-	selected   map[int32]selectedItem
-	reqBox     *util.EventBox
-	eventBox   *util.EventBox
-	mutex      sync.Mutex
-	initFunc   func()
-	suppress   bool
-	startChan  chan bool
+	initDelay   time.Duration
+	info        infoStyle
+	infoSep     string
+	infoFormat  string
+	spinner     []string
+	selCounter  string
+	prompt      string
+	pointer     string
+	pointerPad  string
+	marker      string
+	markerPad   string
+	jumping     jumpMode
+	jumpLabels  []rune
+	layout      layoutType
+	hscroll     bool
+	hscrollOff  int
+	scrollOff   int
+	wrap        bool
+	keepRight   bool
+	ellipsis    []rune
+	cx          int
+	cy          int
+	offset      int
+	listed      int
+	rowItems    []int
+	killRing    *KillRing
+	yankBegin   int
+	lastAction  actionType
+	wordPrev    string
+	wordNext    string
+	wordRubout  string
+	vi          bool
+	clipboard   bool
+	pasteFirst  bool
+	viNormal    bool
+	viOperator  rune
+	input       []rune
+	multi       bool
+	multiMax    int
+	sort        bool
+	toggleSort  bool
+	throttle    int
+	throttleTo  int
+	expect      map[int]string
+	keymap      map[int][]action
+	pressed     string
+	printQueue  []string
+	become      string
+	failure     string
+	printQuery  bool
+	printLine   func(string)
+	history     *History
+	boost       *History
+	cycle       bool
+	track       bool
+	tree        bool
+	annotate    bool
+	plain       bool
+	bell        bool
+	indexCol    indexColumn
+	collapsed   map[string]bool
+	treeItems   []*Item
+	treeShown   []*Item
+	header      []string
+	header0     []string
+	headerFirst bool
+	footer      []string
+	ansi        bool
+	delimiter   Delimiter
+	nth         []Range
+	nthFields   bool
+	margin      [4]string
+	fullscreen  bool
+	marginInt   [4]int
+	border      borderStyle
+	borderLabel labelOpts
+	borderArea  screenArea
+	preview     previewOpts
+	previewBase previewOpts
+	previewer   *previewer
+	previewArea screenArea
+	previewSpan int
+	previewDrag *C.MouseEvent
+	newPattern  func([]rune) *Pattern
+	images      string
+	imageArea   screenArea
+	count       int
+	matched     int
+	progress    int
+	reading     bool
+	loaded      bool
+	focus       int32
+	merger      *Merger
+	selected    map[int32]selectedItem
+	detached    []selectedItem
+	reloadPos   *[2]int
+	trackText   *string
+	selPane     *previewOpts
+	selArea     screenArea
+	selFocus    bool
+	selCursor   int
+	reqBox      *util.EventBox
+	eventBox    *util.EventBox
+	mutex       sync.Mutex
+	keyMutex    sync.Mutex
+	initFunc    func()
+	suppress    bool
+	startChan   chan bool
+	eventChan   chan C.Event
+	exit        func(int)
 }
 
+type jumpMode int
+
+const (
+	jumpDisabled jumpMode = iota
+	jumpEnabled
+	jumpAcceptEnabled
+)
+
 type selectedItem struct {
 	at   time.Time
 	text *string
@@ -79,7 +162,7 @@ func (a byTimeOrder) Less(i, j int) bool {
 	return a[i].at.Before(a[j].at)
 }
 
-var _spinner = []string{`-`, `\`, `|`, `/`, `-`, `\`, `|`, `/`}
+var placeholder = regexp.MustCompile(`\{[+qn]?\}`)
 var _runeWidths = make(map[rune]int)
 var _tabStop int
 
@@ -87,11 +170,17 @@ const (
 	reqPrompt util.EventType = iota
 	reqInfo
 	reqHeader
+	reqFooter
 	reqList
 	reqRefresh
 	reqRedraw
+	reqResize
 	reqClose
 	reqQuit
+	reqPreview
+	reqBecome
+	reqFail
+	reqBell
 )
 
 type actionType int
@@ -104,6 +193,7 @@ const (
 	actBeginningOfLine
 	actAbort
 	actAccept
+	actAcceptNonEmpty
 	actBackwardChar
 	actBackwardDeleteChar
 	actBackwardWord
@@ -119,6 +209,7 @@ const (
 	actUnixLineDiscard
 	actUnixWordRubout
 	actYank
+	actYankPop
 	actBackwardKillWord
 	actSelectAll
 	actDeselectAll
@@ -137,55 +228,120 @@ const (
 	actNextHistory
 	actExecute
 	actExecuteMulti
+	actExecuteSilent
+	actBecome
+	actReload
+	actReloadSync
+	actAppend
+	actToggleThrottle
+	actTogglePreview
+	actTogglePreviewFollow
+	actToggleWrap
+	actToggleTrack
+	actToggleCollapse
+	actToggleSelectedPane
+	actFocusSelectedPane
+	actPreviewUp
+	actPreviewDown
+	actPreviewPageUp
+	actPreviewPageDown
+	actPreviewHalfPageUp
+	actPreviewHalfPageDown
+	actClearQuery
+	actJump
+	actJumpAccept
+	actCopy
+	actCopySelected
+	actCopyQuery
+	actChangeBorderLabel
+	actChangePreviewLabel
+	actChangeFooter
+	actChangePrompt
+	actChangePreview
+	actChangePreviewWindow
+	actGrowPreview
+	actShrinkPreview
+	actTransform
+	actTransformQuery
+	actTransformPrompt
+	actTransformHeader
+	actChangeHeader
+	actPrint
 )
 
-func defaultKeymap() map[int]actionType {
-	keymap := make(map[int]actionType)
-	keymap[C.Invalid] = actInvalid
-	keymap[C.CtrlA] = actBeginningOfLine
-	keymap[C.CtrlB] = actBackwardChar
-	keymap[C.CtrlC] = actAbort
-	keymap[C.CtrlG] = actAbort
-	keymap[C.CtrlQ] = actAbort
-	keymap[C.ESC] = actAbort
-	keymap[C.CtrlD] = actDeleteCharEOF
-	keymap[C.CtrlE] = actEndOfLine
-	keymap[C.CtrlF] = actForwardChar
-	keymap[C.CtrlH] = actBackwardDeleteChar
-	keymap[C.BSpace] = actBackwardDeleteChar
-	keymap[C.Tab] = actToggleDown
-	keymap[C.BTab] = actToggleUp
-	keymap[C.CtrlJ] = actDown
-	keymap[C.CtrlK] = actUp
-	keymap[C.CtrlL] = actClearScreen
-	keymap[C.CtrlM] = actAccept
-	keymap[C.CtrlN] = actDown
-	keymap[C.CtrlP] = actUp
-	keymap[C.CtrlU] = actUnixLineDiscard
-	keymap[C.CtrlW] = actUnixWordRubout
-	keymap[C.CtrlY] = actYank
-
-	keymap[C.AltB] = actBackwardWord
-	keymap[C.SLeft] = actBackwardWord
-	keymap[C.AltF] = actForwardWord
-	keymap[C.SRight] = actForwardWord
-	keymap[C.AltD] = actKillWord
-	keymap[C.AltBS] = actBackwardKillWord
-
-	keymap[C.Up] = actUp
-	keymap[C.Down] = actDown
-	keymap[C.Left] = actBackwardChar
-	keymap[C.Right] = actForwardChar
-
-	keymap[C.Home] = actBeginningOfLine
-	keymap[C.End] = actEndOfLine
-	keymap[C.Del] = actDeleteChar
-	keymap[C.PgUp] = actPageUp
-	keymap[C.PgDn] = actPageDown
-
-	keymap[C.Rune] = actRune
-	keymap[C.Mouse] = actMouse
-	keymap[C.DoubleClick] = actAccept
+// reloadRequest is the value of EvtReload. The list is read from the
+// command, or from the default command if it is empty. If sync is set, the
+// current list is kept until the command is complete. If append is set, the
+// output of the command is appended to the current list instead.
+type reloadRequest struct {
+	command string
+	sync    bool
+	append  bool
+	env     []string
+}
+
+// action is an actionType with its argument, such as the command of execute
+type action struct {
+	t actionType
+	a string
+}
+
+func toActions(types ...actionType) []action {
+	actions := make([]action, len(types))
+	for idx, t := range types {
+		actions[idx] = action{t: t}
+	}
+	return actions
+}
+
+func defaultKeymap() map[int][]action {
+	keymap := make(map[int][]action)
+	keymap[C.Invalid] = toActions(actInvalid)
+	keymap[C.CtrlA] = toActions(actBeginningOfLine)
+	keymap[C.CtrlB] = toActions(actBackwardChar)
+	keymap[C.CtrlC] = toActions(actAbort)
+	keymap[C.CtrlG] = toActions(actAbort)
+	keymap[C.CtrlQ] = toActions(actAbort)
+	keymap[C.ESC] = toActions(actAbort)
+	keymap[C.CtrlD] = toActions(actDeleteCharEOF)
+	keymap[C.CtrlE] = toActions(actEndOfLine)
+	keymap[C.CtrlF] = toActions(actForwardChar)
+	keymap[C.CtrlH] = toActions(actBackwardDeleteChar)
+	keymap[C.BSpace] = toActions(actBackwardDeleteChar)
+	keymap[C.Tab] = toActions(actToggleDown)
+	keymap[C.BTab] = toActions(actToggleUp)
+	keymap[C.CtrlJ] = toActions(actDown)
+	keymap[C.CtrlK] = toActions(actUp)
+	keymap[C.CtrlL] = toActions(actClearScreen)
+	keymap[C.CtrlM] = toActions(actAccept)
+	keymap[C.CtrlN] = toActions(actDown)
+	keymap[C.CtrlP] = toActions(actUp)
+	keymap[C.CtrlU] = toActions(actUnixLineDiscard)
+	keymap[C.CtrlW] = toActions(actUnixWordRubout)
+	keymap[C.CtrlY] = toActions(actYank)
+	keymap[C.AltA+'y'-'a'] = toActions(actYankPop)
+
+	keymap[C.AltB] = toActions(actBackwardWord)
+	keymap[C.SLeft] = toActions(actBackwardWord)
+	keymap[C.AltF] = toActions(actForwardWord)
+	keymap[C.SRight] = toActions(actForwardWord)
+	keymap[C.AltD] = toActions(actKillWord)
+	keymap[C.AltBS] = toActions(actBackwardKillWord)
+
+	keymap[C.Up] = toActions(actUp)
+	keymap[C.Down] = toActions(actDown)
+	keymap[C.Left] = toActions(actBackwardChar)
+	keymap[C.Right] = toActions(actForwardChar)
+
+	keymap[C.Home] = toActions(actBeginningOfLine)
+	keymap[C.End] = toActions(actEndOfLine)
+	keymap[C.Del] = toActions(actDeleteChar)
+	keymap[C.PgUp] = toActions(actPageUp)
+	keymap[C.PgDn] = toActions(actPageDown)
+
+	keymap[C.Rune] = toActions(actRune)
+	keymap[C.Mouse] = toActions(actMouse)
+	keymap[C.DoubleClick] = toActions(actAccept)
 	return keymap
 }
 
@@ -193,56 +349,115 @@ func defaultKeymap() map[int]actionType {
 func NewTerminal(opts *Options, eventBox *util.EventBox) *Terminal {
 	input := []rune(opts.Query)
 	var header []string
-	if opts.Reverse {
+	if opts.Layout == layoutReverse {
 		header = opts.Header
 	} else {
 		header = reverseStringArray(opts.Header)
 	}
 	_tabStop = opts.Tabstop
+	wordPrev, wordNext, wordRubout := wordPatterns(opts.WordDelims)
 	var delay time.Duration
 	if opts.Tac {
 		delay = initialDelayTac
 	} else {
 		delay = initialDelay
 	}
-	return &Terminal{
+	t := Terminal{
 		initDelay:  delay,
-		inlineInfo: opts.InlineInfo,
+		info:       opts.Info,
+		infoSep:    opts.InfoSep,
+		infoFormat: opts.InfoFormat,
+		spinner:    makeSpinner(opts.Spinner),
+		selCounter: opts.SelCounter,
 		prompt:     opts.Prompt,
-		reverse:    opts.Reverse,
+		pointer:    opts.Pointer,
+		pointerPad: strings.Repeat(" ", displayWidth([]rune(opts.Pointer))),
+		marker:     opts.Marker,
+		markerPad:  strings.Repeat(" ", displayWidth([]rune(opts.Marker))),
+		jumping:    jumpDisabled,
+		jumpLabels: []rune(opts.JumpLabels),
+		layout:     opts.Layout,
 		hscroll:    opts.Hscroll,
 		hscrollOff: opts.HscrollOff,
+		scrollOff:  opts.ScrollOff,
+		wrap:       opts.Wrap,
+		keepRight:  opts.KeepRight,
+		ellipsis:   []rune(opts.Ellipsis),
 		cx:         len(input),
 		cy:         0,
 		offset:     0,
-		yanked:     []rune{},
+		killRing:   NewKillRing(killRingMax),
+		wordPrev:   wordPrev,
+		wordNext:   wordNext,
+		wordRubout: wordRubout,
+		vi:         opts.Vi,
+		clipboard:  opts.Clipboard,
+		pasteFirst: opts.PasteFirst,
 		input:      input,
 		multi:      opts.Multi,
+		multiMax:   opts.MultiMax,
 		sort:       opts.Sort > 0,
 		toggleSort: opts.ToggleSort,
+		throttle:   opts.Throttle,
+		throttleTo: util.Max(opts.Throttle, 1),
 		expect:     opts.Expect,
 		keymap:     opts.Keymap,
-		execmap:    opts.Execmap,
 		pressed:    "",
 		printQuery: opts.PrintQuery,
+		printLine:  linePrinter(opts.PrintZero),
 		history:    opts.History,
+		boost:      opts.BoostAccepted,
 		margin:     opts.Margin,
+		fullscreen: len(opts.Height) == 0,
 		marginInt:  [4]int{0, 0, 0, 0},
+		border:     opts.Border,
 		cycle:      opts.Cycle,
+		track:      opts.Track,
+		tree:       opts.Tree,
+		annotate:   opts.Annotation,
+		plain:      opts.Plain,
+		bell:       opts.Bell,
+		indexCol:   opts.IndexColumn,
+		collapsed:  make(map[string]bool),
 		header:     header,
 		header0:    header,
+		footer:     opts.Footer,
 		ansi:       opts.Ansi,
+		delimiter:  opts.Delimiter,
+		nth:        opts.Nth,
+		nthFields:  opts.HighlightNth,
 		reading:    true,
+		loaded:     false,
+		focus:      -1,
 		merger:     EmptyMerger,
 		selected:   make(map[int32]selectedItem),
+		detached:   []selectedItem{},
+		selPane:    opts.SelectedPane,
 		reqBox:     util.NewEventBox(),
 		eventBox:   eventBox,
 		mutex:      sync.Mutex{},
 		suppress:   true,
 		startChan:  make(chan bool, 1),
+		eventChan:  make(chan C.Event, 10),
+		exit:       os.Exit,
 		initFunc: func() {
-			C.Init(opts.Theme, opts.Black, opts.Mouse)
+			theme := autoTheme(opts)
+			if len(opts.Height) > 0 {
+				C.InitLight(theme, opts.Black, opts.Plain, func(maxHeight int) int {
+					return heightFor(opts.Height, maxHeight, minHeight+borderLines(opts.Border))
+				}, opts.Clear)
+			} else {
+				C.Init(theme, opts.Black, opts.Plain, opts.Mouse)
+			}
 		}}
+	t.borderLabel = opts.BorderLabel
+	t.headerFirst = opts.HeaderFirst
+	t.preview = opts.Preview
+	t.previewBase = opts.Preview
+	if len(opts.Preview.command) > 0 {
+		t.newPreviewer()
+	}
+	return &t
 }
 
 // Input returns current query string
@@ -256,6 +471,9 @@ func (t *Terminal) Input() []rune {
 func (t *Terminal) UpdateCount(cnt int, final bool) {
 	t.mutex.Lock()
 	t.count = cnt
+	if !final {
+		t.loaded = false
+	}
 	t.reading = !final
 	t.mutex.Unlock()
 	t.reqBox.Set(reqInfo, nil)
@@ -273,6 +491,17 @@ func reverseStringArray(input []string) []string {
 	return reversed
 }
 
+// changeHeader replaces the lines of the header given by --header with the
+// text, keeping the ones from --header-lines
+func (t *Terminal) changeHeader(text string) {
+	lines := footerLines(text)
+	if t.layout != layoutReverse {
+		lines = reverseStringArray(lines)
+	}
+	t.header = append(append([]string{}, lines...), t.header[len(t.header0):]...)
+	t.header0 = lines
+}
+
 // UpdateHeader updates the header
 func (t *Terminal) UpdateHeader(header []string) {
 	t.mutex.Lock()
@@ -282,11 +511,12 @@ func (t *Terminal) UpdateHeader(header []string) {
 }
 
 // UpdateProgress updates the search progress
-func (t *Terminal) UpdateProgress(progress float32) {
+func (t *Terminal) UpdateProgress(status SearchStatus) {
 	t.mutex.Lock()
-	newProgress := int(progress * 100)
-	changed := t.progress != newProgress
+	newProgress := int(status.Progress * 100)
+	changed := t.progress != newProgress || t.matched != status.Matched
 	t.progress = newProgress
+	t.matched = status.Matched
 	t.mutex.Unlock()
 
 	if changed {
@@ -294,38 +524,229 @@ func (t *Terminal) UpdateProgress(progress float32) {
 	}
 }
 
+// DetachSelection puts aside the selected items when the list is being
+// replaced as their indexes are no longer valid. The position of the cursor
+// and the scroll offset are kept to be restored in the new list.
+func (t *Terminal) DetachSelection() {
+	t.mutex.Lock()
+	if t.reloadPos == nil {
+		t.reloadPos = &[2]int{t.cy, t.offset}
+	}
+	if t.track && t.trackText == nil && t.cy >= 0 && t.cy < t.merger.Length() {
+		// The indexes restart in the new list, so the current item is tracked
+		// by its text instead
+		t.trackText = t.merger.Get(t.cy).StringPtr(t.ansi)
+	}
+	for _, sel := range t.selected {
+		t.detached = append(t.detached, sel)
+	}
+	t.selected = make(map[int32]selectedItem)
+	t.mutex.Unlock()
+	t.reqBox.Set(reqInfo, nil)
+	t.reqBox.Set(reqList, nil)
+}
+
+// ReattachSelection selects the items in the new list whose lines were
+// selected before the list was replaced
+func (t *Terminal) ReattachSelection(chunks []*Chunk) {
+	t.mutex.Lock()
+	detached := make(map[string][]selectedItem)
+	for _, sel := range t.detached {
+		detached[*sel.text] = append(detached[*sel.text], sel)
+	}
+	t.detached = []selectedItem{}
+	for _, chunk := range chunks {
+		for _, item := range *chunk {
+			if len(detached) == 0 {
+				break
+			}
+			text := item.StringPtr(t.ansi)
+			if sels, found := detached[*text]; found {
+				t.selected[item.Index()] = sels[0]
+				if len(sels) > 1 {
+					detached[*text] = sels[1:]
+				} else {
+					delete(detached, *text)
+				}
+			}
+		}
+	}
+	t.mutex.Unlock()
+	t.reqBox.Set(reqInfo, nil)
+	t.reqBox.Set(reqList, nil)
+}
+
+// Fail closes the terminal and exits with the error, e.g. when the input
+// cannot be read
+func (t *Terminal) Fail(err error) {
+	t.mutex.Lock()
+	t.failure = err.Error()
+	t.mutex.Unlock()
+	t.reqBox.Set(reqFail, nil)
+}
+
 // UpdateList updates Merger to display the list
 func (t *Terminal) UpdateList(merger *Merger) {
 	t.mutex.Lock()
 	t.progress = 100
+	merger = t.buildTree(merger)
+	// Ring the bell when the query stops matching any item
+	bell := t.bell && t.count > 0 && t.merger.Length() > 0 && merger.Length() == 0
+	if t.track {
+		t.trackItem(merger)
+		t.reloadPos = nil
+	} else if pos := t.reloadPos; pos != nil && (merger.Length() > pos[0] || !t.reading) {
+		// The position before reload is restored once the new list is long
+		// enough, or is complete
+		t.cy, t.offset = pos[0], pos[1]
+		t.reloadPos = nil
+	}
 	t.merger = merger
+	load := !t.reading && !t.loaded
+	t.loaded = !t.reading
+	result := 0
+	if !t.reading {
+		switch merger.Length() {
+		case 0:
+			result = C.Zero
+		case 1:
+			result = C.One
+		}
+	}
+	if _, prs := t.keymap[result]; !prs {
+		result = 0
+	}
+	t.mutex.Unlock()
+	t.reqBox.Set(reqInfo, nil)
+	t.reqBox.Set(reqList, nil)
+	if bell {
+		t.reqBox.Set(reqBell, nil)
+	}
+	if load {
+		t.sendEvent(C.Event{Type: C.Load})
+	} else if result == 0 && len(t.eventChan) == 0 {
+		// The main loop checks the current item after any event
+		t.sendEvent(C.Event{Type: C.Focus})
+	}
+	if result > 0 {
+		t.sendEvent(C.Event{Type: result})
+	}
+}
+
+// sendEvent sends the event to the main loop without blocking. The event is
+// dropped if the main loop is busy with the events sent before, e.g. when an
+// action is running a command.
+func (t *Terminal) sendEvent(event C.Event) {
+	select {
+	case t.eventChan <- event:
+	default:
+	}
+}
+
+// trackItem moves the cursor to the position of the current item in the new
+// list. The cursor stays on the same row if the item is not in the list. After
+// reload, the item is looked up by its text until it is found in the new list
+// or the list is complete.
+func (t *Terminal) trackItem(merger *Merger) {
+	if text := t.trackText; text != nil {
+		for i := 0; i < merger.Length(); i++ {
+			if *merger.Get(i).StringPtr(t.ansi) == *text {
+				t.cy = i
+				t.trackText = nil
+				return
+			}
+		}
+		if !t.reading {
+			t.trackText = nil
+		}
+		return
+	}
+	if t.cy < 0 || t.cy >= t.merger.Length() {
+		return
+	}
+	index := t.merger.Get(t.cy).Index()
+	for i := 0; i < merger.Length(); i++ {
+		if merger.Get(i).Index() == index {
+			t.cy = i
+			return
+		}
+	}
+}
+
+// focusChanged tells if the current item is different from the one when it
+// was last called
+func (t *Terminal) focusChanged() bool {
+	focus := int32(-1)
+	if t.cy >= 0 && t.cy < t.merger.Length() {
+		focus = t.merger.Get(t.cy).Index()
+	}
+	changed := focus != t.focus
+	t.focus = focus
+	return changed
+}
+
+// UpdatePartialList updates Merger to display the partial result of the
+// ongoing search
+func (t *Terminal) UpdatePartialList(merger *Merger) {
+	t.mutex.Lock()
+	t.merger = t.buildTree(merger)
 	t.mutex.Unlock()
 	t.reqBox.Set(reqInfo, nil)
 	t.reqBox.Set(reqList, nil)
 }
 
+// linePrinter returns the function to print a line of the output, which is
+// terminated by a NUL character instead of a newline with --print0
+func linePrinter(zero bool) func(string) {
+	if zero {
+		return func(str string) {
+			fmt.Print(str, "\x00")
+		}
+	}
+	return func(str string) {
+		fmt.Println(str)
+	}
+}
+
 func (t *Terminal) output() bool {
 	if t.printQuery {
-		fmt.Println(string(t.input))
+		t.printLine(string(t.input))
 	}
 	if len(t.expect) > 0 {
-		fmt.Println(t.pressed)
+		t.printLine(t.pressed)
+	}
+	for _, str := range t.printQueue {
+		t.printLine(str)
+	}
+	accept := func(str string) {
+		t.printLine(str)
+		if t.boost != nil {
+			t.boost.append(str)
+		}
 	}
 	found := len(t.selected) > 0
 	if !found {
 		cnt := t.merger.Length()
 		if cnt > 0 && cnt > t.cy {
-			fmt.Println(t.merger.Get(t.cy).AsString(t.ansi))
+			accept(t.merger.Get(t.cy).AsString(t.ansi))
 			found = true
 		}
 	} else {
 		for _, sel := range t.sortSelected() {
-			fmt.Println(*sel.text)
+			accept(*sel.text)
 		}
 	}
 	return found
 }
 
+// copyToClipboard copies the text to the system clipboard unless it is
+// disabled or the text is too large for the escape sequence
+func (t *Terminal) copyToClipboard(text string) {
+	if t.clipboard && len(text) <= clipboardMax {
+		C.SetClipboard(text)
+	}
+}
+
 func (t *Terminal) sortSelected() []selectedItem {
 	sels := make([]selectedItem, 0, len(t.selected))
 	for _, sel := range t.selected {
@@ -342,11 +763,45 @@ func runeWidth(r rune, prefixWidth int) int {
 		return w
 	} else {
 		w := runewidth.RuneWidth(r)
+		if isCombining(r) {
+			// Combined with the preceding character on the screen
+			w = 0
+		}
 		_runeWidths[r] = w
 		return w
 	}
 }
 
+// isCombining tells if the rune is a combining mark, such as the accent
+// composed by a dead key, or a zero width joiner
+func isCombining(r rune) bool {
+	return r == '\u200d' || unicode.In(r, unicode.Mn, unicode.Me)
+}
+
+// prevChar returns the index of the character before the index in the
+// runes, where a character is a base rune followed by the combining marks
+func prevChar(runes []rune, idx int) int {
+	for idx > 0 {
+		idx--
+		if !isCombining(runes[idx]) {
+			break
+		}
+	}
+	return idx
+}
+
+// nextChar returns the index of the character after the one at the index in
+// the runes, skipping the combining marks following it
+func nextChar(runes []rune, idx int) int {
+	for idx < len(runes) {
+		idx++
+		if idx == len(runes) || !isCombining(runes[idx]) {
+			break
+		}
+	}
+	return idx
+}
+
 func displayWidth(runes []rune) int {
 	l := 0
 	for _, r := range runes {
@@ -358,6 +813,19 @@ func displayWidth(runes []rune) int {
 const minWidth = 16
 const minHeight = 4
 
+// heightFor returns the number of lines to use for --height on the terminal
+// with the given number of lines
+func heightFor(height string, maxHeight int, min int) int {
+	var lines int
+	if strings.HasSuffix(height, "%") {
+		num, _ := strconv.ParseFloat(height[:len(height)-1], 64)
+		lines = int(float64(maxHeight) * num * 0.01)
+	} else {
+		lines, _ = strconv.Atoi(height)
+	}
+	return util.Max(lines, min)
+}
+
 func (t *Terminal) calculateMargins() {
 	screenWidth := C.MaxX()
 	screenHeight := C.MaxY()
@@ -390,12 +858,127 @@ func (t *Terminal) calculateMargins() {
 	}
 	adjust(1, 3, screenWidth, minWidth)
 	adjust(0, 2, screenHeight, minHeight)
+	t.calculateBorderArea(screenWidth, screenHeight)
+	t.calculatePreviewArea(screenWidth, screenHeight)
+	t.calculateSelectedPaneArea(screenWidth, screenHeight)
+}
+
+type borderCharset struct {
+	horizontal  string
+	vertical    string
+	topLeft     string
+	topRight    string
+	bottomLeft  string
+	bottomRight string
+}
+
+var borderChars = map[borderStyle]borderCharset{
+	borderRounded:    {"─", "│", "╭", "╮", "╰", "╯"},
+	borderSharp:      {"─", "│", "┌", "┐", "└", "┘"},
+	borderDouble:     {"═", "║", "╔", "╗", "╚", "╝"},
+	borderHorizontal: {"─", "", "", "", "", ""}}
+
+// borderLines returns the number of lines taken by the border
+func borderLines(border borderStyle) int {
+	if border == borderNone {
+		return 0
+	}
+	return 2
+}
+
+// calculateBorderArea places the border along the margins and moves the
+// margins inside it. A space is left between the vertical lines and the
+// content.
+func (t *Terminal) calculateBorderArea(screenWidth int, screenHeight int) {
+	if t.border == borderNone {
+		return
+	}
+	top, right, bottom, left := t.marginInt[0], t.marginInt[1], t.marginInt[2], t.marginInt[3]
+	t.borderArea = screenArea{top, left, screenHeight - top - bottom, screenWidth - left - right}
+	t.marginInt[0]++
+	t.marginInt[2]++
+	if t.border != borderHorizontal {
+		t.marginInt[1] += 2
+		t.marginInt[3] += 2
+	}
+}
+
+func (t *Terminal) printBorder() {
+	area := t.borderArea
+	if t.border == borderNone || area.width < 2 || area.height < 2 {
+		return
+	}
+	chars := borderChars[t.border]
+	if t.border == borderHorizontal {
+		line := strings.Repeat(chars.horizontal, area.width)
+		C.Move(area.y, area.x)
+		C.CPrint(C.ColBorder, false, line)
+		C.Move(area.y+area.height-1, area.x)
+		C.CPrint(C.ColBorder, false, line)
+		t.printBorderLabel(t.borderLabel, area, area.x, area.width)
+		return
+	}
+	line := strings.Repeat(chars.horizontal, area.width-2)
+	C.Move(area.y, area.x)
+	C.CPrint(C.ColBorder, false, chars.topLeft+line+chars.topRight)
+	for y := area.y + 1; y < area.y+area.height-1; y++ {
+		C.Move(y, area.x)
+		C.CPrint(C.ColBorder, false, chars.vertical)
+		C.Move(y, area.x+area.width-1)
+		C.CPrint(C.ColBorder, false, chars.vertical)
+	}
+	C.Move(area.y+area.height-1, area.x)
+	C.CPrint(C.ColBorder, false, chars.bottomLeft+line+chars.bottomRight)
+	t.printBorderLabel(t.borderLabel, area, area.x+1, area.width-2)
+}
+
+// inBorderArea tells if the position is on the border around the finder
+// outside the margins inside it
+func (t *Terminal) inBorderArea(y int, x int) bool {
+	area := t.borderArea
+	if t.border == borderNone || y < area.y || y >= area.y+area.height ||
+		x < area.x || x >= area.x+area.width {
+		return false
+	}
+	return y < t.marginInt[0] || y >= C.MaxY()-t.marginInt[2] ||
+		x < t.marginInt[3] || x >= C.MaxX()-t.marginInt[1]
+}
+
+// printBorderLabel prints the label on the top or the bottom line of the area
+// between the columns x and x+width
+func (t *Terminal) printBorderLabel(opts labelOpts, area screenArea, x int, width int) {
+	if len(opts.label) == 0 || width < 1 {
+		return
+	}
+	label, _ := trimRight([]rune(opts.label), width)
+	if displayWidth(label) > width {
+		label = label[:len(label)-1]
+	}
+	y := area.y
+	if opts.bottom {
+		y = area.y + area.height - 1
+	}
+	C.Move(y, x+labelColumn(opts.offset, displayWidth(label), width))
+	C.CPrint(C.ColBorder, false, string(label))
+}
+
+// labelColumn returns the column of the label of the width on the line of the
+// length. A positive offset is the column counted from 1 at the left end, and
+// a negative one is counted from -1 at the right end.
+func labelColumn(offset int, width int, length int) int {
+	switch {
+	case offset > 0:
+		return util.Max(0, util.Min(offset-1, length-width))
+	case offset < 0:
+		return util.Max(0, length-width+offset+1)
+	}
+	return util.Max(0, (length-width)/2)
 }
 
 func (t *Terminal) move(y int, x int, clear bool) {
 	x += t.marginInt[3]
 	maxy := C.MaxY()
-	if !t.reverse {
+	if t.layout != layoutReverse {
 		y = maxy - y - 1 - t.marginInt[2]
 	} else {
 		y += t.marginInt[0]
@@ -408,35 +991,105 @@ func (t *Terminal) move(y int, x int, clear bool) {
 	}
 }
 
+// promptLine returns the line of the prompt, which comes after the header if
+// --header-first is set
+func (t *Terminal) promptLine() int {
+	if t.headerFirst {
+		return len(t.header)
+	}
+	return 0
+}
+
 func (t *Terminal) placeCursor() {
-	t.move(0, displayWidth([]rune(t.prompt))+displayWidth(t.input[:t.cx]), false)
+	t.move(t.promptLine(), displayWidth([]rune(t.prompt))+displayWidth(t.input[:t.cx]), false)
+}
+
+// paste inserts the pasted text into the query at the cursor at once. The
+// line breaks and the other control characters are removed, or only the first
+// line is inserted with --paste-first-line, so that the pasted text doesn't
+// trigger the key bindings.
+func (t *Terminal) paste(text string) {
+	if t.pasteFirst {
+		if idx := strings.IndexAny(text, "\r\n"); idx >= 0 {
+			text = text[:idx]
+		}
+	}
+	runes := []rune(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text))
+	t.input = append(append(copySlice(t.input[:t.cx]), runes...), t.input[t.cx:]...)
+	t.cx += len(runes)
+}
+
+// inputIndex returns the index of the character of the query at the column,
+// or the end of the query if it is beyond it
+func (t *Terminal) inputIndex(col int) int {
+	idx := 0
+	for idx < len(t.input) {
+		next := nextChar(t.input, idx)
+		if displayWidth(t.input[:next]) > col {
+			break
+		}
+		idx = next
+	}
+	return idx
 }
 
 func (t *Terminal) printPrompt() {
-	t.move(0, 0, true)
+	t.move(t.promptLine(), 0, true)
 	C.CPrint(C.ColPrompt, true, t.prompt)
 	C.CPrint(C.ColNormal, true, string(t.input))
 }
 
+// makeSpinner splits the characters into the frames of the spinner, each
+// padded to the width of the widest one so that the info stays in place
+func makeSpinner(chars string) []string {
+	var width int
+	for _, r := range chars {
+		width = util.Max(width, runeWidth(r, 0))
+	}
+	frames := []string{}
+	for _, r := range chars {
+		frames = append(frames, string(r)+strings.Repeat(" ", width-runeWidth(r, 0)))
+	}
+	return frames
+}
+
+// noInfoLine tells if the line for the info is not used
+func (t *Terminal) noInfoLine() bool {
+	return t.info != infoDefault
+}
+
 func (t *Terminal) printInfo() {
-	if t.inlineInfo {
-		t.move(0, displayWidth([]rune(t.prompt))+displayWidth(t.input)+1, true)
+	if t.info == infoHidden {
+		return
+	}
+	if t.info == infoInline {
+		t.move(t.promptLine(), displayWidth([]rune(t.prompt))+displayWidth(t.input)+1, true)
 		if t.reading {
-			C.CPrint(C.ColSpinner, true, " < ")
+			C.CPrint(C.ColSpinner, true, t.infoSep)
 		} else {
-			C.CPrint(C.ColPrompt, true, " < ")
+			C.CPrint(C.ColPrompt, true, t.infoSep)
 		}
 	} else {
-		t.move(1, 0, true)
-		if t.reading {
+		t.move(t.promptLine()+1, 0, true)
+		if t.reading && !t.plain {
 			duration := int64(spinnerDuration)
-			idx := (time.Now().UnixNano() % (duration * int64(len(_spinner)))) / duration
-			C.CPrint(C.ColSpinner, true, _spinner[idx])
+			idx := (time.Now().UnixNano() % (duration * int64(len(t.spinner)))) / duration
+			C.CPrint(C.ColSpinner, true, t.spinner[idx])
 		}
-		t.move(1, 2, false)
+		t.move(t.promptLine()+1, displayWidth([]rune(t.spinner[0]))+1, false)
 	}
 
-	output := fmt.Sprintf("%d/%d", t.merger.Length(), t.count)
+	matched := t.merger.Length()
+	if t.progress > 0 && t.progress < 100 {
+		// The number of matches found so far in the ongoing search
+		matched = t.matched
+	}
+	output := fmt.Sprintf("%d/%d", matched, t.count)
 	if t.toggleSort {
 		if t.sort {
 			output += "/S"
@@ -444,15 +1097,38 @@ func (t *Terminal) printInfo() {
 			output += "  "
 		}
 	}
-	if t.multi && len(t.selected) > 0 {
-		output += fmt.Sprintf(" (%d)", len(t.selected))
+	if t.multiMax > 0 {
+		output += " " + strings.Replace(t.selCounter, "%s", fmt.Sprintf("%d/%d", len(t.selected), t.multiMax), -1)
+	} else if t.multi && len(t.selected) > 0 {
+		output += " " + strings.Replace(t.selCounter, "%s", strconv.Itoa(len(t.selected)), -1)
 	}
 	if t.progress > 0 && t.progress < 100 {
 		output += fmt.Sprintf(" (%d%%)", t.progress)
 	}
+	if len(t.infoFormat) > 0 {
+		current := 0
+		if t.merger.Length() > 0 {
+			current = t.cy + 1
+		}
+		progress := 100
+		if t.progress > 0 && t.progress < 100 {
+			progress = t.progress
+		}
+		output = formatInfo(t.infoFormat, matched, t.count, len(t.selected), current, progress)
+	}
 	C.CPrint(C.ColInfo, false, output)
 }
 
+// formatInfo expands the placeholders in the template of the info line
+func formatInfo(format string, matched int, total int, selected int, current int, progress int) string {
+	return strings.NewReplacer(
+		"{matched}", strconv.Itoa(matched),
+		"{total}", strconv.Itoa(total),
+		"{selected}", strconv.Itoa(selected),
+		"{current}", strconv.Itoa(current),
+		"{progress}", strconv.Itoa(progress)).Replace(format)
+}
+
 func (t *Terminal) maxHeight() int {
 	return C.MaxY() - t.marginInt[0] - t.marginInt[2]
 }
@@ -465,59 +1141,248 @@ func (t *Terminal) printHeader() {
 	var state *ansiState
 	for idx, lineStr := range t.header {
 		line := idx + 2
-		if t.inlineInfo {
+		if t.headerFirst {
+			line = idx
+		} else if t.noInfoLine() {
 			line--
 		}
 		if line >= max {
 			continue
 		}
-		trimmed, colors, newState := extractColor(lineStr, state)
-		state = newState
-		item := &Item{
-			text:   []rune(trimmed),
-			colors: colors,
-			rank:   buildEmptyRank(0)}
+		state = t.printHeaderLine(line, lineStr, state)
+	}
+}
 
-		t.move(line, 2, true)
-		t.printHighlighted(item, false, C.ColHeader, 0, false)
+// printFooter prints the footer at the other end of the list from the prompt
+func (t *Terminal) printFooter() {
+	max := t.maxHeight()
+	// The header takes precedence if there is not enough space
+	min := 2 + len(t.header)
+	if t.noInfoLine() {
+		min--
+	}
+	var state *ansiState
+	for idx, lineStr := range t.footer {
+		// The lines are counted from the prompt unless the layout is reverse
+		line := max - 1 - idx
+		if t.layout == layoutReverse {
+			line = max - len(t.footer) + idx
+		}
+		if line < min {
+			continue
+		}
+		state = t.printHeaderLine(line, lineStr, state)
 	}
 }
 
+// printHeaderLine prints the line of the header or the footer with the ANSI
+// colors in it, and returns the state of the colors at the end of the line
+func (t *Terminal) printHeaderLine(line int, lineStr string, state *ansiState) *ansiState {
+	trimmed, colors, newState := extractColor(lineStr, state)
+	item := &Item{
+		text:   []rune(trimmed),
+		colors: colors,
+		rank:   buildEmptyRank(0)}
+
+	t.move(line, t.itemIndent(), true)
+	t.printHighlighted(item, false, C.ColHeader, 0, false, t.maxItemWidth())
+	return newState
+}
+
 func (t *Terminal) printList() {
 	t.constrain()
 
 	maxy := t.maxItems()
 	count := t.merger.Length() - t.offset
-	for i := 0; i < maxy; i++ {
-		line := i + 2 + len(t.header)
-		if t.inlineInfo {
-			line--
+	t.listed = 0
+	t.rowItems = make([]int, maxy)
+	for row, i := 0, 0; row < maxy; i++ {
+		if i >= count {
+			t.rowItems[row] = t.merger.Length()
+			t.move(t.listLine(row), 0, true)
+			row++
+			continue
 		}
-		t.move(line, 0, true)
-		if i < count {
-			t.printItem(t.merger.Get(i+t.offset), i == t.cy-t.offset)
+		rows := t.printItem(t.merger.Get(i+t.offset), i, i == t.cy-t.offset, row, maxy-row)
+		for idx := row; idx < row+rows; idx++ {
+			t.rowItems[idx] = i + t.offset
 		}
+		row += rows
+		t.listed++
 	}
 }
 
-func (t *Terminal) printItem(item *Item, current bool) {
-	_, selected := t.selected[item.Index()]
+// listLine returns the line for the row of the list to pass to move
+func (t *Terminal) listLine(row int) int {
+	line := row + 2 + len(t.header)
+	if t.layout == layoutReverseList {
+		// The first item is on the top of the list
+		line = t.maxItems() - row + 1 + len(t.header)
+	}
+	if t.noInfoLine() {
+		line--
+	}
+	return line
+}
+
+// maxItemWidth returns the width of the screen for the text of each item
+func (t *Terminal) maxItemWidth() int {
+	return C.MaxX() - t.itemIndent() - 1 - t.marginInt[1] - t.marginInt[3]
+}
+
+// wrapItem returns the indexes of the characters of the item at the
+// beginning of the lines when the item is wrapped to the width of the screen
+func (t *Terminal) wrapItem(item *Item) []int {
+	width := util.Max(1, t.maxItemWidth())
+	starts := []int{0}
+	col := 0
+	for idx, r := range item.text {
+		w := runeWidth(r, col)
+		if col > 0 && col+w > width {
+			starts = append(starts, idx)
+			col = 0
+			w = runeWidth(r, 0)
+		}
+		col += w
+	}
+	return starts
+}
+
+// itemIndent returns the width of the pointer and the marker in front of each
+// item
+func (t *Terminal) itemIndent() int {
+	return len(t.pointerPad) + len(t.markerPad) + t.indexWidth()
+}
+
+// indexWidth returns the width of the index column including the space after
+// the number, or 0 if it is not displayed
+func (t *Terminal) indexWidth() int {
+	var max int
+	switch t.indexCol {
+	case indexInput:
+		max = t.count
+	case indexVisible:
+		max = t.merger.Length()
+	default:
+		return 0
+	}
+	return len(strconv.Itoa(util.Max(max-1, 0))) + 1
+}
+
+// printIndex prints the 0-based index of the item, which is the one in the
+// input as {n} placeholder or the position in the list, in the index column.
+// The column is left blank if number is negative.
+func (t *Terminal) printIndex(number int, current bool) {
+	width := t.indexWidth()
+	if width == 0 {
+		return
+	}
+	text := strings.Repeat(" ", width)
+	if number >= 0 {
+		text = fmt.Sprintf("%*d ", width-1, number)
+	}
 	if current {
-		C.CPrint(C.ColCursor, true, ">")
-		if selected {
-			C.CPrint(C.ColSelected, true, ">")
+		C.CPrint(C.ColCurrentDim, true, text)
+	} else {
+		C.CPrint(C.ColDim, false, text)
+	}
+}
+
+// indexNumber returns the number to print in the index column for the i-th
+// item on the screen
+func (t *Terminal) indexNumber(item *Item, i int) int {
+	if t.indexCol == indexVisible {
+		return t.offset + i
+	}
+	return int(item.Index())
+}
+
+// printItem prints the i-th item of the list from the row, and returns the
+// number of the rows taken, which can be more than one in wrap mode but no more
+// than maxRows
+func (t *Terminal) printItem(item *Item, i int, current bool, row int, maxRows int) int {
+	item = t.displayItem(item)
+	if !t.wrap {
+		t.move(t.listLine(row), 0, true)
+		t.printIndicators(item, i, current)
+		t.printIndex(t.indexNumber(item, i), current)
+		maxWidth := t.maxItemWidth()
+		item, annotation := t.splitAnnotation(item)
+		if annotation != nil {
+			maxWidth -= displayWidth(t.annotationText(annotation)) + 1
+		}
+		if current {
+			t.printHighlighted(item, true, C.ColCurrent, C.ColCurrentMatch, true, maxWidth)
 		} else {
-			C.CPrint(C.ColCurrent, true, " ")
+			t.printHighlighted(item, false, 0, C.ColMatch, false, maxWidth)
 		}
-		t.printHighlighted(item, true, C.ColCurrent, C.ColCurrentMatch, true)
-	} else {
-		C.CPrint(C.ColCursor, true, " ")
-		if selected {
-			C.CPrint(C.ColSelected, true, ">")
+		if annotation != nil {
+			t.printAnnotation(annotation, row, current)
+		}
+		return 1
+	}
+
+	col1, col2 := 0, C.ColMatch
+	if current {
+		col1, col2 = C.ColCurrent, C.ColCurrentMatch
+	}
+	offsets, col1 := t.highlightFields(item, item.colorOffsets(col2, current, current), col1, current)
+	starts := t.wrapItem(item)
+	rows := util.Min(len(starts), maxRows)
+	for j := 0; j < rows; j++ {
+		// The rows go upward in the default layout
+		r := row + j
+		if t.layout == layoutDefault {
+			r = row + rows - 1 - j
+		}
+		t.move(t.listLine(r), 0, true)
+		if j == 0 {
+			t.printIndicators(item, i, current)
+			t.printIndex(t.indexNumber(item, i), current)
+		} else if current {
+			C.CPrint(C.ColCurrent, true, t.pointerPad+t.markerPad)
+			t.printIndex(-1, current)
 		} else {
-			C.Print(" ")
+			C.Print(t.pointerPad + t.markerPad)
+			t.printIndex(-1, current)
+		}
+
+		begin, end := starts[j], len(item.text)
+		if j+1 < len(starts) {
+			end = starts[j+1]
+		}
+		lineOffsets := make([]colorOffset, len(offsets))
+		for idx, offset := range offsets {
+			lineOffsets[idx] = offset
+			lineOffsets[idx].offset[0] = util.Constrain32(offset.offset[0]-int32(begin), 0, int32(end-begin))
+			lineOffsets[idx].offset[1] = util.Constrain32(offset.offset[1]-int32(begin), 0, int32(end-begin))
 		}
-		t.printHighlighted(item, false, 0, C.ColMatch, false)
+		t.printColored(item.text[begin:end], lineOffsets, col1, current)
+	}
+	return rows
+}
+
+// printIndicators prints the pointer and the marker in front of the item. In
+// jump mode, the label for the i-th item is printed in place of the pointer.
+func (t *Terminal) printIndicators(item *Item, i int, current bool) {
+	_, selected := t.selected[item.Index()]
+	if t.jumping != jumpDisabled && len(t.pointerPad) > 0 {
+		label := " "
+		if i < len(t.jumpLabels) {
+			label = string(t.jumpLabels[i])
+		}
+		C.CPrint(C.ColCursor, true, label+t.pointerPad[1:])
+	} else if current {
+		C.CPrint(C.ColCursor, true, t.pointer)
+	} else {
+		C.CPrint(C.ColCursor, true, t.pointerPad)
+	}
+	if selected {
+		C.CPrint(C.ColSelected, true, t.marker)
+	} else if current {
+		C.CPrint(C.ColCurrent, true, t.markerPad)
+	} else {
+		C.Print(t.markerPad)
 	}
 }
 
@@ -545,21 +1410,79 @@ func displayWidthWithLimit(runes []rune, prefixWidth int, limit int) int {
 	return l
 }
 
-func trimLeft(runes []rune, width int) ([]rune, int32) {
+func trimLeft(runes []rune, width int, prefixWidth int) ([]rune, int32) {
 	currentWidth := displayWidth(runes)
 	var trimmed int32
 
 	for currentWidth > width && len(runes) > 0 {
 		runes = runes[1:]
 		trimmed++
-		currentWidth = displayWidthWithLimit(runes, 2, width)
+		currentWidth = displayWidthWithLimit(runes, prefixWidth, width)
 	}
 	return runes, trimmed
 }
 
-func (t *Terminal) printHighlighted(item *Item, bold bool, col1 int, col2 int, current bool) {
-	var maxe int
+// overflow trims the text wider than maxWidth and puts the ellipsis in place
+// of the trimmed part. If hscroll is enabled, the text is scrolled so that the
+// end of the match at maxe and the next hscrollOff columns are visible. With
+// keepRight, the end of the text is displayed instead as long as the match
+// from minb is visible. The offsets are adjusted accordingly.
+func (t *Terminal) overflow(text []rune, offsets []colorOffset, minb int, maxe int, maxWidth int) []rune {
+	fullWidth := displayWidth(text)
+	if fullWidth <= maxWidth {
+		return text
+	}
+	ellipsisWidth := displayWidth(t.ellipsis)
+	if t.keepRight && (!t.hscroll ||
+		displayWidth(text[util.Constrain(minb, 0, len(text)):]) <= maxWidth-ellipsisWidth) {
+		// ..ing
+		return t.trimOverflowLeft(text, offsets, maxWidth)
+	}
+	if t.hscroll {
+		maxe = util.Constrain(maxe, 0, len(text))
+		matchEndWidth := displayWidth(text[:maxe]) + util.Min(maxWidth/2-ellipsisWidth, t.hscrollOff)
+		if matchEndWidth <= maxWidth-ellipsisWidth {
+			// Stri..
+			text, _ = trimRight(text, maxWidth-ellipsisWidth)
+			return append(text, t.ellipsis...)
+		}
+		// ..ri..
+		if matchEndWidth < fullWidth-ellipsisWidth {
+			text, _ = trimRight(text, matchEndWidth)
+			text = append(text, t.ellipsis...)
+		}
+		return t.trimOverflowLeft(text, offsets, maxWidth)
+	}
+
+	text, _ = trimRight(text, maxWidth-ellipsisWidth)
+	for idx, offset := range offsets {
+		offsets[idx].offset[0] = util.Min32(offset.offset[0], int32(len(text)))
+		offsets[idx].offset[1] = util.Min32(offset.offset[1], int32(len(text)))
+	}
+	return append(text, t.ellipsis...)
+}
+
+// trimOverflowLeft trims the beginning of the text to fit in maxWidth with the
+// ellipsis in front of it, and shifts the offsets accordingly
+func (t *Terminal) trimOverflowLeft(text []rune, offsets []colorOffset, maxWidth int) []rune {
+	ellipsisWidth := displayWidth(t.ellipsis)
+	text, diff := trimLeft(text, maxWidth-ellipsisWidth, ellipsisWidth)
+
+	shift := int32(len(t.ellipsis)) - diff
+	for idx, offset := range offsets {
+		b := util.Max32(offset.offset[0]+shift, int32(len(t.ellipsis)))
+		offsets[idx].offset[0] = b
+		offsets[idx].offset[1] = util.Max32(b, offset.offset[1]+shift)
+	}
+	return append(append([]rune{}, t.ellipsis...), text...)
+}
+
+// printHighlighted prints the item with the matches highlighted, trimmed to
+// maxWidth
+func (t *Terminal) printHighlighted(item *Item, bold bool, col1 int, col2 int, current bool, maxWidth int) {
+	minb, maxe := len(item.text), 0
 	for _, offset := range item.offsets {
+		minb = util.Min(minb, int(offset[0]))
 		maxe = util.Max(maxe, int(offset[1]))
 	}
 
@@ -567,47 +1490,58 @@ func (t *Terminal) printHighlighted(item *Item, bold bool, col1 int, col2 int, c
 	text := make([]rune, len(item.text))
 	copy(text, item.text)
 	offsets := item.colorOffsets(col2, bold, current)
-	maxWidth := C.MaxX() - 3 - t.marginInt[1] - t.marginInt[3]
-	maxe = util.Constrain(maxe+util.Min(maxWidth/2-2, t.hscrollOff), 0, len(text))
-	fullWidth := displayWidth(text)
-	if fullWidth > maxWidth {
-		if t.hscroll {
-			// Stri..
-			matchEndWidth := displayWidth(text[:maxe])
-			if matchEndWidth <= maxWidth-2 {
-				text, _ = trimRight(text, maxWidth-2)
-				text = append(text, []rune("..")...)
-			} else {
-				// Stri..
-				if matchEndWidth < fullWidth-2 {
-					text = append(text[:maxe], []rune("..")...)
-				}
-				// ..ri..
-				var diff int32
-				text, diff = trimLeft(text, maxWidth-2)
-
-				// Transform offsets
-				for idx, offset := range offsets {
-					b, e := offset.offset[0], offset.offset[1]
-					b += 2 - diff
-					e += 2 - diff
-					b = util.Max32(b, 2)
-					offsets[idx].offset[0] = b
-					offsets[idx].offset[1] = util.Max32(b, e)
-				}
-				text = append([]rune(".."), text...)
-			}
-		} else {
-			text, _ = trimRight(text, maxWidth-2)
-			text = append(text, []rune("..")...)
+	if col1 != C.ColHeader {
+		offsets, col1 = t.highlightFields(item, offsets, col1, current)
+	}
+	text = t.overflow(text, offsets, minb, maxe, maxWidth)
+	t.printColored(text, offsets, col1, bold)
+}
+
+// highlightFields fills the gaps between the offsets in the fields of the
+// search scope of --nth with the color for them, and returns the new offsets
+// along with the color for the rest of the item, which is dimmed
+func (t *Terminal) highlightFields(item *Item, offsets []colorOffset, col1 int, current bool) ([]colorOffset, int) {
+	if !t.nthFields || len(t.nth) == 0 {
+		return offsets, col1
+	}
+	nthCol, dimCol := C.ColNth, C.ColDim
+	if current {
+		nthCol, dimCol = C.ColCurrent, C.ColCurrentDim
+	}
 
-			for idx, offset := range offsets {
-				offsets[idx].offset[0] = util.Min32(offset.offset[0], int32(maxWidth-2))
-				offsets[idx].offset[1] = util.Min32(offset.offset[1], int32(maxWidth))
+	inScope := make([]bool, len(item.text))
+	for _, token := range Transform(Tokenize(item.text, t.delimiter), t.nth) {
+		end := util.Min(token.prefixLength+len(token.text), len(item.text))
+		for i := token.prefixLength; i < end; i++ {
+			inScope[i] = true
+		}
+	}
+	fields := []colorOffset{}
+	fill := func(b int32, e int32) {
+		for i := b; i < e; i++ {
+			if !inScope[i] {
+				continue
+			}
+			if last := len(fields) - 1; last >= 0 && fields[last].color == nthCol && fields[last].offset[1] == i {
+				fields[last].offset[1]++
+			} else {
+				fields = append(fields, colorOffset{offset: [2]int32{i, i + 1}, color: nthCol, bold: current})
 			}
 		}
 	}
+	var index int32
+	maxOffset := int32(len(item.text))
+	for _, offset := range offsets {
+		fill(index, util.Constrain32(offset.offset[0], index, maxOffset))
+		fields = append(fields, offset)
+		index = util.Max32(index, util.Min32(offset.offset[1], maxOffset))
+	}
+	fill(index, maxOffset)
+	return fields, dimCol
+}
 
+// printColored prints the text with the colors at the offsets
+func (t *Terminal) printColored(text []rune, offsets []colorOffset, col1 int, bold bool) {
 	var index int32
 	var substr string
 	var prefixWidth int
@@ -656,6 +1590,7 @@ func (t *Terminal) printAll() {
 	t.printPrompt()
 	t.printInfo()
 	t.printHeader()
+	t.printFooter()
 }
 
 func (t *Terminal) refresh() {
@@ -666,7 +1601,7 @@ func (t *Terminal) refresh() {
 
 func (t *Terminal) delChar() bool {
 	if len(t.input) > 0 && t.cx < len(t.input) {
-		t.input = append(t.input[:t.cx], t.input[t.cx+1:]...)
+		t.input = append(t.input[:t.cx], t.input[nextChar(t.input, t.cx):]...)
 		return true
 	}
 	return false
@@ -681,7 +1616,7 @@ func findLastMatch(pattern string, str string) int {
 	if locs == nil {
 		return -1
 	}
-	return locs[len(locs)-1][0]
+	return utf8.RuneCountInString(str[:locs[len(locs)-1][0]])
 }
 
 func findFirstMatch(pattern string, str string) int {
@@ -693,7 +1628,28 @@ func findFirstMatch(pattern string, str string) int {
 	if loc == nil {
 		return -1
 	}
-	return loc[0]
+	return utf8.RuneCountInString(str[:loc[0]])
+}
+
+// wordPatterns returns the patterns for finding the beginning and the end of
+// a word in the query, and the one for unix-word-rubout. By default, a word
+// consists of alphanumeric characters and unix-word-rubout only stops at
+// whitespace. If the delimiters are given, a word is a run of characters other
+// than whitespace and the delimiters for all of them.
+func wordPatterns(delimiters string) (string, string, string) {
+	if len(delimiters) == 0 {
+		return "[^[:alnum:]][[:alnum:]]", "[[:alnum:]][^[:alnum:]]|(.$)", "\\s\\S"
+	}
+	var class string
+	for _, r := range delimiters {
+		if r < utf8.RuneSelf && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			class += "\\"
+		}
+		class += string(r)
+	}
+	sep := "[\\s" + class + "]"
+	word := "[^\\s" + class + "]"
+	return sep + word, word + sep + "|(.$)", sep + word
 }
 
 func copySlice(slice []rune) []rune {
@@ -706,21 +1662,107 @@ func (t *Terminal) rubout(pattern string) {
 	pcx := t.cx
 	after := t.input[t.cx:]
 	t.cx = findLastMatch(pattern, string(t.input[:t.cx])) + 1
-	t.yanked = copySlice(t.input[t.cx:pcx])
+	t.kill(t.input[t.cx:pcx], true)
 	t.input = append(t.input[:t.cx], after...)
 }
 
+// kill saves the text deleted by the kill command in the kill ring. The text
+// deleted by consecutive kill commands is merged into one entry.
+func (t *Terminal) kill(text []rune, backward bool) {
+	switch t.lastAction {
+	case actUnixLineDiscard, actUnixWordRubout, actBackwardKillWord, actKillWord, actKillLine:
+		t.killRing.kill(text, true, backward)
+	default:
+		t.killRing.kill(text, false, backward)
+	}
+}
+
+// yank inserts the text at the cursor, and remembers where it begins so that
+// yank-pop can replace it
+func (t *Terminal) yank(text []rune) {
+	suffix := copySlice(t.input[t.cx:])
+	t.yankBegin = t.cx
+	t.input = append(append(t.input[:t.cx], text...), suffix...)
+	t.cx += len(text)
+}
+
 func keyMatch(key int, event C.Event) bool {
 	return event.Type == key || event.Type == C.Rune && int(event.Char) == key-C.AltZ
 }
 
+// quoteEntry quotes the entry in single quotes so that the shell does not
+// expand anything in it
 func quoteEntry(entry string) string {
-	return fmt.Sprintf("%q", entry)
+	return shellQuote(entry)
+}
+
+// replacePlaceholder replaces {} in the command template with the current
+// item, {+} with the selected items, or the current item if none is selected,
+// {q} with the query, and {n} with the index of the current item in the
+// input. If multi is set, {} is also replaced with the selected items.
+func (t *Terminal) replacePlaceholder(template string, multi bool) string {
+	current, index := "''", "''"
+	if t.cy >= 0 && t.cy < t.merger.Length() {
+		item := t.merger.Get(t.cy)
+		current = quoteEntry(item.AsString(t.ansi))
+		index = strconv.Itoa(int(item.Index()))
+	}
+	selected := []string{current}
+	if len(t.selected) > 0 {
+		selected = []string{}
+		for _, sel := range t.sortSelected() {
+			selected = append(selected, quoteEntry(*sel.text))
+		}
+	}
+	return placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		switch match {
+		case "{q}":
+			return quoteEntry(string(t.input))
+		case "{n}":
+			return index
+		case "{+}":
+			return strings.Join(selected, " ")
+		}
+		if multi {
+			return strings.Join(selected, " ")
+		}
+		return current
+	})
+}
+
+// commandEnviron returns the environment of the commands run by fzf with the
+// variables describing the state of the finder
+func commandEnviron(query string, selected int, matched int, total int, pos int) []string {
+	return append(os.Environ(),
+		"FZF_QUERY="+query,
+		"FZF_SELECT_COUNT="+strconv.Itoa(selected),
+		"FZF_MATCH_COUNT="+strconv.Itoa(matched),
+		"FZF_TOTAL_COUNT="+strconv.Itoa(total),
+		"FZF_POS="+strconv.Itoa(pos))
+}
+
+// environ returns the environment of the commands run by the terminal. The
+// position of the cursor is 1-based, and 0 if the list is empty.
+func (t *Terminal) environ() []string {
+	pos := 0
+	if t.cy < t.merger.Length() {
+		pos = t.cy + 1
+	}
+	return commandEnviron(string(t.input), len(t.selected), t.merger.Length(), t.count, pos)
 }
 
-func executeCommand(template string, replacement string) {
-	command := strings.Replace(template, "{}", replacement, -1)
+// executeCommand runs the command on the terminal, or in the background
+// without input and output if silent is set. The keys are not read while the
+// command is running on the terminal so that it receives all the input.
+func (t *Terminal) executeCommand(command string, silent bool) {
 	cmd := util.ExecCommand(command)
+	cmd.Env = t.environ()
+	if silent {
+		cmd.Run()
+		return
+	}
+	t.keyMutex.Lock()
+	defer t.keyMutex.Unlock()
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -729,6 +1771,15 @@ func executeCommand(template string, replacement string) {
 	C.Refresh()
 }
 
+// captureOutput runs the command in the background and returns its standard
+// output without the trailing newline
+func captureOutput(command string, env []string) string {
+	cmd := util.ExecCommand(command)
+	cmd.Env = env
+	out, _ := cmd.Output()
+	return strings.TrimSuffix(string(out), "\n")
+}
+
 // Loop is called to start Terminal I/O
 func (t *Terminal) Loop() {
 	<-t.startChan
@@ -745,7 +1796,17 @@ func (t *Terminal) Loop() {
 		go func() {
 			for {
 				<-resizeChan
-				t.reqBox.Set(reqRedraw, nil)
+				for settled := false; !settled; {
+					select {
+					case <-resizeChan:
+					case <-time.After(resizeDebounce):
+						settled = true
+					}
+				}
+				t.reqBox.Set(reqResize, nil)
+				if _, prs := t.keymap[C.Resize]; prs {
+					t.sendEvent(C.Event{Type: C.Resize})
+				}
 			}
 		}()
 
@@ -757,6 +1818,7 @@ func (t *Terminal) Loop() {
 		C.Refresh()
 		t.printInfo()
 		t.printHeader()
+		t.printFooter()
 		t.mutex.Unlock()
 		go func() {
 			timer := time.NewTimer(t.initDelay)
@@ -766,7 +1828,7 @@ func (t *Terminal) Loop() {
 
 		// Keep the spinner spinning
 		go func() {
-			for {
+			for !t.plain {
 				t.mutex.Lock()
 				reading := t.reading
 				t.mutex.Unlock()
@@ -783,7 +1845,7 @@ func (t *Terminal) Loop() {
 		if code <= exitNoMatch && t.history != nil {
 			t.history.append(string(t.input))
 		}
-		os.Exit(code)
+		t.exit(code)
 	}
 
 	go func() {
@@ -795,21 +1857,34 @@ func (t *Terminal) Loop() {
 					switch req {
 					case reqPrompt:
 						t.printPrompt()
-						if t.inlineInfo {
+						if t.info == infoInline {
 							t.printInfo()
 						}
 					case reqInfo:
 						t.printInfo()
+					case reqBell:
+						C.Bell()
 					case reqList:
 						t.printList()
+						if strings.Contains(t.infoFormat, "{current}") {
+							t.printInfo()
+						}
 					case reqHeader:
 						t.printHeader()
+					case reqFooter:
+						t.printFooter()
 					case reqRefresh:
 						t.suppress = false
-					case reqRedraw:
+					case reqRedraw, reqResize:
+						t.clearGraphics()
 						C.Clear()
 						C.Endwin()
 						C.Refresh()
+						if req == reqResize && t.previewer != nil {
+							// The output of the command can depend on the
+							// size of the preview window
+							t.previewer.rerun()
+						}
 						t.printAll()
 					case reqClose:
 						C.Close()
@@ -819,9 +1894,27 @@ func (t *Terminal) Loop() {
 						exit(exitNoMatch)
 					case reqQuit:
 						C.Close()
+						// The query is still printed so that the caller can
+						// tell it from the exit status
+						if t.printQuery {
+							t.printLine(string(t.input))
+						}
 						exit(exitInterrupt)
+					case reqBecome:
+						C.Close()
+						err := util.Become(t.become)
+						fmt.Fprintln(os.Stderr, err)
+						exit(exitError)
+					case reqFail:
+						C.Close()
+						fmt.Fprintln(os.Stderr, t.failure)
+						exit(exitError)
 					}
 				}
+				t.requestPreview()
+				t.printBorder()
+				t.printPreview()
+				t.printSelectedPane()
 				t.placeCursor()
 				t.mutex.Unlock()
 			})
@@ -829,9 +1922,43 @@ func (t *Terminal) Loop() {
 		}
 	}()
 
+	// Keys are read in a separate goroutine so that the events from the other
+	// parts of the program can be processed while waiting for the user input.
+	// The next key is not read until the previous one is processed as the
+	// action may run an external program that reads from the terminal. The
+	// actions triggered by the other events can run a program while waiting
+	// for the key, so the key is only read when no program is running.
+	readKey := make(chan bool)
+	keyChan := make(chan C.Event)
+	go func() {
+		for range readKey {
+			for {
+				C.WaitForInput()
+				t.keyMutex.Lock()
+				if C.HasInput() {
+					event := C.GetChar()
+					t.keyMutex.Unlock()
+					keyChan <- event
+					break
+				}
+				t.keyMutex.Unlock()
+			}
+		}
+	}()
+
 	looping := true
+	waiting := false
 	for looping {
-		event := C.GetChar()
+		if !waiting {
+			readKey <- true
+			waiting = true
+		}
+		var event C.Event
+		select {
+		case event = <-keyChan:
+			waiting = false
+		case event = <-t.eventChan:
+		}
 
 		t.mutex.Lock()
 		previousInput := t.input
@@ -839,13 +1966,16 @@ func (t *Terminal) Loop() {
 		req := func(evts ...util.EventType) {
 			for _, event := range evts {
 				events = append(events, event)
-				if event == reqClose || event == reqQuit {
+				if event == reqClose || event == reqQuit || event == reqBecome {
 					looping = false
 				}
 			}
 		}
 		selectItem := func(item *Item) bool {
 			if _, found := t.selected[item.Index()]; !found {
+				if t.multiMax > 0 && len(t.selected) >= t.multiMax {
+					return false
+				}
 				t.selected[item.Index()] = selectedItem{time.Now(), item.StringPtr(t.ansi)}
 				return true
 			}
@@ -853,8 +1983,10 @@ func (t *Terminal) Loop() {
 		}
 		toggleY := func(y int) {
 			item := t.merger.Get(y)
-			if !selectItem(item) {
+			if _, found := t.selected[item.Index()]; found {
 				delete(t.selected, item.Index())
+			} else {
+				selectItem(item)
 			}
 		}
 		toggle := func() {
@@ -863,32 +1995,92 @@ func (t *Terminal) Loop() {
 				req(reqInfo)
 			}
 		}
-		for key, ret := range t.expect {
-			if keyMatch(key, event) {
-				t.pressed = ret
-				req(reqClose)
-				break
+		// In jump mode, the next key chooses the line with the label, and any
+		// other key cancels it. The events not from the keyboard are ignored.
+		jumping := t.jumping != jumpDisabled && (event.Type < C.Change || event.Type > C.Zero)
+		if jumping {
+			if event.Type == C.Rune {
+				idx := -1
+				for i, label := range t.jumpLabels {
+					if label == event.Char {
+						idx = i
+						break
+					}
+				}
+				if idx >= 0 && idx < t.listed {
+					t.cy = idx + t.offset
+					if t.jumping == jumpAcceptEnabled {
+						req(reqClose)
+					}
+				}
+			}
+			t.jumping = jumpDisabled
+			req(reqList)
+		} else {
+			for key, ret := range t.expect {
+				if keyMatch(key, event) {
+					t.pressed = ret
+					req(reqClose)
+					break
+				}
 			}
 		}
 
-		var doAction func(actionType, int) bool
-		doAction = func(action actionType, mapkey int) bool {
-			switch action {
+		var doAction func(action) bool
+		doActions := func(actions []action) bool {
+			for _, a := range actions {
+				if !doAction(a) {
+					return false
+				}
+				t.lastAction = a.t
+			}
+			return true
+		}
+		doAction = func(a action) bool {
+			if t.selFocus && t.selectedPaneAction(a.t) {
+				req(reqList, reqInfo)
+				return true
+			}
+			switch a.t {
 			case actIgnore:
-			case actExecute:
+			case actExecute, actExecuteSilent:
 				if t.cy >= 0 && t.cy < t.merger.Length() {
-					item := t.merger.Get(t.cy)
-					executeCommand(t.execmap[mapkey], quoteEntry(item.AsString(t.ansi)))
+					silent := a.t == actExecuteSilent
+					t.executeCommand(t.replacePlaceholder(a.a, false), silent)
+					if !silent && !t.fullscreen {
+						// The lines were cleared to run the command
+						req(reqRedraw)
+					}
+				}
+			case actBecome:
+				t.become = t.replacePlaceholder(a.a, false)
+				req(reqBecome)
+			case actTransform:
+				// The output is a list of actions. Invalid ones are ignored.
+				output := captureOutput(t.replacePlaceholder(a.a, false), t.environ())
+				if actions, err := parseActionList(output); err == nil && len(output) > 0 {
+					return doActions(actions)
 				}
+			case actTransformQuery:
+				t.input = []rune(captureOutput(t.replacePlaceholder(a.a, false), t.environ()))
+				t.cx = len(t.input)
+			case actTransformPrompt:
+				t.prompt = captureOutput(t.replacePlaceholder(a.a, false), t.environ())
+			case actChangeHeader, actTransformHeader:
+				header := a.a
+				if a.t == actTransformHeader {
+					header = captureOutput(t.replacePlaceholder(a.a, false), t.environ())
+				}
+				t.changeHeader(header)
+				req(reqList, reqInfo, reqHeader, reqFooter)
 			case actExecuteMulti:
 				if len(t.selected) > 0 {
-					sels := make([]string, len(t.selected))
-					for i, sel := range t.sortSelected() {
-						sels[i] = quoteEntry(*sel.text)
+					t.executeCommand(t.replacePlaceholder(a.a, true), false)
+					if !t.fullscreen {
+						req(reqRedraw)
 					}
-					executeCommand(t.execmap[mapkey], strings.Join(sels, " "))
 				} else {
-					return doAction(actExecute, mapkey)
+					return doAction(action{t: actExecute, a: a.a})
 				}
 			case actInvalid:
 				t.mutex.Unlock()
@@ -896,14 +2088,125 @@ func (t *Terminal) Loop() {
 			case actToggleSort:
 				t.sort = !t.sort
 				t.eventBox.Set(EvtSearchNew, t.sort)
-				t.mutex.Unlock()
-				return false
+				req(reqInfo)
+			case actReload, actReloadSync:
+				command := ""
+				if len(a.a) > 0 {
+					command = t.replacePlaceholder(a.a, false)
+				}
+				t.eventBox.Set(EvtReload, reloadRequest{command, a.t == actReloadSync, false, t.environ()})
+			case actAppend:
+				command := t.replacePlaceholder(a.a, false)
+				t.eventBox.Set(EvtReload, reloadRequest{command, false, true, t.environ()})
+			case actTogglePreview:
+				if t.previewer != nil {
+					t.preview.hidden = !t.preview.hidden
+					req(reqRedraw)
+				}
+			case actToggleTrack:
+				t.track = !t.track
+			case actToggleCollapse:
+				t.toggleCollapse()
+				req(reqList)
+			case actToggleSelectedPane:
+				if t.toggleSelectedPane() {
+					req(reqRedraw)
+				}
+			case actFocusSelectedPane:
+				t.focusSelectedPane()
+			case actToggleWrap:
+				t.wrap = !t.wrap
+				req(reqList)
+			case actChangeBorderLabel:
+				t.borderLabel.label = a.a
+			case actChangePreviewLabel:
+				t.preview.label.label = a.a
+			case actChangeFooter:
+				t.footer = footerLines(a.a)
+				req(reqList, reqFooter)
+			case actChangePrompt:
+				t.prompt = a.a
+			case actChangePreview:
+				if t.changePreview(a.a) {
+					req(reqRedraw)
+				} else {
+					req(reqPreview)
+				}
+			case actChangePreviewWindow:
+				t.changePreviewWindow(a.a)
+				if t.previewer != nil {
+					req(reqRedraw)
+				}
+			case actGrowPreview, actShrinkPreview:
+				if t.hasPreviewWindow() {
+					step := util.Max(t.previewSpan*previewResizeStep/100, 1)
+					if a.t == actShrinkPreview {
+						step = -step
+					}
+					if t.resizePreview(t.previewLength() + step) {
+						req(reqRedraw)
+					}
+				}
+			case actCopy:
+				if t.cy >= 0 && t.cy < t.merger.Length() {
+					t.copyToClipboard(t.merger.Get(t.cy).AsString(t.ansi))
+				}
+			case actCopySelected:
+				if len(t.selected) > 0 {
+					lines := []string{}
+					for _, sel := range t.sortSelected() {
+						lines = append(lines, *sel.text)
+					}
+					t.copyToClipboard(strings.Join(lines, "\n"))
+				} else {
+					return doAction(action{t: actCopy})
+				}
+			case actCopyQuery:
+				t.copyToClipboard(string(t.input))
+			case actTogglePreviewFollow:
+				if t.previewer != nil {
+					t.previewer.toggleFollow()
+					req(reqPreview)
+				}
+			case actPreviewUp, actPreviewDown, actPreviewPageUp, actPreviewPageDown,
+				actPreviewHalfPageUp, actPreviewHalfPageDown:
+				if t.hasPreviewWindow() {
+					area, _ := t.previewTextArea()
+					diff := 1
+					switch a.t {
+					case actPreviewPageUp, actPreviewPageDown:
+						diff = util.Max(1, area.height)
+					case actPreviewHalfPageUp, actPreviewHalfPageDown:
+						diff = util.Max(1, area.height/2)
+					}
+					switch a.t {
+					case actPreviewUp, actPreviewPageUp, actPreviewHalfPageUp:
+						diff = -diff
+					}
+					if t.previewer.scroll(diff, false, area.height) {
+						req(reqPreview)
+					}
+				}
+			case actToggleThrottle:
+				if t.throttle > 0 {
+					t.throttle = 0
+				} else {
+					t.throttle = t.throttleTo
+				}
+				t.eventBox.Set(EvtThrottle, t.throttle)
 			case actBeginningOfLine:
 				t.cx = 0
+			case actJump:
+				t.jumping = jumpEnabled
+				req(reqList)
+			case actJumpAccept:
+				t.jumping = jumpAcceptEnabled
+				req(reqList)
+			case actClearQuery:
+				t.input = []rune{}
+				t.cx = 0
 			case actBackwardChar:
-				if t.cx > 0 {
-					t.cx--
-				}
+				t.cx = prevChar(t.input, t.cx)
 			case actAbort:
 				req(reqQuit)
 			case actDeleteChar:
@@ -918,18 +2221,17 @@ func (t *Terminal) Loop() {
 				if len(t.input) == 0 {
 					req(reqQuit)
 				} else {
-					t.yanked = t.input
+					t.killRing.kill(t.input, false, false)
 					t.input = []rune{}
 					t.cx = 0
 				}
 			case actForwardChar:
-				if t.cx < len(t.input) {
-					t.cx++
-				}
+				t.cx = nextChar(t.input, t.cx)
 			case actBackwardDeleteChar:
 				if t.cx > 0 {
-					t.input = append(t.input[:t.cx-1], t.input[t.cx:]...)
-					t.cx--
+					cx := prevChar(t.input, t.cx)
+					t.input = append(t.input[:cx], t.input[t.cx:]...)
+					t.cx = cx
 				}
 			case actSelectAll:
 				if t.multi {
@@ -960,15 +2262,15 @@ func (t *Terminal) Loop() {
 					req(reqList, reqInfo)
 				}
 			case actToggleIn:
-				if t.reverse {
-					return doAction(actToggleUp, mapkey)
+				if t.layout != layoutDefault {
+					return doAction(action{t: actToggleUp})
 				}
-				return doAction(actToggleDown, mapkey)
+				return doAction(action{t: actToggleDown})
 			case actToggleOut:
-				if t.reverse {
-					return doAction(actToggleDown, mapkey)
+				if t.layout != layoutDefault {
+					return doAction(action{t: actToggleDown})
 				}
-				return doAction(actToggleUp, mapkey)
+				return doAction(action{t: actToggleUp})
 			case actToggleDown:
 				if t.multi && t.merger.Length() > 0 {
 					toggle()
@@ -989,26 +2291,37 @@ func (t *Terminal) Loop() {
 				req(reqList)
 			case actAccept:
 				req(reqClose)
+			case actAcceptNonEmpty:
+				if len(t.selected) > 0 || t.cy >= 0 && t.cy < t.merger.Length() {
+					req(reqClose)
+				}
+			case actPrint:
+				t.printQueue = append(t.printQueue, a.a)
 			case actClearScreen:
 				req(reqRedraw)
 			case actUnixLineDiscard:
 				if t.cx > 0 {
-					t.yanked = copySlice(t.input[:t.cx])
+					t.kill(t.input[:t.cx], true)
 					t.input = t.input[t.cx:]
 					t.cx = 0
 				}
 			case actUnixWordRubout:
 				if t.cx > 0 {
-					t.rubout("\\s\\S")
+					t.rubout(t.wordRubout)
 				}
 			case actBackwardKillWord:
 				if t.cx > 0 {
-					t.rubout("[^[:alnum:]][[:alnum:]]")
+					t.rubout(t.wordPrev)
 				}
 			case actYank:
-				suffix := copySlice(t.input[t.cx:])
-				t.input = append(append(t.input[:t.cx], t.yanked...), suffix...)
-				t.cx += len(t.yanked)
+				t.yank(t.killRing.yank())
+			case actYankPop:
+				// Replace the text just yanked with the previous entry
+				if t.lastAction == actYank || t.lastAction == actYankPop {
+					t.input = append(t.input[:t.yankBegin], t.input[t.cx:]...)
+					t.cx = t.yankBegin
+					t.yank(t.killRing.rotate())
+				}
 			case actPageUp:
 				t.vmove(t.maxItems() - 1)
 				req(reqList)
@@ -1016,19 +2329,18 @@ func (t *Terminal) Loop() {
 				t.vmove(-(t.maxItems() - 1))
 				req(reqList)
 			case actBackwardWord:
-				t.cx = findLastMatch("[^[:alnum:]][[:alnum:]]", string(t.input[:t.cx])) + 1
+				t.cx = findLastMatch(t.wordPrev, string(t.input[:t.cx])) + 1
 			case actForwardWord:
-				t.cx += findFirstMatch("[[:alnum:]][^[:alnum:]]|(.$)", string(t.input[t.cx:])) + 1
+				t.cx += findFirstMatch(t.wordNext, string(t.input[t.cx:])) + 1
 			case actKillWord:
-				ncx := t.cx +
-					findFirstMatch("[[:alnum:]][^[:alnum:]]|(.$)", string(t.input[t.cx:])) + 1
+				ncx := t.cx + findFirstMatch(t.wordNext, string(t.input[t.cx:])) + 1
 				if ncx > t.cx {
-					t.yanked = copySlice(t.input[t.cx:ncx])
+					t.kill(t.input[t.cx:ncx], false)
 					t.input = append(t.input[:t.cx], t.input[ncx:]...)
 				}
 			case actKillLine:
 				if t.cx < len(t.input) {
-					t.yanked = copySlice(t.input[t.cx:])
+					t.kill(t.input[t.cx:], false)
 					t.input = t.input[:t.cx]
 				}
 			case actRune:
@@ -1050,7 +2362,23 @@ func (t *Terminal) Loop() {
 			case actMouse:
 				me := event.MouseEvent
 				mx, my := me.X, me.Y
-				if me.S != 0 {
+				if t.previewDrag != nil && me.S == 0 && !me.Down {
+					// The border of the preview window is released after
+					// being dragged, otherwise it is a click on it
+					start := t.previewDrag
+					t.previewDrag = nil
+					if t.dragPreview(my, mx) {
+						req(reqRedraw)
+					} else if t.hasPreviewWindow() && t.clickPreview(start.Y, start.X) {
+						req(reqPreview)
+					}
+				} else if me.S != 0 && t.inPreviewArea(my, mx) {
+					// Scroll the preview window
+					area, _ := t.previewTextArea()
+					if t.previewer.scroll(-me.S, false, area.height) {
+						req(reqPreview)
+					}
+				} else if me.S != 0 {
 					// Scroll
 					if t.merger.Length() > 0 {
 						if t.multi && me.Mod {
@@ -1059,57 +2387,114 @@ func (t *Terminal) Loop() {
 						t.vmove(me.S)
 						req(reqList)
 					}
+				} else if t.inPreviewArea(my, mx) {
+					if me.Down && t.onPreviewBorder(my, mx) {
+						t.previewDrag = me
+					}
+				} else if t.inSelectedPaneArea(my, mx) {
+					if me.Down && t.clickSelectedPane(my) {
+						req(reqList, reqInfo)
+					}
 				} else if mx >= t.marginInt[3] && mx < C.MaxX()-t.marginInt[1] &&
 					my >= t.marginInt[0] && my < C.MaxY()-t.marginInt[2] {
 					mx -= t.marginInt[3]
 					my -= t.marginInt[0]
-					mx = util.Constrain(mx-displayWidth([]rune(t.prompt)), 0, len(t.input))
-					if !t.reverse {
+					mx = t.inputIndex(mx - displayWidth([]rune(t.prompt)))
+					if t.layout != layoutReverse {
 						my = t.maxHeight() - my - 1
 					}
 					min := 2 + len(t.header)
-					if t.inlineInfo {
+					if t.noInfoLine() {
 						min--
 					}
+					// Index of the item on the line in the list
+					row := my - min
+					inList := my >= min && row < t.maxItems()
+					inHeader := my >= min-len(t.header) && my < min
+					if t.headerFirst {
+						inHeader = my < len(t.header)
+					}
+					if t.layout == layoutReverseList {
+						row = t.maxItems() - 1 - row
+					}
+					idx := t.offset + row
+					if t.wrap && row >= 0 && row < len(t.rowItems) {
+						idx = t.rowItems[row]
+					}
 					if me.Double {
 						// Double-click
-						if my >= min {
-							if t.vset(t.offset+my-min) && t.cy < t.merger.Length() {
-								return doAction(t.keymap[C.DoubleClick], C.DoubleClick)
+						if inList {
+							if t.vset(idx) && t.cy < t.merger.Length() {
+								return doActions(t.keymap[C.DoubleClick])
 							}
+						} else if inHeader {
+							return doActions(t.keymap[C.DoubleClickHeader])
 						}
 					} else if me.Down {
-						if my == 0 && mx >= 0 {
+						if my == t.promptLine() && mx >= 0 {
 							// Prompt
 							t.cx = mx
-						} else if my >= min {
+						} else if inList {
 							// List
-							if t.vset(t.offset+my-min) && t.multi && me.Mod {
-								toggle()
-							}
 							req(reqList)
+							if t.vset(idx) {
+								if t.multi && me.Mod {
+									toggle()
+								}
+								return doActions(t.keymap[C.Click])
+							}
+						} else if inHeader {
+							return doActions(t.keymap[C.ClickHeader])
 						}
 					}
+				} else if t.inBorderArea(my, mx) {
+					if me.Double {
+						return doActions(t.keymap[C.DoubleClickBorder])
+					} else if me.Down {
+						return doActions(t.keymap[C.ClickBorder])
+					}
 				}
 			}
 			return true
 		}
-		action := t.keymap[event.Type]
-		mapkey := event.Type
-		if event.Type == C.Rune {
-			mapkey = int(event.Char) + int(C.AltZ)
-			if act, prs := t.keymap[mapkey]; prs {
-				action = act
+		var actions []action
+		switch {
+		case jumping:
+		case event.Type == C.Focus:
+			// The list is updated, the current item is checked below
+		case event.Type == C.Paste:
+			t.paste(C.PastedText())
+		case t.vi && t.viNormal && event.Type == C.Rune:
+			t.lastAction = actIgnore
+			actions = t.viCommand(event.Char)
+		case t.vi && !t.viNormal && event.Type == C.ESC:
+			t.lastAction = actIgnore
+			t.viEscape()
+		case event.Type == C.Rune:
+			actions = t.keymap[C.Rune]
+			if acts, prs := t.keymap[int(event.Char)+int(C.AltZ)]; prs {
+				actions = acts
 			}
+		default:
+			actions = t.keymap[event.Type]
+		}
+		if !doActions(actions) {
+			continue
+		}
+		t.viConstrain()
+		if string(previousInput) != string(t.input) && !doActions(t.keymap[C.Change]) {
+			continue
 		}
-		if !doAction(action, mapkey) {
+		if t.focusChanged() && !doActions(t.keymap[C.Focus]) {
 			continue
 		}
-		changed := string(previousInput) != string(t.input)
+		query := string(t.input)
+		changed := string(previousInput) != query
 		t.mutex.Unlock() // Must be unlocked before touching reqBox
 
 		if changed {
 			t.eventBox.Set(EvtSearchNew, t.sort)
+			t.eventBox.Set(EvtQueryChange, query)
 		}
 		for _, event := range events {
 			t.reqBox.Set(event, nil)
@@ -1118,22 +2503,45 @@ func (t *Terminal) Loop() {
 }
 
 func (t *Terminal) constrain() {
+	t.constrainHeight(t.maxItems())
+}
+
+// constrainHeight keeps the cursor and the offset within a list of the given
+// height
+func (t *Terminal) constrainHeight(height int) {
 	count := t.merger.Length()
-	height := t.maxItems()
 	diffpos := t.cy - t.offset
 
+	// Lines to keep visible above and below the cursor
+	scrollOff := util.Min(t.scrollOff, (height-1)/2)
+
 	t.cy = util.Constrain(t.cy, 0, count-1)
-	t.offset = util.Constrain(t.offset, t.cy-height+1, t.cy)
+	t.offset = util.Constrain(t.offset, t.cy-height+1+scrollOff, t.cy-scrollOff)
 	// Adjustment
 	if count-t.offset < height {
 		t.offset = util.Max(0, count-height)
 		t.cy = util.Constrain(t.offset+diffpos, 0, count-1)
 	}
 	t.offset = util.Max(0, t.offset)
+
+	if t.wrap {
+		// Scroll down until the current item is not cut off
+		for t.offset < t.cy {
+			rows := 0
+			for idx := t.offset; idx <= t.cy; idx++ {
+				rows += len(t.wrapItem(t.displayItem(t.merger.Get(idx))))
+			}
+			if rows <= height {
+				break
+			}
+			t.offset++
+		}
+	}
 }
 
 func (t *Terminal) vmove(o int) {
-	if t.reverse {
+	// The list flows downward except in the default layout
+	if t.layout != layoutDefault {
 		o *= -1
 	}
 	dest := t.cy + o
@@ -1158,8 +2566,8 @@ func (t *Terminal) vset(o int) bool {
 }
 
 func (t *Terminal) maxItems() int {
-	max := t.maxHeight() - 2 - len(t.header)
-	if t.inlineInfo {
+	max := t.maxHeight() - 2 - len(t.header) - len(t.footer)
+	if t.noInfoLine() {
 		max++
 	}
 	return util.Max(max, 0)
@@ -0,0 +1,444 @@
+package fzf
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	C "github.com/junegunn/fzf/src/curses"
+	"github.com/junegunn/fzf/src/util"
+)
+
+func TestOverflow(t *testing.T) {
+	check := func(term *Terminal, text string, maxe int, begin int32, expected string, expectedBegin int32) {
+		offsets := []colorOffset{colorOffset{offset: [2]int32{begin, int32(maxe)}}}
+		result := string(term.overflow([]rune(text), offsets, int(begin), maxe, 10))
+		if result != expected || offsets[0].offset[0] != expectedBegin {
+			t.Errorf("%q: %q %v (expected: %q %d)", text, result, offsets[0].offset, expected, expectedBegin)
+		}
+	}
+	hscroll := &Terminal{hscroll: true, hscrollOff: 2, ellipsis: []rune("..")}
+	check(hscroll, "0123456789", 10, 8, "0123456789", 8)
+	check(hscroll, "0123456789abcdef", 3, 1, "01234567..", 1)
+	check(hscroll, "0123456789abcdef", 10, 8, "..6789ab..", 4)
+	check(hscroll, "0123456789abcdef", 16, 14, "..89abcdef", 8)
+
+	// hscroll-off is the number of screen columns
+	check(hscroll, "0123456789가나다라", 10, 8, "..6789가..", 4)
+
+	truncate := &Terminal{hscroll: false, ellipsis: []rune("..")}
+	check(truncate, "0123456789abcdef", 10, 8, "01234567..", 8)
+
+	// The end of the line is displayed unless the match is hidden
+	keepRight := &Terminal{hscroll: true, hscrollOff: 2, keepRight: true, ellipsis: []rune("..")}
+	check(keepRight, "0123456789abcdef", 12, 10, "..89abcdef", 4)
+	check(keepRight, "0123456789abcdef", 3, 1, "01234567..", 1)
+	keepRight.hscroll = false
+	check(keepRight, "0123456789abcdef", 3, 1, "..89abcdef", 2)
+
+	ellipsis := &Terminal{hscroll: true, hscrollOff: 2, ellipsis: []rune("…")}
+	check(ellipsis, "0123456789abcdef", 3, 1, "012345678…", 1)
+	check(ellipsis, "0123456789abcdef", 16, 14, "…789abcdef", 8)
+	ellipsis.ellipsis = []rune{}
+	check(ellipsis, "0123456789abcdef", 3, 1, "0123456789", 1)
+}
+
+func TestReplacePlaceholder(t *testing.T) {
+	items := []*Item{&Item{text: []rune("foo bar")}, &Item{text: []rune("baz")}}
+	term := &Terminal{
+		input:    []rune("qu ery"),
+		merger:   NewMerger([][]*Item{items}, false, false),
+		selected: make(map[int32]selectedItem)}
+	check := func(template string, multi bool, expected string) {
+		if result := term.replacePlaceholder(template, multi); result != expected {
+			t.Errorf("%q: %q (expected: %q)", template, result, expected)
+		}
+	}
+	check("echo {} {+} {q}", false, `echo 'foo bar' 'foo bar' 'qu ery'`)
+
+	baz := "baz"
+	term.selected[1] = selectedItem{time.Now(), &baz}
+	check("echo {} {+}", false, `echo 'foo bar' 'baz'`)
+	check("echo {}", true, `echo 'baz'`)
+
+	// The shell does not expand anything in the items or the query
+	for _, str := range []string{"$(echo x)", "`echo x`", "it's", "'$HOME'\\"} {
+		term.merger = NewMerger([][]*Item{{&Item{text: []rune(str)}}}, false, false)
+		term.selected = make(map[int32]selectedItem)
+		term.input = []rune(str)
+		for _, template := range []string{"printf %s {}", "printf %s {+}", "printf %s {q}"} {
+			out, err := util.ExecCommand(term.replacePlaceholder(template, false)).Output()
+			if err != nil || string(out) != str {
+				t.Errorf("%s with %q: %q (%v)", template, str, out, err)
+			}
+		}
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	items := []*Item{&Item{text: []rune("foo")}, &Item{text: []rune("bar")}}
+	term := &Terminal{
+		input:    []rune("qu ery"),
+		merger:   NewMerger([][]*Item{items}, false, false),
+		count:    5,
+		cy:       1,
+		selected: map[int32]selectedItem{3: selectedItem{}}}
+	check := func(expected ...string) {
+		env := term.environ()
+		if vars := env[len(env)-len(expected):]; !reflect.DeepEqual(vars, expected) {
+			t.Errorf("%q (expected: %q)", vars, expected)
+		}
+	}
+	check("FZF_QUERY=qu ery", "FZF_SELECT_COUNT=1", "FZF_MATCH_COUNT=2", "FZF_TOTAL_COUNT=5", "FZF_POS=2")
+
+	term.merger = EmptyMerger
+	term.cy = 0
+	check("FZF_QUERY=qu ery", "FZF_SELECT_COUNT=1", "FZF_MATCH_COUNT=0", "FZF_TOTAL_COUNT=5", "FZF_POS=0")
+}
+
+func TestCycle(t *testing.T) {
+	items := []*Item{&Item{text: []rune("a")}, &Item{text: []rune("b")}, &Item{text: []rune("c")}}
+	term := &Terminal{merger: NewMerger([][]*Item{items}, false, false)}
+	check := func(o int, expected int) {
+		term.vmove(o)
+		if term.cy != expected {
+			t.Errorf("vmove(%d): %d (expected: %d)", o, term.cy, expected)
+		}
+	}
+	check(-1, 0)
+	check(5, 2)
+	check(1, 2)
+
+	// Moving past the end wraps around only from the last item
+	term.cycle = true
+	check(1, 0)
+	check(-1, 2)
+	check(-5, 0)
+	check(-1, 2)
+}
+
+func TestScrollOffMove(t *testing.T) {
+	items := []*Item{}
+	for i := 0; i < 20; i++ {
+		items = append(items, &Item{text: []rune(strconv.Itoa(i))})
+	}
+	term := &Terminal{merger: NewMerger([][]*Item{items}, false, false), scrollOff: 2}
+	check := func(o int, cy int, offset int) {
+		term.vmove(o)
+		term.constrainHeight(10)
+		if term.cy != cy || term.offset != offset {
+			t.Errorf("vmove(%d): %d %d (expected: %d %d)", o, term.cy, term.offset, cy, offset)
+		}
+	}
+	check(7, 7, 0)
+	// Two lines are kept visible below the cursor
+	check(1, 8, 1)
+	check(3, 11, 4)
+	// and above it
+	check(-4, 7, 4)
+	check(-2, 5, 3)
+	// except at both ends of the list
+	check(-5, 0, 0)
+	check(19, 19, 10)
+
+	// scroll-off is limited to half of the height
+	term.scrollOff = 10
+	check(-8, 11, 7)
+	check(4, 15, 10)
+}
+
+func TestTrackItem(t *testing.T) {
+	items := []*Item{}
+	for i, str := range []string{"a", "b", "c", "d"} {
+		items = append(items, &Item{text: []rune(str), rank: buildEmptyRank(int32(i))})
+	}
+	term := &Terminal{merger: NewMerger([][]*Item{items}, false, false), cy: 1}
+	term.trackItem(NewMerger([][]*Item{{items[3], items[1], items[0]}}, false, false))
+	if term.cy != 1 {
+		t.Errorf("%d", term.cy)
+	}
+	term.trackItem(NewMerger([][]*Item{{items[2], items[0], items[1]}}, false, false))
+	if term.cy != 2 {
+		t.Errorf("%d", term.cy)
+	}
+
+	// The cursor stays if the item is gone
+	term.cy = 3
+	term.trackItem(NewMerger([][]*Item{{items[0], items[1]}}, false, false))
+	if term.cy != 3 {
+		t.Errorf("%d", term.cy)
+	}
+}
+
+func TestChangeHeader(t *testing.T) {
+	// The lines are in the order from the prompt
+	term := &Terminal{header0: []string{"b", "a"}, header: []string{"b", "a", "line"}}
+	term.changeHeader("c\nd\ne")
+	if !reflect.DeepEqual(term.header, []string{"e", "d", "c", "line"}) ||
+		!reflect.DeepEqual(term.header0, []string{"e", "d", "c"}) {
+		t.Errorf("%q %q", term.header, term.header0)
+	}
+	term.layout = layoutReverse
+	term.changeHeader("f\ng")
+	if !reflect.DeepEqual(term.header, []string{"f", "g", "line"}) {
+		t.Errorf("%q", term.header)
+	}
+	term.changeHeader("")
+	if !reflect.DeepEqual(term.header, []string{"line"}) || len(term.header0) > 0 {
+		t.Errorf("%q %q", term.header, term.header0)
+	}
+}
+
+func TestHighlightFields(t *testing.T) {
+	item := &Item{text: []rune("foo bar baz")}
+	term := &Terminal{nth: splitNth("2"), nthFields: true}
+	offsets := []colorOffset{colorOffset{offset: [2]int32{5, 6}, color: C.ColMatch}}
+	result, col1 := term.highlightFields(item, offsets, 0, false)
+	expected := []colorOffset{
+		colorOffset{offset: [2]int32{4, 5}, color: C.ColNth},
+		colorOffset{offset: [2]int32{5, 6}, color: C.ColMatch},
+		colorOffset{offset: [2]int32{6, 8}, color: C.ColNth}}
+	if col1 != C.ColDim || !reflect.DeepEqual(result, expected) {
+		t.Errorf("%v %d (expected: %v %d)", result, col1, expected, C.ColDim)
+	}
+
+	result, col1 = term.highlightFields(item, nil, C.ColCurrent, true)
+	expected = []colorOffset{colorOffset{offset: [2]int32{4, 8}, color: C.ColCurrent, bold: true}}
+	if col1 != C.ColCurrentDim || !reflect.DeepEqual(result, expected) {
+		t.Errorf("%v %d (expected: %v %d)", result, col1, expected, C.ColCurrentDim)
+	}
+
+	// Without the option, the item is printed as usual
+	term.nthFields = false
+	if result, col1 = term.highlightFields(item, offsets, 0, false); col1 != 0 || len(result) != 1 {
+		t.Errorf("%v %d", result, col1)
+	}
+}
+
+func TestMakeSpinner(t *testing.T) {
+	if frames := makeSpinner(`-\|/`); !reflect.DeepEqual(frames, []string{`-`, `\`, `|`, `/`}) {
+		t.Errorf("%q", frames)
+	}
+	// Frames are padded to the same width
+	if frames := makeSpinner("◐.◓"); !reflect.DeepEqual(frames, []string{"◐", ".", "◓"}) {
+		t.Errorf("%q", frames)
+	}
+	if frames := makeSpinner("가.나"); !reflect.DeepEqual(frames, []string{"가", ". ", "나"}) {
+		t.Errorf("%q", frames)
+	}
+}
+
+func TestLabelColumn(t *testing.T) {
+	check := func(offset int, width int, expected int) {
+		if col := labelColumn(offset, width, 20); col != expected {
+			t.Errorf("labelColumn(%d, %d): %d (expected: %d)", offset, width, col, expected)
+		}
+	}
+	check(0, 6, 7)
+	check(0, 7, 6)
+	check(1, 6, 0)
+	check(3, 6, 2)
+	check(18, 6, 14)
+	check(-1, 6, 14)
+	check(-3, 6, 12)
+	check(-18, 6, 0)
+	check(0, 20, 0)
+	check(5, 20, 0)
+	check(-5, 20, 0)
+}
+
+func TestFormatInfo(t *testing.T) {
+	format := "{current}/{matched} ({total}) [{selected}] {progress}% {unknown}"
+	if output := formatInfo(format, 10, 100, 2, 3, 50); output != "3/10 (100) [2] 50% {unknown}" {
+		t.Errorf("%q", output)
+	}
+	if output := formatInfo("{matched}{matched}", 1, 0, 0, 0, 0); output != "11" {
+		t.Errorf("%q", output)
+	}
+}
+
+func TestWordPatterns(t *testing.T) {
+	check := func(pattern string, last bool, str string, expected int) {
+		var result int
+		if last {
+			result = findLastMatch(pattern, str) + 1
+		} else {
+			result = findFirstMatch(pattern, str) + 1
+		}
+		if result != expected {
+			t.Errorf("%q on %q: %d (expected: %d)", pattern, str, result, expected)
+		}
+	}
+	prev, next, rubout := wordPatterns("")
+	check(prev, true, "~/src/my-proj.go", 14)
+	check(rubout, true, "~/src/my-proj.go", 0)
+	check(rubout, true, "가나 다라", 3)
+	check(next, false, "my-proj", 2)
+
+	// Whitespace and the delimiters separate words
+	prev, next, rubout = wordPatterns("/-.")
+	check(prev, true, "~/src/my-proj.go", 14)
+	check(rubout, true, "~/src/my_proj.go", 14)
+	check(rubout, true, "~/src/my_proj.go ", 14)
+	check(rubout, true, "foo ~/src", 6)
+	check(next, false, "my_proj.go", 7)
+	check(next, false, "src/", 3)
+}
+
+func TestViCommand(t *testing.T) {
+	check := func(query string, cx int, keys string, expected string, expectedCx int, normal bool) {
+		term := &Terminal{input: []rune(query), cx: cx, vi: true, viNormal: true, killRing: NewKillRing(killRingMax)}
+		term.wordPrev, term.wordNext, term.wordRubout = wordPatterns("")
+		for _, r := range keys {
+			if term.viNormal {
+				term.viCommand(r)
+			} else {
+				term.input = append(term.input[:term.cx], append([]rune{r}, term.input[term.cx:]...)...)
+				term.cx++
+			}
+		}
+		if string(term.input) != expected || term.cx != expectedCx || term.viNormal != normal {
+			t.Errorf("%q %q: %q %d %v (expected: %q %d %v)",
+				query, keys, string(term.input), term.cx, term.viNormal, expected, expectedCx, normal)
+		}
+	}
+	check("foo bar", 0, "w", "foo bar", 4, true)
+	check("foo bar", 6, "b", "foo bar", 4, true)
+	check("foo bar", 0, "e", "foo bar", 2, true)
+	check("foo bar", 2, "e", "foo bar", 6, true)
+	check("foo bar", 0, "$", "foo bar", 6, true)
+	check("foo bar", 6, "0l", "foo bar", 1, true)
+	check("foo bar", 0, "dw", "bar", 0, true)
+	check("foo bar", 0, "cwbaz", "baz bar", 3, false)
+	check("foo bar", 4, "db", "bar", 0, true)
+	check("foo bar", 4, "D", "foo ", 3, true)
+	check("foo bar", 4, "dd", "", 0, true)
+	check("foo bar", 0, "xp", "ofo bar", 1, true)
+	check("foo bar", 0, "Abaz", "foo barbaz", 10, false)
+	check("foo bar", 3, "d$p", "foo bar", 6, true)
+	check("foo bar", 3, "d$P", "fo baro", 5, true)
+
+	// Unknown motion cancels the command
+	check("foo bar", 0, "dzx", "oo bar", 0, true)
+}
+
+func TestCombiningInput(t *testing.T) {
+	// "e" with the combining acute accent, followed by a wide character
+	input := []rune("ae\u0301한b")
+	if w := displayWidth(input); w != 5 {
+		t.Errorf("wrong display width: %d", w)
+	}
+	for _, c := range [][3]int{{0, 0, 1}, {1, 0, 3}, {3, 1, 4}, {4, 3, 5}, {5, 4, 5}} {
+		if prev, next := prevChar(input, c[0]), nextChar(input, c[0]); prev != c[1] || next != c[2] {
+			t.Errorf("%d: %d %d (expected: %d %d)", c[0], prev, next, c[1], c[2])
+		}
+	}
+	term := Terminal{input: input}
+	for col, idx := range []int{0, 1, 3, 3, 4, 5, 5} {
+		if i := term.inputIndex(col); i != idx {
+			t.Errorf("column %d: %d (expected: %d)", col, i, idx)
+		}
+	}
+	term.cx = 3
+	term.delChar()
+	if string(term.input) != "ae\u0301b" {
+		t.Errorf("%q", string(term.input))
+	}
+}
+
+func TestPaste(t *testing.T) {
+	check := func(first bool, text string, expected string) {
+		term := Terminal{input: []rune("[]"), cx: 1, pasteFirst: first}
+		term.paste(text)
+		if string(term.input) != expected || term.cx != len(term.input)-1 {
+			t.Errorf("%q: %q %d (expected: %q)", text, string(term.input), term.cx, expected)
+		}
+	}
+	check(false, "foo", "[foo]")
+	check(false, "foo\r\nbar\n", "[foobar]")
+	check(false, "a\tb\x1bc", "[abc]")
+	check(true, "foo\r\nbar\n", "[foo]")
+	check(true, "\nfoo", "[]")
+}
+
+func TestIndexColumn(t *testing.T) {
+	items := []*Item{}
+	for i := 0; i < 12; i++ {
+		items = append(items, &Item{text: []rune("foo"), rank: buildEmptyRank(int32(i * 10))})
+	}
+	term := Terminal{count: 120, offset: 8, merger: NewMerger([][]*Item{items}, false, false)}
+	if term.indexWidth() != 0 {
+		t.Errorf("index column without the option: %d", term.indexWidth())
+	}
+	term.indexCol = indexInput
+	if w, n := term.indexWidth(), term.indexNumber(items[9], 1); w != 4 || n != 90 {
+		t.Errorf("input: %d %d", w, n)
+	}
+	term.indexCol = indexVisible
+	if w, n := term.indexWidth(), term.indexNumber(items[9], 1); w != 3 || n != 9 {
+		t.Errorf("visible: %d %d", w, n)
+	}
+}
+
+func TestReloadPosition(t *testing.T) {
+	items := func(n int) *Merger {
+		list := []*Item{}
+		for i := 0; i < n; i++ {
+			list = append(list, &Item{text: []rune("item"), rank: buildEmptyRank(int32(i))})
+		}
+		return NewMerger([][]*Item{list}, false, false)
+	}
+	term := &Terminal{
+		merger:    items(10),
+		cy:        5,
+		offset:    3,
+		selected:  make(map[int32]selectedItem),
+		reqBox:    util.NewEventBox(),
+		eventChan: make(chan C.Event, 10),
+		keymap:    defaultKeymap()}
+	term.DetachSelection()
+	term.reading = true
+
+	// The position is kept until the new list is long enough
+	term.UpdateList(items(3))
+	if term.reloadPos == nil {
+		t.Error("Position should not be restored yet")
+	}
+	term.UpdateList(items(8))
+	if term.reloadPos != nil || term.cy != 5 || term.offset != 3 {
+		t.Errorf("Position should be restored: %d %d", term.cy, term.offset)
+	}
+}
+
+func TestReloadTrack(t *testing.T) {
+	items := func(strs ...string) *Merger {
+		list := []*Item{}
+		for i, str := range strs {
+			list = append(list, &Item{text: []rune(str), rank: buildEmptyRank(int32(i))})
+		}
+		return NewMerger([][]*Item{list}, false, false)
+	}
+	term := &Terminal{
+		merger:    items("a", "b", "c"),
+		cy:        1,
+		track:     true,
+		selected:  make(map[int32]selectedItem),
+		reqBox:    util.NewEventBox(),
+		eventChan: make(chan C.Event, 10),
+		keymap:    defaultKeymap()}
+	term.DetachSelection()
+	term.reading = true
+
+	// The item is not in the partial list yet
+	term.UpdateList(items("x"))
+	if term.trackText == nil || term.cy != 1 {
+		t.Errorf("Item should still be tracked: %d", term.cy)
+	}
+
+	// The index of the item is different in the new list
+	term.UpdateList(items("x", "y", "b"))
+	if term.trackText != nil || term.cy != 2 {
+		t.Errorf("Cursor should be on the item: %d", term.cy)
+	}
+}
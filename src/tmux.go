@@ -0,0 +1,179 @@
+package fzf
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/junegunn/fzf/src/util"
+)
+
+// tmuxOpts is the position and the size of the tmux popup for --tmux
+type tmuxOpts struct {
+	position string
+	width    string
+	height   string
+}
+
+var tmuxSizeRegex = regexp.MustCompile("^[0-9]+%?$")
+
+func defaultTmuxOpts() *tmuxOpts {
+	return &tmuxOpts{"center", "50%", "50%"}
+}
+
+// parseTmuxOpts parses [center|top|bottom|left|right][,SIZE[%]][,SIZE[%]].
+// A single size is the width and the height of the popup at the center, and
+// the size along the axis otherwise, where the popup spans the other axis.
+// Two sizes are the width and the height.
+func parseTmuxOpts(str string) *tmuxOpts {
+	opts := defaultTmuxOpts()
+	tokens := strings.Split(str, ",")
+	switch tokens[0] {
+	case "center":
+		tokens = tokens[1:]
+	case "top", "bottom":
+		opts = &tmuxOpts{tokens[0], "100%", "50%"}
+		tokens = tokens[1:]
+	case "left", "right":
+		opts = &tmuxOpts{tokens[0], "50%", "100%"}
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 2 {
+		errorExit("invalid tmux option: " + str)
+	}
+	for _, token := range tokens {
+		if !tmuxSizeRegex.MatchString(token) {
+			errorExit("invalid tmux option: " + str)
+		}
+	}
+	switch len(tokens) {
+	case 1:
+		switch opts.position {
+		case "center":
+			opts.width, opts.height = tokens[0], tokens[0]
+		case "top", "bottom":
+			opts.height = tokens[0]
+		case "left", "right":
+			opts.width = tokens[0]
+		}
+	case 2:
+		opts.width, opts.height = tokens[0], tokens[1]
+	}
+	return opts
+}
+
+// popupArgs returns the arguments to tmux display-popup for the position and
+// the size of the popup
+func (opts *tmuxOpts) popupArgs() []string {
+	args := []string{"display-popup", "-E", "-w", opts.width, "-h", opts.height}
+	switch opts.position {
+	case "top":
+		return append(args, "-x", "C", "-y", "0")
+	case "bottom":
+		// The y position is the bottom line of the popup
+		return append(args, "-x", "C", "-y", "9999")
+	case "left":
+		return append(args, "-x", "0", "-y", "C")
+	case "right":
+		return append(args, "-x", "R", "-y", "C")
+	}
+	return append(args, "-x", "C", "-y", "C")
+}
+
+// shellQuote quotes the string for the shell
+func shellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
+
+// runTmux starts fzf with the arguments in a tmux popup and waits for it to
+// finish. The standard input is forwarded to the process through a named
+// pipe, and its output is printed when it is done. It returns the exit status
+// of the process.
+func runTmux(args []string, opts *tmuxOpts) int {
+	fail := func(err error) int {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	exe, err := exec.LookPath(os.Args[0])
+	if err == nil {
+		exe, err = filepath.Abs(exe)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	dir, err := ioutil.TempDir("", "fzf-tmux")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "output")
+	status := filepath.Join(dir, "status")
+
+	command := shellQuote(exe)
+	for _, arg := range args {
+		command += " " + shellQuote(arg)
+	}
+	// The option can be in $FZF_DEFAULT_OPTS
+	command += " --no-tmux"
+	if !util.IsTty() {
+		input := filepath.Join(dir, "input")
+		if err := syscall.Mkfifo(input, 0600); err != nil {
+			return fail(err)
+		}
+		command += " < " + shellQuote(input)
+		go func() {
+			// Blocks until the process opens the pipe
+			if pipe, err := os.OpenFile(input, os.O_WRONLY, 0); err == nil {
+				io.Copy(pipe, os.Stdin)
+				pipe.Close()
+			}
+		}()
+	}
+	command += " > " + shellQuote(output)
+
+	// The popup doesn't inherit the environment of this process
+	script := ""
+	if pwd, err := os.Getwd(); err == nil {
+		script += "cd " + shellQuote(pwd) + "\n"
+	}
+	for _, name := range []string{"FZF_DEFAULT_OPTS", "FZF_DEFAULT_COMMAND", "SHELL"} {
+		if value, found := os.LookupEnv(name); found {
+			script += "export " + name + "=" + shellQuote(value) + "\n"
+		}
+	}
+	script += command + "\necho $? > " + shellQuote(status) + "\n"
+	scriptFile := filepath.Join(dir, "script")
+	if err := ioutil.WriteFile(scriptFile, []byte(script), 0600); err != nil {
+		return fail(err)
+	}
+
+	tmux := exec.Command("tmux", append(opts.popupArgs(), "sh "+shellQuote(scriptFile))...)
+	tmux.Stderr = os.Stderr
+	if err := tmux.Run(); err != nil {
+		// The popup was closed before the process finished
+		if _, ok := err.(*exec.ExitError); ok {
+			return exitInterrupt
+		}
+		return fail(err)
+	}
+
+	if data, err := ioutil.ReadFile(output); err == nil {
+		os.Stdout.Write(data)
+	}
+	data, err := ioutil.ReadFile(status)
+	if err != nil {
+		return exitError
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return exitError
+	}
+	return code
+}
@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/junegunn/fzf/src/util"
 )
@@ -29,6 +30,16 @@ type Delimiter struct {
 	str   *string
 }
 
+// String returns the string representation of the delimiter
+func (d Delimiter) String() string {
+	if d.str != nil {
+		return *d.str
+	} else if d.regex != nil {
+		return d.regex.String()
+	}
+	return ""
+}
+
 func newRange(begin int, end int) Range {
 	if begin == 1 {
 		begin = rangeEllipsis
@@ -94,13 +105,14 @@ const (
 	awkWhite
 )
 
+// awkTokenizer splits the input into the slices of it without copying
 func awkTokenizer(input []rune) ([][]rune, int) {
 	// 9, 32
 	ret := [][]rune{}
-	str := []rune{}
+	begin := 0
 	prefixLength := 0
 	state := awkNil
-	for _, r := range input {
+	for idx, r := range input {
 		white := r == 9 || r == 32
 		switch state {
 		case awkNil:
@@ -108,29 +120,58 @@ func awkTokenizer(input []rune) ([][]rune, int) {
 				prefixLength++
 			} else {
 				state = awkBlack
-				str = append(str, r)
+				begin = idx
 			}
 		case awkBlack:
-			str = append(str, r)
 			if white {
 				state = awkWhite
 			}
 		case awkWhite:
-			if white {
-				str = append(str, r)
-			} else {
-				ret = append(ret, str)
+			if !white {
+				ret = append(ret, input[begin:idx])
 				state = awkBlack
-				str = []rune{r}
+				begin = idx
 			}
 		}
 	}
-	if len(str) > 0 {
-		ret = append(ret, str)
+	if state != awkNil {
+		ret = append(ret, input[begin:])
 	}
 	return ret, prefixLength
 }
 
+// splitRunes splits the input by the delimiter into the slices of it. Each
+// token includes the trailing delimiter. An empty delimiter splits the input
+// into individual characters.
+func splitRunes(input []rune, delimiter []rune) [][]rune {
+	if len(delimiter) == 0 {
+		ret := make([][]rune, len(input))
+		for idx := range input {
+			ret[idx] = input[idx : idx+1]
+		}
+		return ret
+	}
+	ret := [][]rune{}
+	begin := 0
+	for idx := 0; idx+len(delimiter) <= len(input); {
+		match := true
+		for didx, r := range delimiter {
+			if input[idx+didx] != r {
+				match = false
+				break
+			}
+		}
+		if match {
+			idx += len(delimiter)
+			ret = append(ret, input[begin:idx])
+			begin = idx
+		} else {
+			idx++
+		}
+	}
+	return append(ret, input[begin:])
+}
+
 // Tokenize tokenizes the given string with the delimiter
 func Tokenize(runes []rune, delimiter Delimiter) []Token {
 	if delimiter.str == nil && delimiter.regex == nil {
@@ -139,29 +180,27 @@ func Tokenize(runes []rune, delimiter Delimiter) []Token {
 		return withPrefixLengths(tokens, prefixLength)
 	}
 
-	var tokens []string
+	// Tokens are the slices of the input to avoid allocations, as the input
+	// is tokenized for every item when --nth is set
+	var tokens [][]rune
 	if delimiter.str != nil {
-		tokens = strings.Split(string(runes), *delimiter.str)
-		for i := 0; i < len(tokens)-1; i++ {
-			tokens[i] = tokens[i] + *delimiter.str
-		}
+		tokens = splitRunes(runes, []rune(*delimiter.str))
 	} else if delimiter.regex != nil {
 		str := string(runes)
+		begin := 0
 		for len(str) > 0 {
 			loc := delimiter.regex.FindStringIndex(str)
 			if loc == nil {
 				loc = []int{0, len(str)}
 			}
 			last := util.Max(loc[1], 1)
-			tokens = append(tokens, str[:last])
+			end := begin + utf8.RuneCountInString(str[:last])
+			tokens = append(tokens, runes[begin:end])
+			begin = end
 			str = str[last:]
 		}
 	}
-	asRunes := make([][]rune, len(tokens))
-	for i, token := range tokens {
-		asRunes[i] = []rune(token)
-	}
-	return withPrefixLengths(asRunes, 0)
+	return withPrefixLengths(tokens, 0)
 }
 
 func joinTokens(tokens []Token) []rune {
@@ -172,12 +211,30 @@ func joinTokens(tokens []Token) []rune {
 	return ret
 }
 
-func joinTokensAsRunes(tokens []Token) []rune {
-	ret := []rune{}
+// joinAdjacentTokens returns the concatenation of the tokens. If they are
+// adjacent slices of the same input, the slice of the input spanning them is
+// returned instead of a copy.
+func joinAdjacentTokens(tokens []Token) []rune {
+	if len(tokens) == 0 {
+		return []rune{}
+	}
+	length := 0
 	for _, token := range tokens {
-		ret = append(ret, token.text...)
+		length += len(token.text)
 	}
-	return ret
+	first := tokens[0].text
+	if length > cap(first) {
+		return joinTokens(tokens)
+	}
+	joined := first[:length]
+	offset := 0
+	for _, token := range tokens {
+		if len(token.text) > 0 && &joined[offset] != &token.text[0] {
+			return joinTokens(tokens)
+		}
+		offset += len(token.text)
+	}
+	return joined
 }
 
 // Transform is used to transform the input when --with-nth option is given
@@ -190,14 +247,14 @@ func Transform(tokens []Token, withNth []Range) []Token {
 		if r.begin == r.end {
 			idx := r.begin
 			if idx == rangeEllipsis {
-				part = append(part, joinTokensAsRunes(tokens)...)
+				part = joinAdjacentTokens(tokens)
 			} else {
 				if idx < 0 {
 					idx += numTokens + 1
 				}
 				if idx >= 1 && idx <= numTokens {
 					minIdx = idx - 1
-					part = append(part, tokens[idx-1].text...)
+					part = tokens[idx-1].text
 				}
 			}
 		} else {
@@ -222,10 +279,10 @@ func Transform(tokens []Token, withNth []Range) []Token {
 				}
 			}
 			minIdx = util.Max(0, begin-1)
-			for idx := begin; idx <= end; idx++ {
-				if idx >= 1 && idx <= numTokens {
-					part = append(part, tokens[idx-1].text...)
-				}
+			begin = util.Max(begin, 1)
+			end = util.Min(end, numTokens)
+			if begin <= end {
+				part = joinAdjacentTokens(tokens[begin-1 : end])
 			}
 		}
 		var prefixLength int
@@ -108,3 +108,31 @@ func TestTransform(t *testing.T) {
 func TestTransformIndexOutOfBounds(t *testing.T) {
 	Transform([]Token{}, splitNth("1"))
 }
+
+func TestTokenizeWithoutCopy(t *testing.T) {
+	input := []rune("  가나:  def::  ghi  ")
+	for _, delim := range []Delimiter{Delimiter{}, delimiterRegexp(":"), delimiterRegexp("::"), delimiterRegexp(":+")} {
+		tokens := Tokenize(input, delim)
+		if joined := string(joinTokens(tokens)); joined != string(input[tokens[0].prefixLength:]) {
+			t.Errorf("%v: %s", delim, joined)
+		}
+		for _, token := range tokens {
+			if len(token.text) > 0 && &token.text[0] != &input[token.prefixLength] {
+				t.Errorf("%v: token should be the slice of the input", delim)
+			}
+		}
+		tx := Transform(tokens, splitNth("1..2,.."))
+		if &tx[0].text[0] != &tokens[0].text[0] || string(tx[1].text) != string(joinTokens(tokens)) {
+			t.Errorf("%v: %v", delim, tx)
+		}
+	}
+
+	if tokens := Tokenize([]rune("a,b,"), delimiterRegexp(",")); len(tokens) != 3 ||
+		string(tokens[1].text) != "b," || len(tokens[2].text) != 0 {
+		t.Errorf("%v", tokens)
+	}
+	if tokens := Tokenize([]rune("가b"), delimiterRegexp("")); len(tokens) != 2 ||
+		string(tokens[0].text) != "가" || tokens[1].prefixLength != 1 {
+		t.Errorf("%v", tokens)
+	}
+}
@@ -0,0 +1,98 @@
+package fzf
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/junegunn/fzf/src/util"
+)
+
+// transformTimeout is how long the transformer waits for the command to print
+// the line for the line it is given
+var transformTimeout = time.Second
+
+// commandTransformer returns an InputTransformer that writes each line to the
+// command and replaces it with the line the command prints back. The command
+// is started on the first line and keeps running, so it has to print a line
+// for each line it reads without buffering its output, e.g. sed -u. The lines
+// are left intact once the command fails, or does not print a line in time,
+// e.g. when it drops the line like grep or buffers its output; the command is
+// killed then.
+func commandTransformer(command string, delim byte) InputTransformer {
+	var mutex sync.Mutex
+	var cmd *exec.Cmd
+	var in io.WriteCloser
+	var lines chan []byte
+	done := make(chan struct{})
+	failed := false
+
+	start := func() bool {
+		cmd = util.ExecCommandGroup(command)
+		var err error
+		if in, err = cmd.StdinPipe(); err != nil {
+			return false
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return false
+		}
+		if cmd.Start() != nil {
+			return false
+		}
+		lines = make(chan []byte)
+		go func() {
+			defer close(lines)
+			out := bufio.NewReader(stdout)
+			for {
+				line, err := out.ReadBytes(delim)
+				if err != nil {
+					return
+				}
+				select {
+				case lines <- line[:len(line)-1]:
+				case <-done:
+					return
+				}
+			}
+		}()
+		return true
+	}
+
+	fail := func() {
+		failed = true
+		if lines != nil {
+			close(done)
+			in.Close()
+			util.KillGroup(cmd)
+			go cmd.Wait()
+		}
+	}
+
+	return func(data []byte) []byte {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failed {
+			return data
+		}
+		if lines == nil && !start() {
+			fail()
+			return data
+		}
+		if _, err := in.Write(append(append([]byte{}, data...), delim)); err != nil {
+			fail()
+			return data
+		}
+		select {
+		case line, ok := <-lines:
+			if ok {
+				return line
+			}
+		case <-time.After(transformTimeout):
+		}
+		fail()
+		return data
+	}
+}
@@ -0,0 +1,252 @@
+package fzf
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/junegunn/fzf/src/util"
+)
+
+// treeIndent is the indentation of each level of the tree view
+const treeIndent = "  "
+
+// treePath returns the path of the item without the trailing slash, which is
+// used as the key of a collapsed directory
+func treePath(text []rune) string {
+	path := string(text)
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// treeParent returns the directory containing the path, or an empty string if
+// the path is at the top level
+func treeParent(path string) string {
+	if idx := strings.LastIndex(path, "/"); idx > 0 {
+		return path[:idx]
+	}
+	return ""
+}
+
+// treeItem returns the copy of the item to display in tree view: the last
+// component of the path indented by its depth. The offsets of the matches and
+// the ANSI colors are shifted accordingly, and the ellipsis is appended to a
+// collapsed directory.
+func (t *Terminal) treeItem(item *Item) *Item {
+	text := item.text
+	end := len(text)
+	if end > 1 && text[end-1] == '/' {
+		end--
+	}
+	start, depth := 0, 0
+	for i := 0; i < end; i++ {
+		if text[i] == '/' {
+			start = i + 1
+			depth++
+		}
+	}
+	if depth > 0 && start == end {
+		// The root directory
+		start, depth = 0, 0
+	}
+
+	display := []rune(strings.Repeat(treeIndent, depth))
+	display = append(display, text[start:]...)
+	if t.collapsed[treePath(text)] {
+		if display[len(display)-1] != '/' {
+			display = append(display, '/')
+		}
+		display = append(display, t.ellipsis...)
+	}
+
+	shift := int32(depth*len(treeIndent) - start)
+	move := func(offset int32) int32 {
+		return util.Constrain32(offset, int32(start), int32(len(text))) + shift
+	}
+	offsets := make([]Offset, len(item.offsets))
+	for idx, offset := range item.offsets {
+		offsets[idx] = Offset{move(offset[0]), move(offset[1]), offset[2]}
+	}
+	colors := make([]ansiOffset, len(item.colors))
+	for idx, ansi := range item.colors {
+		colors[idx] = ansiOffset{[2]int32{move(ansi.offset[0]), move(ansi.offset[1])}, ansi.color}
+	}
+	return &Item{text: display, offsets: offsets, colors: colors, rank: item.rank}
+}
+
+// displayItem returns the item as it is displayed in the list
+func (t *Terminal) displayItem(item *Item) *Item {
+	if t.tree {
+		return t.treeItem(item)
+	}
+	return item
+}
+
+// byTreePath is for sorting Items in the order of the paths, so that each
+// directory is followed by the items in it
+type byTreePath []*Item
+
+func (a byTreePath) Len() int {
+	return len(a)
+}
+
+func (a byTreePath) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byTreePath) Less(i, j int) bool {
+	return treeLess(treeKey(a[i].text), treeKey(a[j].text))
+}
+
+// treeKey returns the path of the item without the trailing slash
+func treeKey(text []rune) []rune {
+	if len(text) > 1 && text[len(text)-1] == '/' {
+		return text[:len(text)-1]
+	}
+	return text
+}
+
+// treeLess compares the paths with the slash ordered before any other
+// character, so that a/b comes before a-b
+func treeLess(a []rune, b []rune) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] == '/' || b[i] == '/' {
+				return a[i] == '/'
+			}
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// treeSearch returns the index of the first item whose path is not less than
+// the given one in the items sorted by byTreePath
+func treeSearch(items []*Item, path []rune) int {
+	return sort.Search(len(items), func(i int) bool {
+		return !treeLess(treeKey(items[i].text), path)
+	})
+}
+
+// treePrefix returns the prefix of the paths in the directory
+func treePrefix(path string) []rune {
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return []rune(path)
+}
+
+// treeSubtree returns the range of the items in the directory of the path in
+// the items sorted by byTreePath, where they are contiguous
+func treeSubtree(items []*Item, path string) (int, int) {
+	prefix := treePrefix(path)
+	start := treeSearch(items, prefix)
+	end := start
+	for end < len(items) && treeUnder(treeKey(items[end].text), prefix) {
+		end++
+	}
+	return start, end
+}
+
+// treeUnder tells if the path is in the directory of the prefix
+func treeUnder(text []rune, prefix []rune) bool {
+	if len(text) <= len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if text[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// collapsedParent returns the outermost collapsed directory containing the
+// item, or an empty string if there is none
+func (t *Terminal) collapsedParent(item *Item) string {
+	found := ""
+	for path := treeParent(treePath(item.text)); len(path) > 0; path = treeParent(path) {
+		if t.collapsed[path] {
+			found = path
+		}
+	}
+	return found
+}
+
+// collapseTree returns the items sorted by byTreePath without the ones in the
+// collapsed directories. The items in a collapsed directory are skipped at
+// once as they are contiguous.
+func (t *Terminal) collapseTree(items []*Item) []*Item {
+	if len(t.collapsed) == 0 {
+		return items
+	}
+	shown := []*Item{}
+	for i := 0; i < len(items); {
+		if path := t.collapsedParent(items[i]); len(path) > 0 {
+			_, end := treeSubtree(items[i:], path)
+			i += end
+			continue
+		}
+		shown = append(shown, items[i])
+		i++
+	}
+	return shown
+}
+
+// buildTree returns the merger to display in tree view. The items are sorted
+// by their paths instead of the relevance so that the indentation reflects
+// the hierarchy, and the ones in the collapsed directories are left out.
+func (t *Terminal) buildTree(merger *Merger) *Merger {
+	if !t.tree {
+		return merger
+	}
+	items := make([]*Item, merger.Length())
+	for i := range items {
+		items[i] = merger.Get(i)
+	}
+	sort.Stable(byTreePath(items))
+	t.treeItems = items
+	t.treeShown = t.collapseTree(items)
+	return NewMerger([][]*Item{t.treeShown}, false, false)
+}
+
+// toggleCollapse collapses the directory of the current item, or expands it
+// if it is already collapsed. If the current item has no children in the
+// list, the directory containing it is collapsed. The cursor is placed on the
+// directory if it is in the list. Only the items in the directory are removed
+// from or inserted into the displayed list.
+func (t *Terminal) toggleCollapse() {
+	if !t.tree || t.cy < 0 || t.cy >= len(t.treeShown) {
+		return
+	}
+	path := treePath(t.treeShown[t.cy].text)
+	var shown []*Item
+	if t.collapsed[path] {
+		delete(t.collapsed, path)
+		start, end := treeSubtree(t.treeItems, path)
+		children := t.collapseTree(t.treeItems[start:end])
+		at := treeSearch(t.treeShown, treePrefix(path))
+		shown = make([]*Item, 0, len(t.treeShown)+len(children))
+		shown = append(shown, t.treeShown[:at]...)
+		shown = append(shown, children...)
+		shown = append(shown, t.treeShown[at:]...)
+	} else {
+		if start, end := treeSubtree(t.treeItems, path); start == end {
+			path = treeParent(path)
+		}
+		if len(path) == 0 {
+			return
+		}
+		t.collapsed[path] = true
+		start, end := treeSubtree(t.treeShown, path)
+		shown = make([]*Item, 0, len(t.treeShown)-(end-start))
+		shown = append(shown, t.treeShown[:start]...)
+		shown = append(shown, t.treeShown[end:]...)
+	}
+	t.treeShown = shown
+	t.merger = NewMerger([][]*Item{shown}, false, false)
+	if at := treeSearch(shown, []rune(path)); at < len(shown) && treePath(shown[at].text) == path {
+		t.cy = at
+	}
+}
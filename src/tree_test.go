@@ -0,0 +1,93 @@
+package fzf
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTreeItem(t *testing.T) {
+	term := &Terminal{ellipsis: []rune(".."), collapsed: map[string]bool{"a/b": true}}
+	check := func(text string, offsets []Offset, expected string, expectedOffsets []Offset) {
+		item := term.treeItem(&Item{text: []rune(text), offsets: offsets, rank: buildEmptyRank(3)})
+		if string(item.text) != expected || item.Index() != 3 ||
+			len(offsets) > 0 && !reflect.DeepEqual(item.offsets, expectedOffsets) {
+			t.Errorf("%s: %q %v (expected: %q %v)", text, string(item.text), item.offsets, expected, expectedOffsets)
+		}
+	}
+	check("foo", nil, "foo", nil)
+	check("/", nil, "/", nil)
+	check("a/x.go", []Offset{{0, 1, 1}, {2, 4, 2}}, "  x.go", []Offset{{2, 2, 1}, {2, 4, 2}})
+	check("a/c/", []Offset{{2, 4, 2}}, "  c/", []Offset{{2, 4, 2}})
+	check("./a/b/y.go", []Offset{{4, 10, 6}}, "      y.go", []Offset{{6, 10, 6}})
+	check("a/b", []Offset{{2, 3, 1}}, "  b/..", []Offset{{2, 3, 1}})
+	check("a/b/", nil, "  b/..", nil)
+}
+
+func TestCollapseTree(t *testing.T) {
+	items := []*Item{}
+	for i, str := range []string{"./c/z", "./a/x.go", ".", "./a/b/y.go", "./a/b", "./c", "./a"} {
+		items = append(items, &Item{text: []rune(str), rank: buildEmptyRank(int32(i))})
+	}
+	merger := NewMerger([][]*Item{items}, false, false)
+	term := &Terminal{tree: true, collapsed: make(map[string]bool)}
+	term.merger = term.buildTree(merger)
+	check := func(expected ...string) {
+		list := []string{}
+		for i := 0; i < term.merger.Length(); i++ {
+			list = append(list, string(term.merger.Get(i).text))
+		}
+		if !reflect.DeepEqual(list, expected) {
+			t.Errorf("%q (expected: %q)", list, expected)
+		}
+	}
+
+	// The items are sorted by their paths
+	check(".", "./a", "./a/b", "./a/b/y.go", "./a/x.go", "./c", "./c/z")
+
+	// Collapsing the directory of the current item
+	term.cy = 1
+	term.toggleCollapse()
+	check(".", "./a", "./c", "./c/z")
+
+	// Collapsing the directory containing the current item
+	term.cy = 3
+	term.toggleCollapse()
+	check(".", "./a", "./c")
+	if term.cy != 2 {
+		t.Errorf("cursor not on the directory: %d", term.cy)
+	}
+
+	// Expanding
+	term.cy = 1
+	term.toggleCollapse()
+	check(".", "./a", "./a/b", "./a/b/y.go", "./a/x.go", "./c")
+	if term.cy != 1 {
+		t.Errorf("cursor not on the directory: %d", term.cy)
+	}
+	if term.buildTree(merger).Length() != 6 {
+		t.Error("collapsed directories are not applied to the new list")
+	}
+}
+
+func TestTreeOrder(t *testing.T) {
+	items := []*Item{}
+	for _, str := range []string{"a-b", "a/b/", "a/", "a/b/c", "a.go", "a/b-c"} {
+		items = append(items, &Item{text: []rune(str)})
+	}
+	sort.Stable(byTreePath(items))
+	list := []string{}
+	for _, item := range items {
+		list = append(list, string(item.text))
+	}
+	expected := []string{"a/", "a/b/", "a/b/c", "a/b-c", "a-b", "a.go"}
+	if !reflect.DeepEqual(list, expected) {
+		t.Errorf("%q (expected: %q)", list, expected)
+	}
+	if start, end := treeSubtree(items, "a/b"); start != 2 || end != 3 {
+		t.Errorf("a/b: %d-%d", start, end)
+	}
+	if start, end := treeSubtree(items, "a"); start != 1 || end != 4 {
+		t.Errorf("a: %d-%d", start, end)
+	}
+}
@@ -10,17 +10,19 @@ type Events map[EventType]interface{}
 
 // EventBox is used for coordinating events
 type EventBox struct {
-	events Events
-	cond   *sync.Cond
-	ignore map[EventType]bool
+	events      Events
+	cond        *sync.Cond
+	ignore      map[EventType]bool
+	subscribers map[EventType][]chan interface{}
 }
 
 // NewEventBox returns a new EventBox
 func NewEventBox() *EventBox {
 	return &EventBox{
-		events: make(Events),
-		cond:   sync.NewCond(&sync.Mutex{}),
-		ignore: make(map[EventType]bool)}
+		events:      make(Events),
+		cond:        sync.NewCond(&sync.Mutex{}),
+		ignore:      make(map[EventType]bool),
+		subscribers: make(map[EventType][]chan interface{})}
 }
 
 // Wait blocks the goroutine until signaled
@@ -43,6 +45,27 @@ func (b *EventBox) Set(event EventType, value interface{}) {
 	if _, found := b.ignore[event]; !found {
 		b.cond.Broadcast()
 	}
+	for _, ch := range b.subscribers[event] {
+		// Replace the value not yet received so that slow subscribers only
+		// see the latest one, just like Wait
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- value
+	}
+}
+
+// Subscribe returns a channel that receives the values of the event. Unlike
+// Wait, it allows any number of goroutines to be notified of the event
+// independently of one another. A value is replaced by the next one if it is
+// not received in time.
+func (b *EventBox) Subscribe(event EventType) <-chan interface{} {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+	ch := make(chan interface{}, 1)
+	b.subscribers[event] = append(b.subscribers[event], ch)
+	return ch
 }
 
 // Clear clears the events
@@ -59,3 +59,36 @@ func TestEventBox(t *testing.T) {
 		t.Error("Invalid sum", sum)
 	}
 }
+
+func TestEventBoxSubscribe(t *testing.T) {
+	eb := NewEventBox()
+	ch1 := eb.Subscribe(EvtSearchFin)
+	ch2 := eb.Subscribe(EvtSearchFin)
+	progress := eb.Subscribe(EvtSearchProgress)
+
+	eb.Set(EvtSearchFin, 10)
+	if val := <-ch1; val != 10 {
+		t.Error("Invalid value", val)
+	}
+	eb.Set(EvtSearchFin, 20)
+	if val := <-ch1; val != 20 {
+		t.Error("Invalid value", val)
+	}
+	// Only the latest value is kept for slow subscribers
+	if val := <-ch2; val != 20 {
+		t.Error("Invalid value", val)
+	}
+	select {
+	case val := <-progress:
+		t.Error("Unexpected value", val)
+	default:
+	}
+
+	// Subscription does not affect Wait
+	eb.Wait(func(events *Events) {
+		if (*events)[EvtSearchFin] != 20 {
+			t.Error("Invalid events", *events)
+		}
+		events.Clear()
+	})
+}
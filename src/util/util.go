@@ -6,6 +6,7 @@ import "C"
 import (
 	"os"
 	"os/exec"
+	"syscall"
 	"time"
 	"unicode/utf8"
 )
@@ -144,3 +145,30 @@ func ExecCommand(command string) *exec.Cmd {
 	}
 	return exec.Command(shell, "-c", command)
 }
+
+// ExecCommandGroup is like ExecCommand but the command runs in a new process
+// group so that the processes it starts can be killed with KillGroup
+func ExecCommandGroup(command string) *exec.Cmd {
+	cmd := ExecCommand(command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// KillGroup kills the process group of the command started by
+// ExecCommandGroup
+func KillGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// Become replaces the current process with the shell running the command. If
+// standard input is not a terminal, it is replaced with /dev/tty so that the
+// command can read from the terminal. It only returns on failure.
+func Become(command string) error {
+	if !IsTty() {
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			syscall.Dup2(int(tty.Fd()), 0)
+		}
+	}
+	cmd := ExecCommand(command)
+	return syscall.Exec(cmd.Path, cmd.Args, os.Environ())
+}
@@ -0,0 +1,154 @@
+package fzf
+
+import (
+	"github.com/junegunn/fzf/src/util"
+)
+
+// viCommand handles the key in the normal mode of vi editing mode. Deletion
+// commands take a motion that follows, e.g. dw, and change commands switch to
+// the insert mode after deleting the text. It returns the actions to perform
+// for the keys that move the cursor in the list.
+func (t *Terminal) viCommand(r rune) []action {
+	defer t.viConstrain()
+
+	if op := t.viOperator; op != 0 {
+		t.viOperator = 0
+		begin, end := t.cx, t.cx
+		switch r {
+		case op:
+			begin, end = 0, len(t.input)
+		case 'w':
+			if op == 'c' {
+				// cw is the same as ce as in vi
+				end = t.viWordEnd()
+			} else {
+				end = t.viNextWordStart()
+			}
+		case 'e':
+			end = t.viWordEnd()
+		case 'b':
+			begin = t.viPrevWordStart()
+		case '$':
+			end = len(t.input)
+		case '0', '^':
+			begin = 0
+		case 'h':
+			begin = util.Max(0, t.cx-1)
+		case 'l', ' ':
+			end = util.Min(len(t.input), t.cx+1)
+		default:
+			return nil
+		}
+		t.viDelete(begin, end)
+		if op == 'c' {
+			t.viNormal = false
+		}
+		return nil
+	}
+
+	switch r {
+	case 'd', 'c':
+		t.viOperator = r
+	case 'h':
+		t.cx = util.Max(0, t.cx-1)
+	case 'l', ' ':
+		t.cx++
+	case '0', '^':
+		t.cx = 0
+	case '$':
+		t.cx = len(t.input)
+	case 'w':
+		t.cx = t.viNextWordStart()
+	case 'b':
+		t.cx = t.viPrevWordStart()
+	case 'e':
+		if t.cx+1 < len(t.input) {
+			t.cx++
+			t.cx = t.viWordEnd() - 1
+		}
+	case 'x':
+		t.viDelete(t.cx, util.Min(len(t.input), t.cx+1))
+	case 'X':
+		t.viDelete(util.Max(0, t.cx-1), t.cx)
+	case 'D':
+		t.viDelete(t.cx, len(t.input))
+	case 'C':
+		t.viDelete(t.cx, len(t.input))
+		t.viNormal = false
+	case 'S':
+		t.viDelete(0, len(t.input))
+		t.viNormal = false
+	case 'i':
+		t.viNormal = false
+	case 'a':
+		t.cx = util.Min(len(t.input), t.cx+1)
+		t.viNormal = false
+	case 'I':
+		t.cx = 0
+		t.viNormal = false
+	case 'A':
+		t.cx = len(t.input)
+		t.viNormal = false
+	case 'p', 'P':
+		if text := t.killRing.yank(); len(text) > 0 {
+			if r == 'p' {
+				t.cx = util.Min(len(t.input), t.cx+1)
+			}
+			t.yank(text)
+			t.cx--
+		}
+	case 'j':
+		return toActions(actDown)
+	case 'k':
+		return toActions(actUp)
+	}
+	return nil
+}
+
+// viEscape switches to the normal mode. The cursor moves back onto the last
+// character inserted as in vi.
+func (t *Terminal) viEscape() {
+	t.viNormal = true
+	t.viOperator = 0
+	t.cx = util.Max(0, t.cx-1)
+}
+
+// viConstrain keeps the cursor on a character of the query in the normal
+// mode, where it cannot be placed after the last character
+func (t *Terminal) viConstrain() {
+	if t.viNormal {
+		t.cx = util.Constrain(t.cx, 0, util.Max(0, len(t.input)-1))
+	}
+}
+
+// viDelete deletes the part of the query between begin and end and saves it in
+// the kill ring for the put commands
+func (t *Terminal) viDelete(begin int, end int) {
+	if begin >= end {
+		return
+	}
+	t.killRing.kill(t.input[begin:end], false, false)
+	t.input = append(t.input[:begin], t.input[end:]...)
+	t.cx = begin
+}
+
+// viNextWordStart returns the position of the beginning of the next word
+func (t *Terminal) viNextWordStart() int {
+	idx := findFirstMatch(t.wordPrev, string(t.input[t.cx:]))
+	if idx < 0 {
+		return len(t.input)
+	}
+	return t.cx + idx + 1
+}
+
+// viPrevWordStart returns the position of the beginning of the current word,
+// or that of the previous word if the cursor is already at the beginning
+func (t *Terminal) viPrevWordStart() int {
+	return findLastMatch(t.wordPrev, string(t.input[:t.cx])) + 1
+}
+
+// viWordEnd returns the position right after the end of the current or the
+// next word
+func (t *Terminal) viWordEnd() int {
+	return t.cx + findFirstMatch(t.wordNext, string(t.input[t.cx:])) + 1
+}
@@ -0,0 +1,177 @@
+package fzf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// walkerOpts are the options of the built-in file walker, which lists the
+// files under the current directory when the input is a terminal and
+// FZF_DEFAULT_COMMAND is not set
+type walkerOpts struct {
+	file   bool
+	dir    bool
+	follow bool
+	hidden bool
+	nolink bool
+	ignore bool
+	depth  int
+}
+
+func defaultWalkerOpts() walkerOpts {
+	return walkerOpts{file: true, ignore: true}
+}
+
+// parseWalker parses the comma-separated list of the types of the entries to
+// list and the options of the walker. The depth and whether to respect the
+// ignore files are not changed.
+func parseWalker(opts *walkerOpts, str string) {
+	opts.file, opts.dir, opts.follow, opts.hidden, opts.nolink = false, false, false, false, false
+	for _, token := range strings.Split(str, ",") {
+		switch token {
+		case "file":
+			opts.file = true
+		case "dir":
+			opts.dir = true
+		case "follow":
+			opts.follow = true
+		case "hidden":
+			opts.hidden = true
+		case "skip-links":
+			opts.nolink = true
+		default:
+			errorExit("invalid walker option: " + token)
+		}
+	}
+	if !opts.file && !opts.dir {
+		errorExit("walker must list file or dir")
+	}
+	if opts.follow && opts.nolink {
+		errorExit("walker cannot follow and skip symbolic links")
+	}
+}
+
+// walkerDir is a directory to read, linked to the directory containing it to
+// detect the loops of the symbolic links
+type walkerDir struct {
+	path   string
+	real   string
+	depth  int
+	parent *walkerDir
+	// The rules of the ignore files in the directory and the ones containing
+	// it, from the outermost one
+	ignores []*ignoreSet
+}
+
+// walker reads the directories in parallel and pushes the paths of the
+// entries relative to the root as they are found
+type walker struct {
+	opts      walkerOpts
+	push      func(string)
+	killed    func() bool
+	semaphore chan bool
+	waitGroup sync.WaitGroup
+}
+
+func newWalker(opts walkerOpts, push func(string), killed func() bool) *walker {
+	return &walker{
+		opts:      opts,
+		push:      push,
+		killed:    killed,
+		semaphore: make(chan bool, walkerConcurrency)}
+}
+
+// run walks the directory tree under the root and returns when all the
+// directories are read
+func (w *walker) run(root string) {
+	dir := &walkerDir{path: root}
+	if w.opts.ignore {
+		dir.ignores = ancestorIgnores(root)
+	}
+	if w.opts.follow {
+		dir.real, _ = filepath.EvalSymlinks(root)
+	}
+	w.waitGroup.Add(1)
+	go w.walk(dir, "")
+	w.waitGroup.Wait()
+}
+
+// inLoop tells if the real path of the directory is the one of the
+// directories containing it
+func (dir *walkerDir) inLoop() bool {
+	for parent := dir.parent; parent != nil; parent = parent.parent {
+		if parent.real == dir.real {
+			return true
+		}
+	}
+	return false
+}
+
+// walk reads the directory and starts reading its subdirectories. prefix is
+// the path of the directory relative to the root.
+func (w *walker) walk(dir *walkerDir, prefix string) {
+	defer w.waitGroup.Done()
+	if w.killed() {
+		return
+	}
+
+	// The number of the directories open at the same time is limited
+	w.semaphore <- true
+	file, err := os.Open(dir.path)
+	var infos []os.FileInfo
+	if err == nil {
+		infos, _ = file.Readdir(-1)
+		file.Close()
+	}
+	ignores := dir.ignores
+	if w.opts.ignore {
+		if set := readIgnoreFiles(dir.path, filepath.ToSlash(prefix)); set != nil {
+			ignores = append(ignores[:len(ignores):len(ignores)], set)
+		}
+	}
+	<-w.semaphore
+
+	for _, info := range infos {
+		name := info.Name()
+		if !w.opts.hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := prefix + name
+		isDir := info.IsDir()
+		isLink := info.Mode()&os.ModeSymlink != 0
+		if isLink && w.opts.nolink {
+			continue
+		}
+		if isLink && w.opts.follow {
+			if target, err := os.Stat(filepath.Join(dir.path, name)); err == nil {
+				isDir = target.IsDir()
+			}
+		}
+		if w.opts.ignore && (isDir && name == ".git" || isIgnored(ignores, path, isDir)) {
+			continue
+		}
+		if !isDir {
+			if w.opts.file {
+				w.push(path)
+			}
+			continue
+		}
+		if w.opts.dir {
+			w.push(path)
+		}
+		if w.opts.depth > 0 && dir.depth+1 >= w.opts.depth {
+			continue
+		}
+		sub := &walkerDir{path: filepath.Join(dir.path, name), depth: dir.depth + 1, parent: dir, ignores: ignores}
+		if w.opts.follow {
+			sub.real, _ = filepath.EvalSymlinks(sub.path)
+			if sub.inLoop() {
+				continue
+			}
+		}
+		w.waitGroup.Add(1)
+		go w.walk(sub, path+string(filepath.Separator))
+	}
+}
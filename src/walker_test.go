@@ -0,0 +1,136 @@
+package fzf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestWalker(t *testing.T) {
+	root, err := ioutil.TempDir("", "fzf-walker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, path := range []string{"a/b/c.go", "a/d.go", ".git/e", "f"} {
+		path = filepath.Join(root, path)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		ioutil.WriteFile(path, nil, 0600)
+	}
+	os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "a/b/up"))
+	os.Symlink(filepath.Join(root, "a/b"), filepath.Join(root, "g"))
+
+	check := func(str string, depth int, expected ...string) {
+		opts := walkerOpts{depth: depth}
+		parseWalker(&opts, str)
+		mutex := sync.Mutex{}
+		list := []string{}
+		newWalker(opts, func(path string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			list = append(list, filepath.ToSlash(path))
+		}, func() bool { return false }).run(root)
+		sort.Strings(list)
+		if !reflect.DeepEqual(list, expected) {
+			t.Errorf("%s: %q (expected: %q)", str, list, expected)
+		}
+	}
+	check("file", 0, "a/b/c.go", "a/b/up", "a/d.go", "f", "g")
+	check("file,hidden", 0, ".git/e", "a/b/c.go", "a/b/up", "a/d.go", "f", "g")
+	check("dir", 0, "a", "a/b")
+	check("file,dir", 2, "a", "a/b", "a/d.go", "f", "g")
+
+	// The symbolic links to the directories containing them are not followed
+	check("file,follow", 0, "a/b/c.go", "a/d.go", "f", "g/c.go", "g/up/d.go")
+	check("file,dir,skip-links", 0, "a", "a/b", "a/b/c.go", "a/d.go", "f")
+}
+
+func TestIgnoreRules(t *testing.T) {
+	rules := []string{"*.log", "!keep.log", "build/", "/root.txt", "doc/**/*.md", "# comment", "", "\\#hash", "[!a]*.tmp"}
+	set := &ignoreSet{}
+	for _, line := range rules {
+		if rule, ok := parseIgnoreRule(line); ok {
+			set.rules = append(set.rules, rule)
+		}
+	}
+	if len(set.rules) != 7 {
+		t.Errorf("Expected 7 rules, got %d", len(set.rules))
+	}
+	for path, expected := range map[string]bool{
+		"a.log":         true,
+		"x/a.log":       true,
+		"x/keep.log":    false,
+		"build":         true,
+		"x/build":       true,
+		"root.txt":      true,
+		"x/root.txt":    false,
+		"doc/a.md":      true,
+		"doc/x/y/a.md":  true,
+		"x/doc/a.md":    false,
+		"#hash":         true,
+		"a.txt":         false,
+		"x/build/a.txt": false,
+		"b.tmp":         true,
+		"a.tmp":         false,
+	} {
+		if isIgnored([]*ignoreSet{set}, path, path == "build" || path == "x/build") != expected {
+			t.Errorf("%s: expected %v", path, expected)
+		}
+	}
+	// build/ only matches directories
+	if isIgnored([]*ignoreSet{set}, "build", false) {
+		t.Error("build file should not be ignored")
+	}
+}
+
+func TestWalkerIgnore(t *testing.T) {
+	root, err := ioutil.TempDir("", "fzf-walker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		".gitignore":     "*.o\nout/\nsub/x/\n",
+		".git/config":    "",
+		"a.go":           "",
+		"a.o":            "",
+		"out/b":          "",
+		"sub/.ignore":    "!c.o\n/d\n",
+		"sub/c.o":        "",
+		"sub/d":          "",
+		"sub/e.o":        "",
+		"sub/x/d":        "",
+		"other/d":        "",
+		"other/.ignore2": "",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		ioutil.WriteFile(path, []byte(content), 0600)
+	}
+
+	check := func(dir string, ignore bool, expected ...string) {
+		opts := walkerOpts{file: true, hidden: true, ignore: ignore}
+		mutex := sync.Mutex{}
+		list := []string{}
+		newWalker(opts, func(path string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			list = append(list, filepath.ToSlash(path))
+		}, func() bool { return false }).run(dir)
+		sort.Strings(list)
+		if !reflect.DeepEqual(list, expected) {
+			t.Errorf("%v: %q (expected: %q)", ignore, list, expected)
+		}
+	}
+	check(root, true, ".gitignore", "a.go", "other/.ignore2", "other/d", "sub/.ignore", "sub/c.o")
+	check(root, false, ".git/config", ".gitignore", "a.go", "a.o", "other/.ignore2", "other/d", "out/b",
+		"sub/.ignore", "sub/c.o", "sub/d", "sub/e.o", "sub/x/d")
+
+	// The ignore files above the root in the repository apply as well
+	check(filepath.Join(root, "sub"), true, ".ignore", "c.o")
+}
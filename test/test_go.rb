@@ -224,6 +224,25 @@ class TestGoFZF < TestBase
     assert_equal 'hello', readonce.chomp
   end
 
+  def test_reload
+    input = tempname + '.input'
+    writelines input, %w[foo bar baz]
+    tmux.send_keys fzf(:multi, '--bind ctrl-r:reload').sub('FZF_DEFAULT_COMMAND=', "FZF_DEFAULT_COMMAND='cat #{input}'"), :Enter
+    tmux.until { |lines| lines[-2].include? '3/3' }
+    tmux.send_keys 'a', :Tab
+    tmux.until { |lines| lines[-2].include? '2/3 (1)' }
+
+    # Query and the selection of the line that still exists are kept
+    writelines input, %w[qux bar foo baz bar]
+    tmux.send_keys 'C-r'
+    tmux.until { |lines| lines[-2].include? '3/5 (1)' }
+    assert_equal '> a', tmux.capture.last
+    tmux.send_keys :Enter
+    assert_equal 'bar', readonce.chomp
+  ensure
+    File.unlink input rescue nil
+  end
+
   def test_key_bindings
     tmux.send_keys "#{FZF} -q 'foo bar foo-bar'", :Enter
     tmux.until { |lines| lines.last =~ /^>/ }
@@ -870,7 +889,7 @@ class TestGoFZF < TestBase
     tmux.send_keys :Escape, :a, :Escape, :b, :Escape, :c
     tmux.send_keys :Enter
     readonce
-    assert_equal ['["1"]', '["1"]', '("2"), ("2")', '("2"), ("2")', '("3"), ["3"], @"3"@'],
+    assert_equal ['[1]', '[1]', '(2), (2)', '(2), (2)', '(3), [3], @3@'],
       File.readlines(output).map(&:chomp)
   ensure
     File.unlink output rescue nil
@@ -892,7 +911,7 @@ class TestGoFZF < TestBase
     tmux.send_keys :Enter
     tmux.prepare
     readonce
-    assert_equal ['["1"], @"1"@', '["1" "2" "3"], @"1" "2" "3"@', '["1" "2" "4"], @"1" "2" "4"@'],
+    assert_equal ['[1], @1@', '[1 2 3], @1 2 3@', '[1 2 4], @1 2 4@'],
       File.readlines(output).map(&:chomp)
   ensure
     File.unlink output rescue nil
@@ -911,7 +930,7 @@ class TestGoFZF < TestBase
     tmux.until { |lines| lines[-2].include? '1/1' }
     tmux.send_keys 'C-c'
     tmux.prepare
-    assert_equal ['-c / "foo"bar'], File.readlines(output).map(&:chomp)
+    assert_equal ["-c / 'foo'bar"], File.readlines(output).map(&:chomp)
   ensure
     File.unlink output rescue nil
   end
@@ -1086,6 +1105,11 @@ class TestGoFZF < TestBase
     assert_equal src, `#{FZF} -fhehe -x -n 2.. --with-nth 2,1,1 --no-ansi < #{tempname}`.chomp
   end
 
+  def test_with_nth_streaming_filter
+    writelines tempname, ['hello world ', 'byebye']
+    assert_equal 'hello world ', `#{FZF} -f"^he hehe" -x -n 2.. --with-nth 2,1,1 --no-sort < #{tempname}`.chomp
+  end
+
   def test_exit_0_exit_code
     `echo foo | #{FZF} -q bar -0`
     assert_equal 1, $?.exitstatus
@@ -1156,6 +1180,44 @@ class TestGoFZF < TestBase
     end
   end
 
+  # Since 0.12.0
+  def test_max_matches
+    assert_equal %w[9 19 29],
+      `seq 1 100 | #{FZF} -f9 --max-matches 3`.split($/)
+    assert_equal %w[9 99 98],
+      `seq 1 100 | #{FZF} -f9 --max-matches 3 --tac`.split($/)
+    assert_equal %w[9 19 29],
+      `seq 1 100 | #{FZF} -f9 --max-matches 3 --no-sort`.split($/)
+    assert_equal %w[99 98 97],
+      `seq 1 100 | #{FZF} -f9 --max-matches 3 --no-sort --tac`.split($/)
+    assert_equal %w[1 2 3],
+      `seq 1 100 | #{FZF} -f '' --max-matches 3`.split($/)
+    assert_equal %w[100 99 98],
+      `seq 1 100 | #{FZF} -f '' --max-matches 3 --tac`.split($/)
+
+    # The input is not read to the end once enough lines are found
+    assert_equal %w[y y y], `yes | #{FZF} -fy --no-sort --max-matches 3`.split($/)
+  end
+
+  def test_unique
+    writelines tempname, %w[foo bar foo baz bar]
+    assert_equal %w[foo bar baz], `#{FZF} -f '' --unique < #{tempname}`.split($/)
+    assert_equal %w[baz bar foo], `#{FZF} -f '' --unique --tac < #{tempname}`.split($/)
+    assert_equal %w[bar baz], `#{FZF} -f ba --unique --no-sort < #{tempname}`.split($/)
+  end
+
+  def test_index
+    index = tempname + '.index'
+    File.unlink index rescue nil
+    2.times do
+      assert_equal %w[555 1555], `seq 1 2000 | #{FZF} -f555 --index=#{index}`.split($/)
+      assert File.exists?(index)
+    end
+    assert_equal %w[55], `seq 1 100 | #{FZF} -f55 --index=#{index}`.split($/)
+  ensure
+    File.unlink index rescue nil
+  end
+
 private
   def writelines path, lines
     File.unlink path while File.exists? path